@@ -0,0 +1,217 @@
+// Errors of the netcup API and their attribution to records
+
+package netcup
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// statusInvalidSession is the status code of netcup for a session, that is invalid or expired.
+const statusInvalidSession = 4001
+
+// statusZoneNotFound is the status code of netcup for a zone, that doesn't exist or doesn't belong to the customer.
+const statusZoneNotFound = 5029
+
+// statusValidationError is the status code of netcup for a rejected request, like a login with wrong credentials, and
+// for a request over its rate limit.
+const statusValidationError = 4013
+
+// APIError is returned, when the netcup API answers a request with an error.
+type APIError struct {
+	// Action is the API action of the failed request, like "updateDnsRecords"
+	Action string
+	// Status is the status of the response, "error" or "warning"
+	Status       string
+	StatusCode   int
+	ShortMessage string
+	LongMessage  string
+	// ClientRequestID is the ID sent with the request, which identifies it for the support of netcup
+	ClientRequestID string
+	// OffendingRecords contains the submitted records named by LongMessage, if the message is known. It is only set for
+	// updates and empty, if the message is unknown or doesn't identify any of the submitted records.
+	OffendingRecords []libdns.Record
+}
+
+// ErrAuthFailed is matched by an APIError with errors.Is, if netcup rejected the login, because the customer number,
+// API key or API password is wrong. Other failed requests don't match it.
+var ErrAuthFailed = errors.New("authentication failed")
+
+// ErrZoneNotFound is matched by an APIError with errors.Is, if the zone doesn't exist or doesn't belong to the customer.
+var ErrZoneNotFound = errors.New("zone not found")
+
+// ErrInvalidCredentials is another name of ErrAuthFailed.
+var ErrInvalidCredentials = ErrAuthFailed
+
+// ErrSessionExpired is matched by an APIError with errors.Is, if netcup rejected the request, because the session is
+// invalid or expired, and it still was after logging in again.
+var ErrSessionExpired = errors.New("session expired")
+
+// ErrMaintenance is matched with errors.Is, if netcup answered with the HTTP status 503, like during maintenance.
+var ErrMaintenance = errors.New("netcup API unavailable")
+
+// NetcupError is another name of APIError.
+type NetcupError = APIError
+
+func (err *APIError) Error() string {
+	if err.ClientRequestID == "" {
+		return fmt.Sprintf("%v %v: %v", loggingPrefixNetcup, err.ShortMessage, err.LongMessage)
+	}
+	return fmt.Sprintf("%v %v: %v (client request ID %v)", loggingPrefixNetcup, err.ShortMessage, err.LongMessage, err.ClientRequestID)
+}
+
+// Is makes errors.Is(err, ErrAuthFailed) true for a login rejected with the status code of a validation error, unless
+// it was rejected because of the rate limit, errors.Is(err, ErrRateLimited) for such a rejection, errors.Is(err,
+// ErrZoneNotFound) for a zone, that doesn't exist, and errors.Is(err, ErrSessionExpired) for an invalid session. They are
+// told apart by the status code of netcup. Only the rate limit, which netcup has no status code of its own for, is told
+// apart from other validation errors by the message. Login failures with other status codes match none of them.
+func (err *APIError) Is(target error) bool {
+	switch target {
+	case ErrAuthFailed:
+		return err.Action == "login" && err.StatusCode == statusValidationError && !err.rateLimited()
+	case ErrRateLimited:
+		return err.rateLimited()
+	case ErrZoneNotFound:
+		return err.StatusCode == statusZoneNotFound
+	case ErrSessionExpired:
+		return err.StatusCode == statusInvalidSession
+	}
+	return false
+}
+
+// ProviderError is returned, when a request to netcup fails, and names its action, so failures of the login, the reads
+// of the zone and the updates can be told apart. Err is the cause, like an *APIError, a *RateLimitError or a network
+// error, which can be matched with errors.Is and errors.As through the ProviderError.
+type ProviderError struct {
+	// Action is the API action of the failed request, like "login", "infoDnsRecords" or "updateDnsRecords"
+	Action string
+	Err    error
+	// the deadline of the context passed before the request was answered
+	timedOut bool
+}
+
+func (err *ProviderError) Error() string {
+	if err.timedOut {
+		return fmt.Sprintf("%v %v timed out: %v", loggingPrefixLibdnsNetcup, err.Action, err.Err)
+	}
+	return fmt.Sprintf("%v %v failed: %v", loggingPrefixLibdnsNetcup, err.Action, err.Err)
+}
+
+func (err *ProviderError) Unwrap() error {
+	return err.Err
+}
+
+// ErrActionMismatch is matched by an ActionMismatchError with errors.Is.
+var ErrActionMismatch = errors.New("response to another action")
+
+// ActionMismatchError is returned, if netcup answers a request with the response of another action, for example a cached
+// login response of a proxy. The response is discarded.
+type ActionMismatchError struct {
+	// Sent is the action of the request
+	Sent string
+	// Received is the action of the response
+	Received string
+}
+
+func (err *ActionMismatchError) Error() string {
+	return fmt.Sprintf("%v %v: sent %q, received %q", loggingPrefixLibdnsNetcup, ErrActionMismatch, err.Sent, err.Received)
+}
+
+// Is makes errors.Is(err, ErrActionMismatch) true.
+func (err *ActionMismatchError) Is(target error) bool {
+	return target == ErrActionMismatch
+}
+
+// Returns an ActionMismatchError, if the response is for another action than the request. netcup doesn't always use
+// the case of the request, and responses without action are accepted.
+func checkResponseAction(req request, res *response) error {
+	if res.Action == "" || strings.EqualFold(res.Action, req.Action) {
+		return nil
+	}
+	return &ActionMismatchError{Sent: req.Action, Received: res.Action}
+}
+
+// rejectionPattern is a known message of netcup for a rejected update and the records it applies to
+type rejectionPattern struct {
+	message *regexp.Regexp
+	// returns the offending records from the submitted ones, using the submatches of message
+	match func(submatches []string, records []dnsRecord) []dnsRecord
+}
+
+// rejectionPatterns are the known long messages of netcup for rejected updates.
+var rejectionPatterns = []rejectionPattern{
+	{
+		// an update or deletion of a record, that doesn't exist (anymore)
+		message: regexp.MustCompile(`DNS record with id (\S+) does not exist\.`),
+		match: func(submatches []string, records []dnsRecord) []dnsRecord {
+			return filterRecords(records, func(record dnsRecord) bool { return record.ID == submatches[1] })
+		},
+	},
+	{
+		// a destination, that is not valid for the type, like a host name in an A record
+		message: regexp.MustCompile(`Value in field destination does not match requirements of type: (\w+)\.`),
+		match: func(submatches []string, records []dnsRecord) []dnsRecord {
+			return filterRecords(records, func(record dnsRecord) bool {
+				return !record.DeleteRecord && strings.EqualFold(record.RecType, submatches[1]) && !validDestination(record)
+			})
+		},
+	},
+	{
+		// a record without host name, type or destination
+		message: regexp.MustCompile(`Value in field hostname, type or destination is missing\.`),
+		match: func(submatches []string, records []dnsRecord) []dnsRecord {
+			return filterRecords(records, func(record dnsRecord) bool {
+				return !record.DeleteRecord && (record.HostName == "" || record.RecType == "" || record.Destination == "")
+			})
+		},
+	},
+	{
+		// a deletion without ID
+		message: regexp.MustCompile(`Value in field id is missing\.`),
+		match: func(submatches []string, records []dnsRecord) []dnsRecord {
+			return filterRecords(records, func(record dnsRecord) bool { return record.DeleteRecord && record.ID == "" })
+		},
+	},
+}
+
+// Returns the submitted records named by the long message of a rejected update, or nil if the message is unknown.
+func offendingRecords(longMessage string, records []dnsRecord) []libdns.Record {
+	for _, pattern := range rejectionPatterns {
+		if submatches := pattern.message.FindStringSubmatch(longMessage); submatches != nil {
+			if offending := pattern.match(submatches, records); len(offending) > 0 {
+				return toLibdnsRecords(offending, 0)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+func filterRecords(records []dnsRecord, keep func(dnsRecord) bool) []dnsRecord {
+	var filtered []dnsRecord
+	for _, record := range records {
+		if keep(record) {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+// Checks the destination of A and AAAA records. For other types the validity is unknown,
+// so every record of the type named by netcup is attributed.
+func validDestination(record dnsRecord) bool {
+	switch strings.ToUpper(record.RecType) {
+	case "A":
+		ip := net.ParseIP(record.Destination)
+		return ip != nil && ip.To4() != nil
+	case "AAAA":
+		ip := net.ParseIP(record.Destination)
+		return ip != nil && ip.To4() == nil
+	}
+	return false
+}
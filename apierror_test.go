@@ -0,0 +1,280 @@
+package netcup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+func TestOffendingRecords(t *testing.T) {
+	submitted := []dnsRecord{
+		{ID: "1", HostName: "www", RecType: "A", Destination: "192.0.2.1"},
+		{ID: "2", HostName: "mail", RecType: "A", Destination: "mail.example.com"},
+		{HostName: "www", RecType: "AAAA", Destination: "192.0.2.3"},
+		{HostName: "www", RecType: "AAAA", Destination: "2001:db8::1"},
+		{HostName: "", RecType: "TXT", Destination: "token"},
+		{ID: "7", HostName: "old", RecType: "CNAME", Destination: "www", DeleteRecord: true},
+		{HostName: "old", RecType: "MX", Destination: "mail", DeleteRecord: true},
+	}
+
+	tests := []struct {
+		longMessage string
+		expected    []string
+	}{
+		{"DNS record with id 7 does not exist.", []string{"old CNAME www"}},
+		{"Value in field destination does not match requirements of type: A.", []string{"mail A mail.example.com"}},
+		{"Value in field destination does not match requirements of type: AAAA.", []string{"www AAAA 192.0.2.3"}},
+		{"Value in field hostname, type or destination is missing.", []string{" TXT token"}},
+		{"Value in field id is missing.", []string{"old MX mail"}},
+		// a known message, that doesn't match any submitted record
+		{"DNS record with id 99 does not exist.", nil},
+		// unknown messages have no attribution
+		{"Something went wrong.", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.longMessage, func(t *testing.T) {
+			var got []string
+			for _, record := range offendingRecords(test.longMessage, submitted) {
+				got = append(got, record.Name+" "+record.Type+" "+record.Value)
+			}
+			if len(got) != len(test.expected) {
+				t.Fatalf("Expected %q, got %q", test.expected, got)
+			}
+			for i := range got {
+				if got[i] != test.expected[i] {
+					t.Fatalf("Expected %q, got %q", test.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_APIErrorNamesOffendingRecords(t *testing.T) {
+	p, _ := newFakeProvider(t, netcuptest.Record{ID: "1", HostName: "www", Type: "A", Destination: "192.0.2.1"})
+
+	_, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{
+		{Type: "TXT", Name: "@", Value: "token"},
+		{Type: "A", Name: "mail", Value: "mail.example.com"},
+	})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected an APIError, got %v", err)
+	}
+	if apiErr.Action != "updateDnsRecords" || apiErr.StatusCode != netcuptest.StatusValidationError {
+		t.Fatalf("Unexpected APIError %+v", apiErr)
+	}
+	if len(apiErr.OffendingRecords) != 1 || apiErr.OffendingRecords[0].Name != "mail" {
+		t.Fatalf("Expected the A record of mail as offending record, got %+v", apiErr.OffendingRecords)
+	}
+	if err.Error() != "[libdns_netcup] updateDnsRecords failed: [netcup] Validation Error.: Value in field destination does not match requirements of type: A. (client request ID "+apiErr.ClientRequestID+")" {
+		t.Fatalf("Expected the action and the message of netcup as error, got %q", err.Error())
+	}
+}
+
+func TestProvider_APIErrorWithUnknownMessage(t *testing.T) {
+	p, server := newFakeProvider(t)
+	server.FailNext("updateDnsRecords", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error.", LongMessage: "Unknown problem."})
+
+	_, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.LongMessage != "Unknown problem." || apiErr.OffendingRecords != nil {
+		t.Fatalf("Expected an APIError without offending records, got %v", err)
+	}
+}
+
+func TestProvider_ProviderError(t *testing.T) {
+	failures := map[string]netcuptest.Failure{
+		"netcup": {StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error.", LongMessage: "Something is wrong."},
+		"HTTP":   {HTTPStatusCode: 400, ShortMessage: "Bad Request"},
+	}
+	for name, failure := range failures {
+		// a failed infoDnsZone only falls back to DefaultTTL
+		for _, action := range []string{"login", "infoDnsRecords", "updateDnsRecords"} {
+			t.Run(name+" "+action, func(t *testing.T) {
+				p, server := newFakeProvider(t)
+				server.FailNext(action, failure)
+
+				_, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}})
+				var providerErr *ProviderError
+				if !errors.As(err, &providerErr) || providerErr.Action != action {
+					t.Fatalf("Expected a ProviderError for %v, got %v", action, err)
+				}
+				if !strings.HasPrefix(err.Error(), "[libdns_netcup] "+action+" failed: ") {
+					t.Fatalf("Expected the error to name %v, got %v", action, err)
+				}
+				// the cause is still matched through the ProviderError
+				var apiErr *APIError
+				if errors.As(err, &apiErr) != (name == "netcup") {
+					t.Fatalf("Expected the APIError only for the failure of netcup, got %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestProvider_NetcupError(t *testing.T) {
+	p, server := newFakeProvider(t)
+	server.FailNext("login", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error.", LongMessage: "The login to the API failed."})
+
+	_, err := p.GetRecords(context.Background(), fakeZone)
+
+	var netcupErr *NetcupError
+	if !errors.As(err, &netcupErr) {
+		t.Fatalf("Expected a NetcupError, got %v", err)
+	}
+	expected := NetcupError{Action: "login", Status: "error", StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error.", LongMessage: "The login to the API failed.", ClientRequestID: netcupErr.ClientRequestID}
+	if !reflect.DeepEqual(*netcupErr, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, *netcupErr)
+	}
+}
+
+func TestProvider_ErrAuthFailed(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.APIPassword = "wrong"
+	server.SetCredentials("12345", "key", "password")
+
+	_, err := p.GetRecords(context.Background(), fakeZone)
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("Expected ErrAuthFailed, got %v", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected the APIError of the login, got %v", err)
+	}
+
+	// other failures are no authentication failures
+	p.APIPassword = "password"
+	server.FailNext("updateDnsRecords", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error."})
+	if _, err = p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err == nil || errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("Expected a failure other than ErrAuthFailed, got %v", err)
+	}
+}
+
+func TestProvider_SentinelErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   string
+		failures []netcuptest.Failure
+		target   error
+	}{
+		{"invalid credentials", "login", []netcuptest.Failure{{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error.", LongMessage: "The login to the API failed."}}, ErrInvalidCredentials},
+		{"zone not found", "infoDnsRecords", []netcuptest.Failure{{StatusCode: netcuptest.StatusZoneNotFound, ShortMessage: "Can not get DNS records for zone.", LongMessage: "Die Domain wurde nicht gefunden."}}, ErrZoneNotFound},
+		{"session expired", "infoDnsRecords", []netcuptest.Failure{invalidSession, invalidSession}, ErrSessionExpired},
+		{"rate limited", "login", []netcuptest.Failure{rateLimitFailure}, ErrRateLimited},
+		{"maintenance", "login", []netcuptest.Failure{{HTTPStatusCode: http.StatusServiceUnavailable, ShortMessage: "Service Unavailable"}}, ErrMaintenance},
+		{"unknown login failure", "login", []netcuptest.Failure{{StatusCode: 5000, ShortMessage: "Internal Error.", LongMessage: "The login is not possible at the moment."}}, nil},
+	}
+	targets := []error{ErrInvalidCredentials, ErrZoneNotFound, ErrSessionExpired, ErrRateLimited, ErrMaintenance}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, server := newFakeProvider(t)
+			p.RetryPolicy.MaxAttempts = 1
+			p.MaxRateLimitWait = -1
+			p.SessionIdleTimeout = -1
+			server.FailNext(test.action, test.failures...)
+
+			_, err := p.GetRecords(context.Background(), fakeZone)
+			// every failure matches its error and no other
+			for _, target := range targets {
+				if errors.Is(err, target) != (target == test.target) {
+					t.Fatalf("Expected %v to match only %v, not %v", err, test.target, target)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIError_Is(t *testing.T) {
+	tests := []struct {
+		err    *APIError
+		target error
+	}{
+		{&APIError{Action: "login", StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error."}, ErrAuthFailed},
+		{&APIError{Action: "updateDnsRecords", StatusCode: rateLimitFailure.StatusCode, ShortMessage: rateLimitFailure.ShortMessage, LongMessage: rateLimitFailure.LongMessage}, ErrRateLimited},
+		{&APIError{Action: "infoDnsRecords", StatusCode: netcuptest.StatusZoneNotFound, ShortMessage: "Can not get DNS records for zone."}, ErrZoneNotFound},
+		{&APIError{Action: "infoDnsRecords", StatusCode: netcuptest.StatusInvalidSession, ShortMessage: "The session id is not in a valid format."}, ErrSessionExpired},
+		{&APIError{Action: "updateDnsRecords", StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error."}, nil},
+		// only the status code tells a rejected login or the rate limit
+		{&APIError{Action: "login", StatusCode: 5000, ShortMessage: "Internal Error."}, nil},
+		{&APIError{Action: "login", StatusCode: 5000, ShortMessage: "Too many requests."}, nil},
+	}
+	targets := []error{ErrAuthFailed, ErrRateLimited, ErrZoneNotFound, ErrSessionExpired, ErrMaintenance}
+	for _, test := range tests {
+		// the APIError matches its error even without the wrapping of the provider
+		for _, target := range targets {
+			if errors.Is(test.err, target) != (target == test.target) {
+				t.Fatalf("Expected %+v to match only %v, not %v", test.err, test.target, target)
+			}
+		}
+	}
+}
+
+func TestProvider_MaintenancePage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><body>Wartungsarbeiten</body></html>"))
+	}))
+	defer server.Close()
+	p := &Provider{CustomerNumber: "12345", APIKey: "key", APIPassword: "password", Endpoint: server.URL, AllowInsecureEndpoint: true}
+
+	// the page doesn't tell maintenance without the HTTP status 503
+	if _, err := p.GetRecords(context.Background(), fakeZone); err == nil || errors.Is(err, ErrMaintenance) || errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("Expected a failure other than ErrMaintenance, got %v", err)
+	}
+}
+
+// newMismatchingEndpoint returns the URL of a fake endpoint, which answers every request after the login with a successful
+// response of the given action.
+func newMismatchingEndpoint(t *testing.T, action string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Action string `json:"action"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Action == "login" {
+			w.Write([]byte(`{"action":"login","status":"success","statuscode":2000,"responsedata":{"apisessionid":"session"}}`))
+			return
+		}
+		fmt.Fprintf(w, `{"action":%q,"status":"success","statuscode":2000,"responsedata":{"apisessionid":"session"}}`, action)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestProvider_ActionMismatch(t *testing.T) {
+	p := &Provider{CustomerNumber: "12345", APIKey: "key", APIPassword: "password", Endpoint: newMismatchingEndpoint(t, "login"), AllowInsecureEndpoint: true}
+
+	_, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}})
+	var mismatchErr *ActionMismatchError
+	if !errors.Is(err, ErrActionMismatch) || !errors.As(err, &mismatchErr) {
+		t.Fatalf("Expected an ActionMismatchError, got %v", err)
+	}
+	if mismatchErr.Received != "login" || (mismatchErr.Sent != "infoDnsZone" && mismatchErr.Sent != "infoDnsRecords") {
+		t.Fatalf("Unexpected mismatch %+v", mismatchErr)
+	}
+	if !strings.Contains(err.Error(), `"login"`) || !strings.Contains(err.Error(), mismatchErr.Sent) {
+		t.Fatalf("Expected both actions in the error, got %v", err)
+	}
+}
+
+func TestCheckResponseAction(t *testing.T) {
+	req := request{Action: "infoDnsRecords"}
+	for action, expectMismatch := range map[string]bool{"infoDnsRecords": false, "infodnsrecords": false, "": false, "login": true, "infoDnsZone": true} {
+		err := checkResponseAction(req, &response{Action: action})
+		if (err != nil) != expectMismatch {
+			t.Errorf("Response action %q: expected a mismatch %v, got %v", action, expectMismatch, err)
+		}
+	}
+}
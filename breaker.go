@@ -0,0 +1,96 @@
+// Circuit breaker for repeated login failures
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Defaults of the login circuit breaker
+const (
+	defaultLoginFailureLimit = 3
+	defaultLoginCooldown     = 5 * time.Minute
+)
+
+// ErrLoginBlocked is matched by a LoginBlockedError with errors.Is.
+var ErrLoginBlocked = errors.New("login blocked after repeated failures")
+
+// LoginBlockedError is returned instead of logging in, while logins are blocked after LoginFailureLimit consecutive
+// logins were rejected by netcup. netcup locks accounts after too many failed logins, so misconfigured credentials
+// must not be retried in a tight loop.
+type LoginBlockedError struct {
+	// Until is the end of the cool-down, after which the next login is attempted
+	Until time.Time
+	// Err is the error of the last failed login
+	Err error
+}
+
+func (err *LoginBlockedError) Error() string {
+	return fmt.Sprintf("%v %v until %v: %v", loggingPrefixLibdnsNetcup, ErrLoginBlocked, err.Until.Format(time.RFC3339), err.Err)
+}
+
+// Unwrap returns the error of the last failed login.
+func (err *LoginBlockedError) Unwrap() error {
+	return err.Err
+}
+
+// Is makes errors.Is(err, ErrLoginBlocked) true.
+func (err *LoginBlockedError) Is(target error) bool {
+	return target == ErrLoginBlocked
+}
+
+// loginBreaker counts consecutive login failures and blocks logins for a cool-down, when there are too many
+type loginBreaker struct {
+	failures     int
+	blockedUntil time.Time
+	lastErr      error
+}
+
+func (p *Provider) loginFailureLimit() int {
+	if p.LoginFailureLimit == 0 {
+		return defaultLoginFailureLimit
+	}
+	return p.LoginFailureLimit
+}
+
+func (p *Provider) loginCooldown() time.Duration {
+	if p.LoginCooldown <= 0 {
+		return defaultLoginCooldown
+	}
+	return p.LoginCooldown
+}
+
+// Returns a LoginBlockedError, if logins are blocked.
+func (p *Provider) checkLoginBreaker() error {
+	p.breakerMutex.Lock()
+	defer p.breakerMutex.Unlock()
+	if time.Now().Before(p.breaker.blockedUntil) {
+		return &LoginBlockedError{Until: p.breaker.blockedUntil, Err: p.breaker.lastErr}
+	}
+	return nil
+}
+
+// Records the result of a login. Only logins rejected by netcup count as failures, not network errors or canceled calls.
+// A successful login resets the breaker.
+func (p *Provider) recordLogin(ctx context.Context, err error) {
+	p.breakerMutex.Lock()
+	defer p.breakerMutex.Unlock()
+	if err == nil {
+		p.breaker = loginBreaker{}
+		return
+	}
+	if ctx.Err() != nil || !errors.Is(err, ErrAuthFailed) || p.loginFailureLimit() < 0 {
+		return
+	}
+
+	p.breaker.failures++
+	p.breaker.lastErr = err
+	if p.breaker.failures >= p.loginFailureLimit() {
+		p.breaker.blockedUntil = time.Now().Add(p.loginCooldown())
+		p.breaker.failures = 0
+		p.errorf("%v %v consecutive logins failed, blocking logins until %v", loggingPrefixLibdnsNetcup, p.loginFailureLimit(), p.breaker.blockedUntil.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,107 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// loginFailed is the failure of netcup for invalid credentials.
+var loginFailed = netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error.", LongMessage: "The login to the API failed."}
+
+func TestProvider_LoginBreaker(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.LoginFailureLimit = 2
+	p.LoginCooldown = 50 * time.Millisecond
+	ctx := context.Background()
+	server.FailNext("login", loginFailed, loginFailed)
+
+	for i := 0; i < 2; i++ {
+		var apiErr *APIError
+		if _, err := p.GetRecords(ctx, fakeZone); !errors.As(err, &apiErr) || errors.Is(err, ErrLoginBlocked) {
+			t.Fatalf("Expected the login to fail, got %v", err)
+		}
+	}
+
+	// during the cool-down logins aren't attempted
+	var blockedErr *LoginBlockedError
+	if _, err := p.GetRecords(ctx, fakeZone); !errors.As(err, &blockedErr) || !errors.Is(err, ErrLoginBlocked) {
+		t.Fatalf("Expected a LoginBlockedError, got %v", err)
+	}
+	if blockedErr.Err == nil || blockedErr.Until.IsZero() {
+		t.Fatalf("Expected the last error and the end of the cool-down, got %+v", blockedErr)
+	}
+	if count := server.CallCount("login"); count != 2 {
+		t.Fatalf("Expected no login during the cool-down, got %v logins", count)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvider_LoginBreakerResetBySuccess(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.LoginFailureLimit = 2
+	p.SessionIdleTimeout = -1
+	ctx := context.Background()
+
+	// failures separated by a successful login don't block
+	for i := 0; i < 2; i++ {
+		server.FailNext("login", loginFailed)
+		if _, err := p.GetRecords(ctx, fakeZone); err == nil {
+			t.Fatal("Expected the login to fail")
+		}
+		if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProvider_LoginBreakerIgnoresNetworkErrors(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.LoginFailureLimit = 1
+	p.RetryPolicy.MaxAttempts = 1
+	server.FailNext("login", netcuptest.Failure{HTTPStatusCode: 503, ShortMessage: "Service Unavailable"})
+
+	if _, err := p.GetRecords(context.Background(), fakeZone); err == nil || errors.Is(err, ErrLoginBlocked) {
+		t.Fatalf("Expected the HTTP error, got %v", err)
+	}
+	if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvider_LoginBreakerIgnoresUnknownLoginFailures(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.LoginFailureLimit = 1
+	p.RetryPolicy.MaxAttempts = 1
+	// a temporary rejection of the login, whose status code isn't the one of wrong credentials
+	server.FailNext("login", netcuptest.Failure{StatusCode: 5000, ShortMessage: "Internal Error.", LongMessage: "The login is not possible at the moment."})
+
+	if _, err := p.GetRecords(context.Background(), fakeZone); err == nil || errors.Is(err, ErrAuthFailed) || errors.Is(err, ErrLoginBlocked) {
+		t.Fatalf("Expected the failure of the login, got %v", err)
+	}
+	if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvider_LoginBreakerDisabled(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.LoginFailureLimit = -1
+	server.FailNext("login", loginFailed, loginFailed, loginFailed, loginFailed)
+
+	for i := 0; i < 4; i++ {
+		if _, err := p.GetRecords(context.Background(), fakeZone); errors.Is(err, ErrLoginBlocked) {
+			t.Fatalf("Expected logins not to be blocked, got %v", err)
+		}
+	}
+	if count := server.CallCount("login"); count != 4 {
+		t.Fatalf("Expected every login to be attempted, got %v logins", count)
+	}
+}
@@ -0,0 +1,76 @@
+// Client request IDs for the correlation of requests with netcup
+
+package netcup
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrClientRequestIDMismatch is matched by a ClientRequestIDMismatchError with errors.Is.
+var ErrClientRequestIDMismatch = errors.New("client request ID mismatch")
+
+// ClientRequestIDMismatchError is returned, if netcup echoes another client request ID than the one sent with the request.
+// The response belongs to another request, for example because of a misbehaving proxy, so it is discarded.
+type ClientRequestIDMismatchError struct {
+	// Action is the API action of the request
+	Action string
+	// Sent is the client request ID of the request
+	Sent string
+	// Received is the client request ID of the response
+	Received string
+}
+
+func (err *ClientRequestIDMismatchError) Error() string {
+	return fmt.Sprintf("%v %v for %v: sent %q, received %q", loggingPrefixLibdnsNetcup, ErrClientRequestIDMismatch, err.Action, err.Sent, err.Received)
+}
+
+// Is makes errors.Is(err, ErrClientRequestIDMismatch) true.
+func (err *ClientRequestIDMismatchError) Is(target error) bool {
+	return target == ErrClientRequestIDMismatch
+}
+
+// clientRequestIDKey is the context key for the client request ID of an operation, which starts the IDs of its requests
+type clientRequestIDKey struct{}
+
+// Returns a random hex string of the given number of bytes, or an empty string, if there is no randomness.
+func randomID(length int) string {
+	id := make([]byte, length)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// Returns a context with a new client request ID for the requests of an operation and the ID.
+// The ID starts with ClientRequestIDPrefix.
+func (p *Provider) withClientRequestID(ctx context.Context) (context.Context, string) {
+	id := randomID(8)
+	if id == "" {
+		return ctx, ""
+	}
+	clientRequestID := p.ClientRequestIDPrefix + id
+
+	return context.WithValue(ctx, clientRequestIDKey{}, clientRequestID), clientRequestID
+}
+
+// Returns a new client request ID for a single request: the client request ID of the operation in the context,
+// followed by a part unique to the request, or ClientRequestIDPrefix and a random ID outside of operations.
+func (p *Provider) newClientRequestID(ctx context.Context) string {
+	if operationID, ok := ctx.Value(clientRequestIDKey{}).(string); ok {
+		return operationID + "-" + randomID(4)
+	}
+	return p.ClientRequestIDPrefix + randomID(8)
+}
+
+// Returns a ClientRequestIDMismatchError, if the response echoes another client request ID than the one of the request.
+// Responses without client request ID are accepted.
+func checkClientRequestID(req request, res *response) error {
+	if res.ClientRequestID == "" || res.ClientRequestID == req.Param.ClientRequestID {
+		return nil
+	}
+	return &ClientRequestIDMismatchError{Action: req.Action, Sent: req.Param.ClientRequestID, Received: res.ClientRequestID}
+}
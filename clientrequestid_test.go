@@ -0,0 +1,81 @@
+package netcup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// sentClientRequestIDs returns the client request IDs of the requests received by the server, of all requests,
+// if action is empty.
+func sentClientRequestIDs(server *netcuptest.Server, action string) []string {
+	var ids []string
+	for _, call := range server.Calls() {
+		if action != "" && call.Action != action {
+			continue
+		}
+		var param struct {
+			ClientRequestID string `json:"clientrequestid"`
+		}
+		json.Unmarshal(call.Param, &param)
+		ids = append(ids, param.ClientRequestID)
+	}
+	return ids
+}
+
+func TestProvider_ClientRequestIDs(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.ClientRequestIDPrefix = "host1-"
+	p.RetryPolicy = RetryPolicy{BaseDelay: time.Millisecond}
+	server.FailNext("infoDnsRecords", netcuptest.Failure{HTTPStatusCode: 503, ShortMessage: "Service Unavailable"})
+
+	if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	// every request, including the retry, has its own ID
+	ids := sentClientRequestIDs(server, "")
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if !strings.HasPrefix(id, "host1-") || seen[id] {
+			t.Fatalf("Expected unique client request IDs with the prefix, got %v", ids)
+		}
+		seen[id] = true
+	}
+}
+
+func TestProvider_ClientRequestIDInErrors(t *testing.T) {
+	p, server := newFakeProvider(t)
+	server.FailNext("infoDnsRecords", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error.", LongMessage: "Unknown problem."})
+
+	_, err := p.GetRecords(context.Background(), fakeZone)
+	ids := sentClientRequestIDs(server, "infoDnsRecords")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || len(ids) != 1 || apiErr.ClientRequestID != ids[0] || !strings.Contains(err.Error(), ids[0]) {
+		t.Fatalf("Expected the client request ID %v of the failed request in the error, got %v", ids, err)
+	}
+}
+
+func TestProvider_ClientRequestIDMismatch(t *testing.T) {
+	// a proxy answering with the response to another request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"clientrequestid":"other","action":"login","status":"success","statuscode":2000,"responsedata":{"apisessionid":"session"}}`))
+	}))
+	defer server.Close()
+	p := &Provider{CustomerNumber: "12345", APIKey: "key", APIPassword: "password", Endpoint: server.URL, AllowInsecureEndpoint: true}
+
+	_, err := p.GetRecords(context.Background(), fakeZone)
+	var mismatchErr *ClientRequestIDMismatchError
+	if !errors.Is(err, ErrClientRequestIDMismatch) || !errors.As(err, &mismatchErr) {
+		t.Fatalf("Expected a ClientRequestIDMismatchError, got %v", err)
+	}
+	if mismatchErr.Action != "login" || mismatchErr.Sent == "" || mismatchErr.Received != "other" {
+		t.Fatalf("Unexpected mismatch %+v", mismatchErr)
+	}
+}
@@ -0,0 +1,100 @@
+// netcup-ddns keeps the A and AAAA records of a name at netcup pointed at the current public addresses of the host.
+//
+// The credentials are read from the environment variables NETCUP_CUSTOMER_NUMBER, NETCUP_API_KEY and NETCUP_API_PASSWORD.
+//
+//	netcup-ddns -zone example.com -name home -ipv4 https://api.ipify.org -ipv6 interface:eth0
+//
+// Address sources are "interface:<name>", "stun:<host:port>", an HTTP(S) URL of an echo service, that answers with
+// the address as plain text, or "none". On SIGINT or SIGTERM a running update is completed before the daemon exits.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	netcup "github.com/wizardrix/libdns_netcup"
+)
+
+func main() {
+	zone := flag.String("zone", "", "zone of the records, like example.com")
+	name := flag.String("name", "@", "name of the records relative to the zone")
+	ipv4 := flag.String("ipv4", "https://api.ipify.org", "source of the IPv4 address or \"none\"")
+	ipv6 := flag.String("ipv6", "none", "source of the IPv6 address or \"none\"")
+	interval := flag.Duration("interval", 5*time.Minute, "interval between the checks of the addresses")
+	dryRun := flag.Bool("dry-run", false, "only log the changes instead of updating the records")
+	once := flag.Bool("once", false, "check the addresses once and exit")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	if err := run(*zone, *name, *ipv4, *ipv6, *interval, *dryRun, *once, logger); err != nil {
+		logger.Printf("level=error msg=%q", err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(zone, name, ipv4, ipv6 string, interval time.Duration, dryRun, once bool, logger *log.Logger) error {
+	if zone == "" {
+		return fmt.Errorf("-zone is required")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("-interval must be positive")
+	}
+
+	provider, err := netcup.NewFromEnv()
+	if err != nil {
+		return err
+	}
+
+	u := &updater{provider: provider, zone: zone, name: name, dryRun: dryRun, logger: logger, sources: make(map[string]ipSource)}
+	provider.OnProgress = func(progress netcup.Progress) {
+		u.log("debug", "progress", "operation", progress.Operation, "zone", progress.Zone, "phase", progress.Phase,
+			"records", fmt.Sprintf("%v/%v", progress.RecordsDone, progress.RecordsTotal))
+	}
+	for recType, spec := range map[string]string{"A": ipv4, "AAAA": ipv6} {
+		source, err := parseSource(spec, recType == "AAAA")
+		if err != nil {
+			return err
+		}
+		if source != nil {
+			u.sources[recType] = source
+		}
+	}
+	if len(u.sources) == 0 {
+		return fmt.Errorf("no address source configured")
+	}
+
+	if once {
+		// the session is logged out also if the check fails, the error of the check is returned
+		defer func() {
+			if err := closeProvider(provider); err != nil {
+				u.log("warn", "closing the provider failed", "error", err)
+			}
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		defer cancel()
+		return u.reconcile(ctx)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := provider.Validate(ctx); err != nil {
+		return err
+	}
+	u.log("info", "starting", "zone", zone, "name", name, "interval", interval, "dry_run", dryRun)
+	u.run(ctx, interval)
+
+	return closeProvider(provider)
+}
+
+// Closes the provider, which logs out its session, after the pending requests, but at most for 10 seconds.
+func closeProvider(provider *netcup.Provider) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return provider.Close(ctx)
+}
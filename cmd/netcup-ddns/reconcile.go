@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// recordProvider is the part of the provider API used by the updater
+type recordProvider interface {
+	libdns.RecordGetter
+	libdns.RecordSetter
+}
+
+// updater keeps the address records of one name up to date with the current addresses.
+type updater struct {
+	provider recordProvider
+	zone     string
+	// name of the address records relative to the zone, "@" for the apex
+	name string
+	// sources per record type, "A" and "AAAA"
+	sources map[string]ipSource
+	dryRun  bool
+	logger  *log.Logger
+
+	// the address in DNS per record type, as known from the last reconcile
+	known map[string]string
+}
+
+// Runs reconcile every interval, until ctx is done. A reconcile, that is running when ctx is done, is completed.
+func (u *updater) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// the reconcile isn't canceled with ctx, so no update is interrupted on shutdown
+		reconcileCtx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := u.reconcile(reconcileCtx); err != nil {
+			u.log("error", "reconcile failed", "error", err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			u.log("info", "stopping")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Determines the current addresses and updates the records, whose address changed. If the address is the same as
+// on the last reconcile, nothing is sent to netcup. Otherwise the records are read first, so they are only written,
+// if they really differ.
+func (u *updater) reconcile(ctx context.Context) error {
+	if u.known == nil {
+		u.known = make(map[string]string)
+	}
+
+	var errs []string
+	for _, recType := range []string{"A", "AAAA"} {
+		source := u.sources[recType]
+		if source == nil {
+			continue
+		}
+		if err := u.reconcileType(ctx, recType, source); err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", recType, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (u *updater) reconcileType(ctx context.Context, recType string, source ipSource) error {
+	ip, err := source.Address(ctx)
+	if err != nil {
+		return fmt.Errorf("determining the address: %w", err)
+	}
+	address := ip.String()
+	if u.known[recType] == address {
+		u.log("debug", "address unchanged", "type", recType, "address", address)
+		return nil
+	}
+
+	records, err := u.provider.GetRecords(ctx, u.zone)
+	if err != nil {
+		return fmt.Errorf("reading the records: %w", err)
+	}
+	var current []string
+	for _, record := range records {
+		if strings.EqualFold(record.Type, recType) && strings.EqualFold(normalizeName(record.Name), normalizeName(u.name)) {
+			current = append(current, record.Value)
+		}
+	}
+	if len(current) == 1 && current[0] == address {
+		u.log("info", "record already up to date", "type", recType, "name", u.name, "address", address)
+		u.known[recType] = address
+		return nil
+	}
+
+	if u.dryRun {
+		u.log("info", "would update record", "type", recType, "name", u.name, "old", strings.Join(current, ","), "new", address)
+		return nil
+	}
+	if _, err := u.provider.SetRecords(ctx, u.zone, []libdns.Record{{Type: recType, Name: u.name, Value: address}}); err != nil {
+		return fmt.Errorf("updating the record: %w", err)
+	}
+	u.log("info", "updated record", "type", recType, "name", u.name, "old", strings.Join(current, ","), "new", address)
+	u.known[recType] = address
+	return nil
+}
+
+func normalizeName(name string) string {
+	if name == "" {
+		return "@"
+	}
+	return name
+}
+
+// Logs a message in logfmt with the level and the key value pairs.
+func (u *updater) log(level string, message string, keyValues ...interface{}) {
+	if u.logger == nil {
+		return
+	}
+	var line strings.Builder
+	fmt.Fprintf(&line, "level=%v msg=%q", level, message)
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		fmt.Fprintf(&line, " %v=%q", keyValues[i], fmt.Sprint(keyValues[i+1]))
+	}
+	u.logger.Print(line.String())
+}
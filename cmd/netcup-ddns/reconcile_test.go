@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	netcup "github.com/wizardrix/libdns_netcup"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+const testZone = "example.com"
+
+// stubSource returns the address set with set.
+type stubSource struct {
+	mutex sync.Mutex
+	ip    net.IP
+}
+
+func (source *stubSource) set(address string) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	source.ip = net.ParseIP(address)
+}
+
+func (source *stubSource) Address(ctx context.Context) (net.IP, error) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	return source.ip, nil
+}
+
+func newTestUpdater(t *testing.T, records ...netcuptest.Record) (*updater, *stubSource, *netcuptest.Server, *bytes.Buffer) {
+	server := netcuptest.NewServer()
+	server.AddZone(testZone, 300, records...)
+	t.Cleanup(server.Close)
+
+	source := &stubSource{}
+	var logs bytes.Buffer
+	u := &updater{
+		provider: &netcup.Provider{CustomerNumber: "12345", APIKey: "key", APIPassword: "password", Endpoint: server.URL, AllowInsecureEndpoint: true},
+		zone:     testZone,
+		name:     "home",
+		sources:  map[string]ipSource{"A": source},
+		logger:   log.New(&logs, "", 0),
+	}
+	return u, source, server, &logs
+}
+
+func homeAddresses(server *netcuptest.Server) []string {
+	var addresses []string
+	for _, record := range server.Records(testZone) {
+		if record.HostName == "home" && record.Type == "A" {
+			addresses = append(addresses, record.Destination)
+		}
+	}
+	return addresses
+}
+
+func TestReconcile(t *testing.T) {
+	u, source, server, logs := newTestUpdater(t, netcuptest.Record{HostName: "home", Type: "A", Destination: "192.0.2.1"})
+	ctx := context.Background()
+
+	source.set("192.0.2.2")
+	if err := u.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if addresses := homeAddresses(server); len(addresses) != 1 || addresses[0] != "192.0.2.2" {
+		t.Fatalf("Expected the record to be updated to 192.0.2.2, got %v", addresses)
+	}
+	if !strings.Contains(logs.String(), `level=info msg="updated record" type="A" name="home" old="192.0.2.1" new="192.0.2.2"`) {
+		t.Fatalf("Expected the update to be logged, got %v", logs)
+	}
+
+	// the address didn't change, so netcup isn't even asked
+	server.ResetCalls()
+	if err := u.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if calls := server.Calls(); len(calls) != 0 {
+		t.Fatalf("Expected no API calls for an unchanged address, got %v", server.Actions())
+	}
+
+	source.set("192.0.2.3")
+	if err := u.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if addresses := homeAddresses(server); len(addresses) != 1 || addresses[0] != "192.0.2.3" {
+		t.Fatalf("Expected the record to be updated to 192.0.2.3, got %v", addresses)
+	}
+}
+
+func TestReconcileRecordAlreadyUpToDate(t *testing.T) {
+	u, source, server, _ := newTestUpdater(t, netcuptest.Record{HostName: "home", Type: "A", Destination: "192.0.2.1"})
+
+	source.set("192.0.2.1")
+	if err := u.reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.CallCount("updateDnsRecords"); count != 0 {
+		t.Fatalf("Expected no update for a record with the current address, got %v", count)
+	}
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	u, source, server, logs := newTestUpdater(t)
+	u.dryRun = true
+
+	source.set("192.0.2.1")
+	if err := u.reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.CallCount("updateDnsRecords"); count != 0 {
+		t.Fatalf("Expected no update in dry run mode, got %v", count)
+	}
+	if !strings.Contains(logs.String(), `msg="would update record"`) {
+		t.Fatalf("Expected the update to be logged, got %v", logs)
+	}
+}
+
+func TestRunStopsGracefully(t *testing.T) {
+	u, source, server, logs := newTestUpdater(t)
+	source.set("192.0.2.1")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stopped := make(chan struct{})
+	go func() {
+		u.run(ctx, 10*time.Millisecond)
+		close(stopped)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(homeAddresses(server)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run didn't stop")
+	}
+
+	if addresses := homeAddresses(server); len(addresses) != 1 || addresses[0] != "192.0.2.1" {
+		t.Fatalf("Expected the record to be created, got %v", addresses)
+	}
+	if !strings.Contains(logs.String(), `msg="stopping"`) {
+		t.Fatalf("Expected the shutdown to be logged, got %v", logs)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ipSource determines the current public address of one IP family.
+type ipSource interface {
+	Address(ctx context.Context) (net.IP, error)
+}
+
+// Returns the source described by spec for IPv4 or IPv6 addresses. spec is one of
+// "interface:<name>", "stun:<host:port>" and "https:<url>" (or "http:<url>"); "none" disables the family.
+func parseSource(spec string, ipv6 bool) (ipSource, error) {
+	kind, argument := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, argument = spec[:i], spec[i+1:]
+	}
+
+	switch kind {
+	case "none", "":
+		return nil, nil
+	case "interface":
+		return &interfaceSource{name: argument, ipv6: ipv6}, nil
+	case "stun":
+		return &stunSource{server: argument, ipv6: ipv6}, nil
+	case "https", "http":
+		return &httpSource{url: spec, ipv6: ipv6}, nil
+	}
+	return nil, fmt.Errorf("unknown address source %q", spec)
+}
+
+// Checks, if the address belongs to the family of the source.
+func matchesFamily(ip net.IP, ipv6 bool) bool {
+	return ip != nil && (ip.To4() == nil) == ipv6
+}
+
+// interfaceSource takes the first global unicast address of a network interface, for hosts with a public address.
+type interfaceSource struct {
+	name string
+	ipv6 bool
+}
+
+func (source *interfaceSource) Address(ctx context.Context) (net.IP, error) {
+	iface, err := net.InterfaceByName(source.name)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, address := range addresses {
+		ipNet, ok := address.(*net.IPNet)
+		if ok && matchesFamily(ipNet.IP, source.ipv6) && ipNet.IP.IsGlobalUnicast() && !ipNet.IP.IsPrivate() {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("no public address on interface %v", source.name)
+}
+
+// httpSource asks an echo service, that answers with the address of the client as plain text, like https://api.ipify.org.
+type httpSource struct {
+	url  string
+	ipv6 bool
+}
+
+// httpSourceClient is separate from the client of the provider, which sends the requests to the netcup API
+var httpSourceClient = &http.Client{Timeout: 10 * time.Second}
+
+func (source *httpSource) Address(ctx context.Context) (net.IP, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", source.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpSourceClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v from %v", resp.Status, source.url)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if !matchesFamily(ip, source.ipv6) {
+		return nil, fmt.Errorf("%v returned no address of the expected family: %q", source.url, body)
+	}
+	return ip, nil
+}
+
+// stunSource asks a STUN server (RFC 5389) for the mapped address of the client.
+type stunSource struct {
+	server string
+	ipv6   bool
+}
+
+const (
+	stunBindingRequest   = 0x0001
+	stunBindingSuccess   = 0x0101
+	stunMagicCookie      = 0x2112A442
+	stunMappedAddress    = 0x0001
+	stunXORMappedAddress = 0x0020
+)
+
+func (source *stunSource) Address(ctx context.Context) (net.IP, error) {
+	network := "udp4"
+	if source.ipv6 {
+		network = "udp6"
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, source.server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	request := make([]byte, 20)
+	binary.BigEndian.PutUint16(request[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:], stunMagicCookie)
+	if _, err := rand.Read(request[8:20]); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, 1024)
+	n, err := conn.Read(response)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := parseSTUNResponse(response[:n], request[8:20])
+	if err != nil {
+		return nil, err
+	}
+	if !matchesFamily(ip, source.ipv6) {
+		return nil, fmt.Errorf("STUN server %v returned no address of the expected family: %v", source.server, ip)
+	}
+	return ip, nil
+}
+
+// Returns the (XOR-)MAPPED-ADDRESS of a binding response with the given transaction ID.
+func parseSTUNResponse(response []byte, transactionID []byte) (net.IP, error) {
+	if len(response) < 20 || binary.BigEndian.Uint16(response[0:]) != stunBindingSuccess ||
+		binary.BigEndian.Uint32(response[4:]) != stunMagicCookie || !bytes.Equal(response[8:20], transactionID) {
+		return nil, errors.New("invalid STUN response")
+	}
+
+	var mappedAddress net.IP
+	attributes := response[20:]
+	for len(attributes) >= 4 {
+		attributeType := binary.BigEndian.Uint16(attributes[0:])
+		length := int(binary.BigEndian.Uint16(attributes[2:]))
+		if len(attributes) < 4+length {
+			break
+		}
+		value := attributes[4 : 4+length]
+		// attributes are padded to multiples of 4 bytes
+		if next := 4 + (length+3)/4*4; next < len(attributes) {
+			attributes = attributes[next:]
+		} else {
+			attributes = nil
+		}
+
+		if (attributeType != stunXORMappedAddress && attributeType != stunMappedAddress) || len(value) < 8 {
+			continue
+		}
+		var ip net.IP
+		switch {
+		case value[1] == 0x01 && len(value) >= 8:
+			ip = append(net.IP(nil), value[4:8]...)
+		case value[1] == 0x02 && len(value) >= 20:
+			ip = append(net.IP(nil), value[4:20]...)
+		default:
+			continue
+		}
+		if attributeType == stunXORMappedAddress {
+			// the address is XORed with the magic cookie followed by the transaction ID
+			key := append(append([]byte(nil), response[4:8]...), transactionID...)
+			for i := range ip {
+				ip[i] ^= key[i]
+			}
+			return ip, nil
+		}
+		mappedAddress = ip
+	}
+
+	if mappedAddress == nil {
+		return nil, errors.New("no mapped address in STUN response")
+	}
+	return mappedAddress, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"none", "<nil>"},
+		{"interface:eth0", "*main.interfaceSource"},
+		{"stun:stun.example.net:3478", "*main.stunSource"},
+		{"https://api.ipify.org", "*main.httpSource"},
+	}
+	for _, tt := range tests {
+		source, err := parseSource(tt.spec, false)
+		if err != nil || fmt.Sprintf("%T", source) != tt.expected {
+			t.Fatalf("Expected %v for %q, got %T, %v", tt.expected, tt.spec, source, err)
+		}
+	}
+	if _, err := parseSource("carrier-pigeon", false); err == nil {
+		t.Fatal("Expected an unknown source to fail")
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "192.0.2.7")
+	}))
+	defer echo.Close()
+
+	ip, err := (&httpSource{url: echo.URL}).Address(context.Background())
+	if err != nil || ip.String() != "192.0.2.7" {
+		t.Fatalf("Expected 192.0.2.7, got %v, %v", ip, err)
+	}
+	if _, err := (&httpSource{url: echo.URL, ipv6: true}).Address(context.Background()); err == nil {
+		t.Fatal("Expected an IPv4 address to be rejected for IPv6")
+	}
+}
+
+func TestSTUNSource(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// answers binding requests with the XOR-MAPPED-ADDRESS 192.0.2.9:4242
+	go func() {
+		request := make([]byte, 1024)
+		n, addr, err := conn.ReadFrom(request)
+		if err != nil || n < 20 {
+			return
+		}
+		response := make([]byte, 32)
+		binary.BigEndian.PutUint16(response[0:], stunBindingSuccess)
+		binary.BigEndian.PutUint16(response[2:], 12)
+		copy(response[4:20], request[4:20])
+		binary.BigEndian.PutUint16(response[20:], stunXORMappedAddress)
+		binary.BigEndian.PutUint16(response[22:], 8)
+		response[25] = 0x01
+		binary.BigEndian.PutUint16(response[26:], 4242^uint16(stunMagicCookie>>16))
+		ip := net.ParseIP("192.0.2.9").To4()
+		for i := range ip {
+			response[28+i] = ip[i] ^ request[4+i]
+		}
+		conn.WriteTo(response, addr)
+	}()
+
+	ip, err := (&stunSource{server: conn.LocalAddr().String()}).Address(context.Background())
+	if err != nil || ip.String() != "192.0.2.9" {
+		t.Fatalf("Expected 192.0.2.9, got %v, %v", ip, err)
+	}
+}
+
+func TestParseSTUNResponseRejectsOtherTransactions(t *testing.T) {
+	response := make([]byte, 20)
+	binary.BigEndian.PutUint16(response[0:], stunBindingSuccess)
+	binary.BigEndian.PutUint32(response[4:], stunMagicCookie)
+	if _, err := parseSTUNResponse(response, bytes.Repeat([]byte{1}, 12)); err == nil {
+		t.Fatal("Expected a response to another transaction to be rejected")
+	}
+}
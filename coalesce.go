@@ -0,0 +1,223 @@
+// Coalescing of AppendRecords and DeleteRecords calls to the same zone
+
+package netcup
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// pendingIDPrefix marks the IDs of records, that are appended in a coalesced batch, but not sent to netcup yet
+const pendingIDPrefix = "pending-"
+
+// coalescedCall is an AppendRecords or DeleteRecords call waiting for its batch to be applied
+type coalescedCall struct {
+	ctx     context.Context
+	delete  bool
+	records []dnsRecord
+	// the records appended or deleted for this call
+	changed []dnsRecord
+	result  []libdns.Record
+	err     error
+}
+
+// coalescedBatch collects the calls to one zone during the coalesce window
+type coalescedBatch struct {
+	calls []*coalescedCall
+	// closed, when the batch is applied and the results of all calls are set
+	done chan struct{}
+}
+
+// Adds the call to the batch of the zone, opening a new batch if there is none, and waits for the result.
+// If the context is done before, the call returns, but its changes are still applied with the batch.
+func (p *Provider) coalesce(ctx context.Context, zone string, deleteRecords bool, records []libdns.Record) ([]libdns.Record, error) {
+	call := &coalescedCall{ctx: ctx, delete: deleteRecords, records: toNetcupRecords(zone, records)}
+	key := normalizeZone(zone)
+
+	p.batchesMutex.Lock()
+	batch, found := p.batches[key]
+	if !found {
+		batch = &coalescedBatch{done: make(chan struct{})}
+		if p.batches == nil {
+			p.batches = make(map[string]*coalescedBatch)
+		}
+		p.batches[key] = batch
+		go p.runBatch(zone, key, batch)
+	}
+	batch.calls = append(batch.calls, call)
+	p.batchesMutex.Unlock()
+
+	select {
+	case <-batch.done:
+		return call.result, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Waits for the end of the coalesce window and applies the batch.
+func (p *Provider) runBatch(zone string, key string, batch *coalescedBatch) {
+	after := p.after
+	if after == nil {
+		after = time.After
+	}
+	<-after(p.CoalesceWindow)
+
+	// calls arriving from now on open a new batch
+	p.batchesMutex.Lock()
+	delete(p.batches, key)
+	calls := batch.calls
+	p.batchesMutex.Unlock()
+
+	p.applyBatch(zone, calls)
+	close(batch.done)
+}
+
+// Applies the calls of a batch with one session and one update. The calls are applied in the order they were made,
+// each one to the zone as it is after the calls before. The result or error of each call is set in the call.
+func (p *Provider) applyBatch(zone string, calls []*coalescedCall) {
+	var batchErr error
+	fail := func(err error) {
+		batchErr = err
+		for _, call := range calls {
+			if call.err == nil {
+				call.err = err
+			}
+		}
+	}
+
+	// the batch is limited like the calls by OperationTimeout, but not by their contexts
+	ctx, cancel := p.withOperationTimeout(context.Background())
+	defer cancel()
+	ctx, _ = p.withClientRequestID(ctx)
+	ctx, stats := p.startStats(ctx, "batch", zone)
+	defer func() { stats.finish(batchErr) }()
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer unlock()
+
+	ctx = p.withCustomer(ctx, zone)
+	apiSessionID, err := p.login(ctx)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer p.logout(ctx, apiSessionID)
+
+	shortZone := unFQDN(zone)
+	dnsZone, existingRecordSet, err := p.getZoneAndRecords(ctx, shortZone, apiSessionID, true, false)
+	if err != nil {
+		fail(err)
+		return
+	}
+	ttl := p.zoneTTL(dnsZone)
+
+	// the zone as it will be after the calls so far, records to append get pending IDs, so later calls can delete them
+	currentRecords := append([]dnsRecord(nil), existingRecordSet.DnsRecords...)
+	var recordsToAppend []dnsRecord
+	var recordsToDelete []dnsRecord
+	pendingIDs := 0
+	for _, call := range calls {
+		policy := p.matchPolicy(call.ctx)
+		if !call.delete {
+			for _, record := range getRecordsToAppend(call.records, currentRecords, policy) {
+				pendingIDs++
+				record.ID = pendingIDPrefix + strconv.Itoa(pendingIDs)
+				recordsToAppend = append(recordsToAppend, record)
+				currentRecords = append(currentRecords, record)
+				call.changed = append(call.changed, record)
+			}
+			continue
+		}
+
+		deletions, err := getRecordsToDelete(call.records, currentRecords, policy)
+		if err == nil {
+			err = p.checkDeleteThreshold(call.ctx, shortZone, deletions, len(existingRecordSet.DnsRecords), ttl)
+		}
+		if err != nil {
+			call.err = err
+			continue
+		}
+		for _, record := range deletions {
+			currentRecords = removeRecordByID(record.ID, currentRecords)
+			call.changed = append(call.changed, record)
+			// a record appended in this batch is just not appended
+			if findRecordByID(record.ID, recordsToAppend) != nil {
+				recordsToAppend = removeRecordByID(record.ID, recordsToAppend)
+			} else {
+				recordsToDelete = append(recordsToDelete, record)
+			}
+		}
+	}
+
+	updates := append([]dnsRecord(nil), recordsToDelete...)
+	for _, record := range recordsToAppend {
+		record.ID = ""
+		updates = append(updates, record)
+	}
+	var readRecords []dnsRecord
+	if len(updates) > 0 {
+		updatedRecordSet, err := p.updateDNSRecords(ctx, shortZone, dnsRecordSet{DnsRecords: updates}, apiSessionID)
+		if err != nil {
+			fail(err)
+			return
+		}
+		p.notifyWebhook(ctx, shortZone, "batch", existingRecordSet.DnsRecords, updatedRecordSet.DnsRecords, ttl)
+		p.recordChange(ctx, shortZone, "batch", existingRecordSet.DnsRecords, updatedRecordSet.DnsRecords, ttl)
+		p.notifyChange(ctx, shortZone, "batch", existingRecordSet.DnsRecords, updatedRecordSet.DnsRecords, ttl)
+	}
+	// like after other appends, the records are read again for the IDs assigned by netcup
+	if len(recordsToAppend) > 0 {
+		currentRecordSet, err := p.infoDNSRecords(ctx, shortZone, apiSessionID)
+		if err != nil {
+			fail(err)
+			return
+		}
+		readRecords = currentRecordSet.DnsRecords
+	}
+
+	// the appended records get the IDs assigned by netcup, records appended and deleted in the batch have no ID
+	for _, call := range calls {
+		if call.err != nil {
+			continue
+		}
+		var appended []dnsRecord
+		for _, record := range call.changed {
+			if isPendingID(record.ID) && findRecordByID(record.ID, recordsToAppend) != nil {
+				record.ID = ""
+				appended = append(appended, record)
+			}
+		}
+		resolved, err := resolveRecordIDs(appended, existingRecordSet.DnsRecords, readRecords)
+		if err != nil {
+			call.err = err
+			continue
+		}
+
+		result := []libdns.Record{}
+		for _, record := range call.changed {
+			if isPendingID(record.ID) {
+				if findRecordByID(record.ID, recordsToAppend) != nil {
+					record, resolved = resolved[0], resolved[1:]
+				} else {
+					record.ID = ""
+				}
+			}
+			record.DeleteRecord = false
+			result = append(result, toLibdnsRecords([]dnsRecord{record}, ttl)...)
+		}
+		call.result = result
+	}
+}
+
+func isPendingID(id string) bool {
+	return strings.HasPrefix(id, pendingIDPrefix)
+}
@@ -0,0 +1,216 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// newCoalescingProvider returns a provider with a coalesce window, that only closes, when the returned function is called
+// after the given number of calls joined the window.
+func newCoalescingProvider(t *testing.T, records ...netcuptest.Record) (*Provider, *netcuptest.Server, func(calls int)) {
+	p, server := newFakeProvider(t, records...)
+	p.CoalesceWindow = time.Minute
+	window := make(chan time.Time)
+	p.after = func(d time.Duration) <-chan time.Time {
+		if d != time.Minute {
+			t.Errorf("Expected the coalesce window of 1m, got %v", d)
+		}
+		return window
+	}
+
+	closeWindow := func(calls int) {
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			p.batchesMutex.Lock()
+			batch := p.batches[fakeZone]
+			joined := batch != nil && len(batch.calls) == calls
+			p.batchesMutex.Unlock()
+			if joined {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %v calls in the coalesce window", calls)
+			}
+		}
+		window <- time.Now()
+	}
+
+	return p, server, closeWindow
+}
+
+func TestProvider_CoalesceAppends(t *testing.T) {
+	p, server, closeWindow := newCoalescingProvider(t)
+	const calls = 10
+
+	results := make([][]libdns.Record, calls)
+	errs := make([]error, calls)
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			record := libdns.Record{Type: "TXT", Name: "_acme-challenge", Value: fmt.Sprintf("token%d", i)}
+			results[i], errs[i] = p.AppendRecords(context.Background(), fakeZone, []libdns.Record{record})
+		}()
+	}
+	closeWindow(calls)
+	wg.Wait()
+
+	for _, action := range []string{"login", "updateDnsRecords"} {
+		if count := server.CallCount(action); count != 1 {
+			t.Fatalf("Expected one %v for %v coalesced calls, got %v", action, calls, count)
+		}
+	}
+	ids := make(map[string]bool)
+	for i := 0; i < calls; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if len(results[i]) != 1 || results[i][0].Value != fmt.Sprintf("token%d", i) || results[i][0].ID == "" || ids[results[i][0].ID] {
+			t.Fatalf("Expected the appended record of call %v with its own ID, got %+v", i, results[i])
+		}
+		ids[results[i][0].ID] = true
+	}
+	if records := server.Records(fakeZone); len(records) != calls {
+		t.Fatalf("Expected %v records, got %v", calls, len(records))
+	}
+}
+
+func TestProvider_CoalesceAppendAndDelete(t *testing.T) {
+	p, server, closeWindow := newCoalescingProvider(t, netcuptest.Record{HostName: "old", Type: "TXT", Destination: "old"})
+
+	type result struct {
+		records []libdns.Record
+		err     error
+	}
+	appended := make(chan result)
+	deleted := make(chan result)
+	go func() {
+		records, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "new", Value: "new"}})
+		appended <- result{records, err}
+	}()
+	// the calls are applied in the order they joined the window
+	for {
+		p.batchesMutex.Lock()
+		joined := p.batches[fakeZone] != nil
+		p.batchesMutex.Unlock()
+		if joined {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		records, err := p.DeleteRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "old"}, {Type: "TXT", Name: "new"}})
+		deleted <- result{records, err}
+	}()
+	closeWindow(2)
+
+	appendResult, deleteResult := <-appended, <-deleted
+	if appendResult.err != nil || deleteResult.err != nil {
+		t.Fatalf("Unexpected errors %v and %v", appendResult.err, deleteResult.err)
+	}
+	// the appended record is deleted in the same window, so it never reaches netcup
+	if len(appendResult.records) != 1 || appendResult.records[0].ID != "" {
+		t.Fatalf("Expected the appended record without ID, got %+v", appendResult.records)
+	}
+	if len(deleteResult.records) != 2 {
+		t.Fatalf("Expected both deleted records, got %+v", deleteResult.records)
+	}
+	if records := server.Records(fakeZone); len(records) != 0 {
+		t.Fatalf("Expected an empty zone, got %+v", records)
+	}
+	if count := server.CallCount("updateDnsRecords"); count != 1 {
+		t.Fatalf("Expected one update, got %v", count)
+	}
+}
+
+func TestProvider_CoalesceErrorFanOut(t *testing.T) {
+	p, server, closeWindow := newCoalescingProvider(t, netcuptest.Record{HostName: "www", Type: "A", Destination: "192.0.2.1"}, netcuptest.Record{HostName: "www", Type: "A", Destination: "192.0.2.2"})
+	server.FailNext("updateDnsRecords", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error."})
+
+	errs := make(chan error, 3)
+	for i := 0; i < 2; i++ {
+		i := i
+		go func() {
+			_, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: fmt.Sprintf("token%d", i)}})
+			errs <- err
+		}()
+	}
+	// this call fails on its own, without affecting the others
+	go func() {
+		_, err := p.DeleteRecords(context.Background(), fakeZone, []libdns.Record{{Type: "A", Name: "www"}})
+		errs <- err
+	}()
+	closeWindow(3)
+
+	var ambiguous, failed int
+	for i := 0; i < 3; i++ {
+		err := <-errs
+		switch {
+		case errors.Is(err, ErrAmbiguousMatch):
+			ambiguous++
+		case err != nil:
+			failed++
+		}
+	}
+	if ambiguous != 1 || failed != 2 {
+		t.Fatalf("Expected one ambiguous delete and two failed appends, got %v and %v", ambiguous, failed)
+	}
+}
+
+func TestProvider_CoalesceUnresolvedRecordIDFails(t *testing.T) {
+	p, server, closeWindow := newCoalescingProvider(t)
+	// the record is missing, when the records are read after the update
+	emptyRecordSet := map[string]interface{}{"dnsrecords": []interface{}{}}
+	server.RespondNext("infoDnsRecords", emptyRecordSet, emptyRecordSet)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}})
+		errs <- err
+	}()
+	closeWindow(1)
+
+	if err := <-errs; !errors.Is(err, ErrRecordIDUnresolved) {
+		t.Fatalf("Expected ErrRecordIDUnresolved, got %v", err)
+	}
+	if records := server.Records(fakeZone); len(records) != 1 {
+		t.Fatalf("Expected the record to be appended anyway, got %+v", records)
+	}
+}
+
+func TestProvider_CoalesceOperationTimeout(t *testing.T) {
+	p, _, closeWindow := newCoalescingProvider(t)
+	p.OperationTimeout = 50 * time.Millisecond
+	// a slow call holds the lock of the zone
+	unlock, err := p.lockZoneInProcess(context.Background(), fakeZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	// the batch is opened directly, so its end can be awaited independently of the timeouts of the calls
+	call := &coalescedCall{ctx: context.Background(), records: toNetcupRecords(fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}})}
+	batch := &coalescedBatch{calls: []*coalescedCall{call}, done: make(chan struct{})}
+	p.batchesMutex.Lock()
+	p.batches = map[string]*coalescedBatch{fakeZone: batch}
+	p.batchesMutex.Unlock()
+	go p.runBatch(fakeZone, fakeZone, batch)
+	closeWindow(1)
+
+	select {
+	case <-batch.done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the batch to end with the operation timeout")
+	}
+	if !errors.Is(call.err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the batch to fail with the operation timeout, got %v", call.err)
+	}
+}
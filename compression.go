@@ -0,0 +1,63 @@
+// Compression of the requests to netcup and their responses with gzip
+
+package netcup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// gzipRequestThreshold is the size of request bodies in bytes, from which they are compressed with GzipRequests.
+// Smaller bodies, like the login, don't get noticeably smaller.
+const gzipRequestThreshold = 32 << 10
+
+// Returns the request body compressed with gzip, if GzipRequests is set and the body is large enough, and if it is
+// compressed.
+func (p *Provider) compressRequestBody(body []byte) ([]byte, bool) {
+	if !p.GzipRequests || len(body) < gzipRequestThreshold {
+		return body, false
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(body); err != nil {
+		return body, false
+	}
+	if err := writer.Close(); err != nil {
+		return body, false
+	}
+	return compressed.Bytes(), true
+}
+
+// gzipBody decompresses a response body compressed with gzip. The gzip header is only read on the first Read, so the
+// whole read can be aborted by closing the body.
+type gzipBody struct {
+	body   io.ReadCloser
+	reader *gzip.Reader
+}
+
+func (body *gzipBody) Read(data []byte) (int, error) {
+	if body.reader == nil {
+		reader, err := gzip.NewReader(body.body)
+		if err != nil {
+			return 0, err
+		}
+		body.reader = reader
+	}
+	return body.reader.Read(data)
+}
+
+func (body *gzipBody) Close() error {
+	return body.body.Close()
+}
+
+// Returns the decompressed body of the response. Since the requests ask for gzip explicitly, http.Transport doesn't
+// decompress the responses itself.
+func decompressedBody(httpResp *http.Response) io.ReadCloser {
+	if strings.EqualFold(strings.TrimSpace(httpResp.Header.Get("Content-Encoding")), "gzip") {
+		return &gzipBody{body: httpResp.Body}
+	}
+	return httpResp.Body
+}
@@ -0,0 +1,224 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// encodingTransport records the encodings of the requests and responses and the bytes of the responses on the wire.
+type encodingTransport struct {
+	mutex             sync.Mutex
+	requestEncodings  []string
+	responseEncodings []string
+	requestBytes      int64
+	responseBytes     int64
+}
+
+func (transport *encodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	transport.mutex.Lock()
+	transport.requestEncodings = append(transport.requestEncodings, req.Header.Get("Content-Encoding"))
+	transport.requestBytes += req.ContentLength
+	transport.responseEncodings = append(transport.responseEncodings, res.Header.Get("Content-Encoding"))
+	transport.mutex.Unlock()
+	res.Body = &countingBody{ReadCloser: res.Body, transport: transport}
+	return res, nil
+}
+
+type countingBody struct {
+	io.ReadCloser
+	transport *encodingTransport
+}
+
+func (body *countingBody) Read(data []byte) (int, error) {
+	n, err := body.ReadCloser.Read(data)
+	body.transport.mutex.Lock()
+	body.transport.responseBytes += int64(n)
+	body.transport.mutex.Unlock()
+	return n, err
+}
+
+// Returns records for a large zone, with destinations as repetitive as real ones.
+func largeZoneRecords(count int) []netcuptest.Record {
+	records := make([]netcuptest.Record, count)
+	for i := range records {
+		records[i] = netcuptest.Record{HostName: fmt.Sprintf("host-%v", i), Type: "TXT", Destination: fmt.Sprintf("v=spf1 include:_spf.example.com ip4:192.0.2.%v ~all", i%256)}
+	}
+	return records
+}
+
+func TestProvider_CompressedResponses(t *testing.T) {
+	p, server := newFakeProvider(t, largeZoneRecords(1000)...)
+	server.SetCompression(true)
+	transport := &encodingTransport{}
+	p.HTTPClient = &http.Client{Transport: transport}
+
+	records, err := p.GetRecords(context.Background(), fakeZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1000 {
+		t.Fatalf("Expected 1000 records, got %v", len(records))
+	}
+	for _, encoding := range transport.responseEncodings {
+		if encoding != "gzip" {
+			t.Fatalf("Expected all responses to be compressed, got %v", transport.responseEncodings)
+		}
+	}
+}
+
+func TestProvider_CompressedResponseSize(t *testing.T) {
+	p, server := newFakeProvider(t, largeZoneRecords(1000)...)
+	server.SetCompression(true)
+	p.MaxResponseSize = 16 << 10
+
+	// the limit applies to the decompressed response
+	if _, err := p.GetRecords(context.Background(), fakeZone); !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("Expected the decompressed response to exceed the limit, got %v", err)
+	}
+}
+
+func TestProvider_GzipRequests(t *testing.T) {
+	records := make([]libdns.Record, 1000)
+	for i := range records {
+		records[i] = libdns.Record{Name: fmt.Sprintf("host-%v", i), Type: "TXT", Value: "v=spf1 include:_spf.example.com ~all"}
+	}
+
+	for _, gzipRequests := range []bool{false, true} {
+		t.Run(fmt.Sprint(gzipRequests), func(t *testing.T) {
+			p, server := newFakeProvider(t)
+			p.GzipRequests = gzipRequests
+			transport := &encodingTransport{}
+			p.HTTPClient = &http.Client{Transport: transport}
+
+			if _, err := p.AppendRecords(context.Background(), fakeZone, records); err != nil {
+				t.Fatal(err)
+			}
+			if appended := server.Records(fakeZone); len(appended) != len(records) {
+				t.Fatalf("Expected %v records, got %v", len(records), len(appended))
+			}
+			// only the update is large enough to be compressed
+			var compressed int
+			for _, encoding := range transport.requestEncodings {
+				if encoding == "gzip" {
+					compressed++
+				}
+			}
+			if gzipRequests && compressed != 1 || !gzipRequests && compressed != 0 {
+				t.Fatalf("Expected the update to be compressed only with GzipRequests, got %v", transport.requestEncodings)
+			}
+		})
+	}
+}
+
+func TestProvider_GzipRequestsHooks(t *testing.T) {
+	p, _ := newFakeProvider(t)
+	p.GzipRequests = true
+	var mutex sync.Mutex
+	var bodies []string
+	p.RequestHooks = []RequestHook{func(ctx context.Context, action string, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		bodies = append(bodies, string(body))
+	}}
+
+	records := make([]libdns.Record, 1000)
+	for i := range records {
+		records[i] = libdns.Record{Name: fmt.Sprintf("host-%v", i), Type: "TXT", Value: "value"}
+	}
+	if _, err := p.AppendRecords(context.Background(), fakeZone, records); err != nil {
+		t.Fatal(err)
+	}
+	// the hooks get the uncompressed body
+	for _, body := range bodies {
+		if !strings.HasPrefix(body, "{") {
+			t.Fatalf("Expected the hooks to get JSON, got %q", body)
+		}
+	}
+}
+
+// BenchmarkProvider_GetRecordsLargeZone compares reading a zone of 4000 records with and without compressed responses.
+// wire-B/op is the size of the responses on the wire.
+func BenchmarkProvider_GetRecordsLargeZone(b *testing.B) {
+	for _, compression := range []bool{false, true} {
+		b.Run(fmt.Sprintf("gzip=%v", compression), func(b *testing.B) {
+			server := netcuptest.NewServer()
+			defer server.Close()
+			server.AddZone(fakeZone, 86400, largeZoneRecords(4000)...)
+			server.SetCompression(compression)
+			transport := &encodingTransport{}
+			p := &Provider{
+				CustomerNumber:        "12345",
+				APIKey:                "key",
+				APIPassword:           "password",
+				Endpoint:              server.URL,
+				AllowInsecureEndpoint: true,
+				RequestsPerSecond:     -1,
+				HTTPClient:            &http.Client{Transport: transport},
+			}
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(transport.responseBytes)/float64(b.N), "wire-B/op")
+		})
+	}
+}
+
+// BenchmarkProvider_AppendRecordsLargeUpdate compares an update of 4000 records with and without GzipRequests.
+// wire-B/op is the size of the requests on the wire.
+func BenchmarkProvider_AppendRecordsLargeUpdate(b *testing.B) {
+	records := make([]libdns.Record, 4000)
+	for i := range records {
+		records[i] = libdns.Record{Name: fmt.Sprintf("host-%v", i), Type: "TXT", Value: fmt.Sprintf("v=spf1 include:_spf.example.com ip4:192.0.2.%v ~all", i%256)}
+	}
+
+	for _, gzipRequests := range []bool{false, true} {
+		b.Run(fmt.Sprintf("gzip=%v", gzipRequests), func(b *testing.B) {
+			server := netcuptest.NewServer()
+			defer server.Close()
+			transport := &encodingTransport{}
+			p := &Provider{
+				CustomerNumber:        "12345",
+				APIKey:                "key",
+				APIPassword:           "password",
+				Endpoint:              server.URL,
+				AllowInsecureEndpoint: true,
+				RequestsPerSecond:     -1,
+				GzipRequests:          gzipRequests,
+				HTTPClient:            &http.Client{Transport: transport},
+			}
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				server.AddZone(fakeZone, 86400)
+				b.StartTimer()
+				if _, err := p.AppendRecords(ctx, fakeZone, records); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(transport.requestBytes)/float64(b.N), "wire-B/op")
+		})
+	}
+}
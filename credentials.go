@@ -0,0 +1,195 @@
+// Credentials from an external helper command
+
+package netcup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultCredentialCommandTimeout limits the run time of Provider.CredentialCommand, if CredentialCommandTimeout is not set
+const defaultCredentialCommandTimeout = 10 * time.Second
+
+// ErrMissingCredentials is returned before any request is sent, if the customer number, the API key or the API password
+// of the provider is empty. The error names the empty fields.
+var ErrMissingCredentials = errors.New("missing credentials")
+
+// Environment variables read by NewFromEnv
+const (
+	EnvCustomerNumber = "NETCUP_CUSTOMER_NUMBER"
+	EnvAPIKey         = "NETCUP_API_KEY"
+	EnvAPIPassword    = "NETCUP_API_PASSWORD"
+)
+
+// NewFromEnv returns a provider with the credentials from the environment variables NETCUP_CUSTOMER_NUMBER, NETCUP_API_KEY
+// and NETCUP_API_PASSWORD. If any of them is empty or not set, an error wrapping ErrMissingCredentials names them.
+// The other fields of the provider can be set afterwards.
+func NewFromEnv() (*Provider, error) {
+	creds := credentials{
+		CustomerNumber: os.Getenv(EnvCustomerNumber),
+		APIKey:         os.Getenv(EnvAPIKey),
+		APIPassword:    os.Getenv(EnvAPIPassword),
+	}
+	if missing := creds.missing(EnvCustomerNumber, EnvAPIKey, EnvAPIPassword); len(missing) > 0 {
+		return nil, fmt.Errorf("%v %w: %v not set", loggingPrefixLibdnsNetcup, ErrMissingCredentials, strings.Join(missing, ", "))
+	}
+	return &Provider{CustomerNumber: creds.CustomerNumber, APIKey: creds.APIKey, APIPassword: creds.APIPassword}, nil
+}
+
+// credentials for the netcup API
+type credentials struct {
+	CustomerNumber string `json:"customer_number"`
+	APIKey         string `json:"api_key"`
+	APIPassword    string `json:"api_password"`
+}
+
+// Returns the credentials for the API requests: from the fields of the provider, or from the output of CredentialCommand,
+// which is only executed, if it wasn't executed successfully before or refresh is set.
+// For another customer of the call, the credentials of its entry in Customers are returned, or the API key and password of
+// the provider with its customer number.
+func (p *Provider) credentials(ctx context.Context, refresh bool) (credentials, error) {
+	customerNumber := p.customerNumber(ctx)
+	if customer := p.customer(customerNumber); customer != nil {
+		return customer.credentials(), nil
+	}
+	creds, err := p.providerCredentials(ctx, refresh)
+	if err != nil {
+		return credentials{}, err
+	}
+	if customerNumber != "" {
+		creds.CustomerNumber = customerNumber
+	}
+	return creds, nil
+}
+
+// Returns the credentials of the provider itself: from its fields, or from the output of CredentialCommand.
+func (p *Provider) providerCredentials(ctx context.Context, refresh bool) (credentials, error) {
+	if len(p.CredentialCommand) == 0 {
+		return credentials{CustomerNumber: p.CustomerNumber, APIKey: p.APIKey, APIPassword: p.APIPassword}, nil
+	}
+
+	p.credentialsMutex.Lock()
+	defer p.credentialsMutex.Unlock()
+	if p.commandCredentials != nil && !refresh {
+		return *p.commandCredentials, nil
+	}
+
+	creds, err := p.runCredentialCommand(ctx)
+	if err != nil {
+		return credentials{}, err
+	}
+	p.commandCredentials = &creds
+	return creds, nil
+}
+
+// Executes CredentialCommand and parses its output. The output is never logged or part of an error, since it contains secrets.
+func (p *Provider) runCredentialCommand(ctx context.Context) (credentials, error) {
+	timeout := p.CredentialCommandTimeout
+	if timeout <= 0 {
+		timeout = defaultCredentialCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.CredentialCommand[0], p.CredentialCommand[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return credentials{}, fmt.Errorf("%v credential command %v failed: %w: %v", loggingPrefixLibdnsNetcup, p.CredentialCommand[0], err, message)
+		}
+		return credentials{}, fmt.Errorf("%v credential command %v failed: %w", loggingPrefixLibdnsNetcup, p.CredentialCommand[0], err)
+	}
+
+	creds, err := parseCredentials(stdout.Bytes())
+	if err != nil {
+		return credentials{}, fmt.Errorf("%v invalid output of credential command %v: %w", loggingPrefixLibdnsNetcup, p.CredentialCommand[0], err)
+	}
+	return creds, nil
+}
+
+// Parses the output of a credential command: either a JSON object with the keys customer_number, api_key and api_password,
+// or lines of key=value pairs with the same keys. Empty lines and lines starting with # are ignored.
+// The errors never contain the output.
+func parseCredentials(output []byte) (credentials, error) {
+	var creds credentials
+	trimmed := bytes.TrimSpace(output)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		if err := json.Unmarshal(trimmed, &creds); err != nil {
+			return credentials{}, errors.New("malformed JSON")
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			separator := strings.Index(text, "=")
+			if separator < 0 {
+				return credentials{}, fmt.Errorf("line %v is no key=value pair", line)
+			}
+			key, value := text[:separator], text[separator+1:]
+			switch strings.TrimSpace(key) {
+			case "customer_number":
+				creds.CustomerNumber = strings.TrimSpace(value)
+			case "api_key":
+				creds.APIKey = strings.TrimSpace(value)
+			case "api_password":
+				creds.APIPassword = strings.TrimSpace(value)
+			default:
+				return credentials{}, fmt.Errorf("unknown key %q in line %v", strings.TrimSpace(key), line)
+			}
+		}
+	}
+
+	if missing := creds.missing("customer_number", "api_key", "api_password"); len(missing) > 0 {
+		return credentials{}, fmt.Errorf("missing %v", strings.Join(missing, ", "))
+	}
+	return creds, nil
+}
+
+// Returns the names of the empty credentials, given in the order customer number, API key and API password.
+// Values of only white space count as empty.
+func (creds credentials) missing(customerNumberName, apiKeyName, apiPasswordName string) []string {
+	var missing []string
+	if strings.TrimSpace(creds.CustomerNumber) == "" {
+		missing = append(missing, customerNumberName)
+	}
+	if strings.TrimSpace(creds.APIKey) == "" {
+		missing = append(missing, apiKeyName)
+	}
+	if strings.TrimSpace(creds.APIPassword) == "" {
+		missing = append(missing, apiPasswordName)
+	}
+	return missing
+}
+
+// Returns an error wrapping ErrMissingCredentials, if a credential field of the provider is empty. The credentials of
+// CredentialCommand are checked, when its output is parsed. For another customer of the call the credentials of its
+// entry in Customers are checked.
+func (p *Provider) checkCredentials(ctx context.Context) error {
+	if customer := p.customer(p.customerNumber(ctx)); customer != nil {
+		return customer.checkCredentials()
+	}
+	if len(p.CredentialCommand) > 0 {
+		return nil
+	}
+	creds := credentials{CustomerNumber: p.CustomerNumber, APIKey: p.APIKey, APIPassword: p.APIPassword}
+	if missing := creds.missing("CustomerNumber", "APIKey", "APIPassword"); len(missing) > 0 {
+		return fmt.Errorf("%v %w: %v empty", loggingPrefixLibdnsNetcup, ErrMissingCredentials, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// newCredentialHelper writes a helper script, that prints the content of a file, which is initially output, to stdout
+// and counts its executions. It returns the command, a function to change the output and one to get the number of executions.
+func newCredentialHelper(t *testing.T, output string, script string) ([]string, func(string), func() int) {
+	dir := t.TempDir()
+	outputFile := filepath.Join(dir, "output")
+	countFile := filepath.Join(dir, "count")
+	scriptFile := filepath.Join(dir, "helper.sh")
+	setOutput := func(output string) {
+		if err := ioutil.WriteFile(outputFile, []byte(output), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setOutput(output)
+	if script == "" {
+		script = `cat "$1"`
+	}
+	if err := ioutil.WriteFile(scriptFile, []byte("#!/bin/sh\necho x >> \"$2\"\n"+script+"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	executions := func() int {
+		data, _ := ioutil.ReadFile(countFile)
+		return strings.Count(string(data), "x")
+	}
+	return []string{"/bin/sh", scriptFile, outputFile, countFile}, setOutput, executions
+}
+
+func newCredentialCommandProvider(t *testing.T, command []string) (*Provider, *netcuptest.Server) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("the credential helper needs /bin/sh")
+	}
+	p, server := newFakeProvider(t)
+	p.CustomerNumber, p.APIKey, p.APIPassword = "", "", ""
+	p.CredentialCommand = command
+	return p, server
+}
+
+func TestProvider_CredentialCommand(t *testing.T) {
+	outputs := map[string]string{
+		"json":      `{"customer_number": "12345", "api_key": "key", "api_password": "password"}`,
+		"key=value": "# netcup\ncustomer_number=12345\napi_key = key\n\napi_password=password\n",
+	}
+	for name, output := range outputs {
+		t.Run(name, func(t *testing.T) {
+			command, _, executions := newCredentialHelper(t, output, "")
+			p, server := newCredentialCommandProvider(t, command)
+			server.SetCredentials("12345", "key", "password")
+
+			for i := 0; i < 2; i++ {
+				if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if count := executions(); count != 1 {
+				t.Fatalf("Expected the command to be executed once, got %v", count)
+			}
+		})
+	}
+}
+
+func TestProvider_CredentialCommandMalformedOutput(t *testing.T) {
+	outputs := map[string]string{
+		"invalid json":     `{"customer_number": "12345", "api_key": "secret-key"`,
+		"no key=value":     "12345 secret-key secret-password",
+		"unknown key":      "customer_number=12345\napi_key=secret-key\npassword=secret-password",
+		"missing password": "customer_number=12345\napi_key=secret-key",
+		"blank password":   `{"customer_number": "12345", "api_key": "secret-key", "api_password": " "}`,
+	}
+	for name, output := range outputs {
+		t.Run(name, func(t *testing.T) {
+			command, _, _ := newCredentialHelper(t, output, "")
+			p, server := newCredentialCommandProvider(t, command)
+
+			_, err := p.GetRecords(context.Background(), fakeZone)
+			if err == nil || !strings.Contains(err.Error(), "invalid output of credential command") {
+				t.Fatalf("Expected the output to be rejected, got %v", err)
+			}
+			if strings.Contains(err.Error(), "secret") {
+				t.Fatalf("The error must not contain the output: %v", err)
+			}
+			if calls := server.Calls(); len(calls) != 0 {
+				t.Fatalf("Expected no API calls, got %v", server.Actions())
+			}
+		})
+	}
+}
+
+func TestProvider_MissingCredentials(t *testing.T) {
+	tests := []struct {
+		customerNumber, apiKey, apiPassword string
+		expected                            string
+	}{
+		{"", "key", "password", "CustomerNumber empty"},
+		{"12345", " \t", "password", "APIKey empty"},
+		{"12345", "key", "", "APIPassword empty"},
+		{"", "", "", "CustomerNumber, APIKey, APIPassword empty"},
+	}
+	for _, tt := range tests {
+		p, server := newFakeProvider(t)
+		p.CustomerNumber, p.APIKey, p.APIPassword = tt.customerNumber, tt.apiKey, tt.apiPassword
+
+		_, err := p.GetRecords(context.Background(), fakeZone)
+		if !errors.Is(err, ErrMissingCredentials) || !strings.HasSuffix(err.Error(), tt.expected) {
+			t.Fatalf("Expected an error ending with %q, got %v", tt.expected, err)
+		}
+		if calls := server.Calls(); len(calls) != 0 {
+			t.Fatalf("Expected no API calls, got %v", server.Actions())
+		}
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv(EnvCustomerNumber, "12345")
+	t.Setenv(EnvAPIKey, "key")
+	t.Setenv(EnvAPIPassword, "password")
+	p, err := NewFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.CustomerNumber != "12345" || p.APIKey != "key" || p.APIPassword != "password" {
+		t.Fatalf("Expected the credentials of the environment, got %+v", p)
+	}
+
+	t.Setenv(EnvCustomerNumber, "")
+	os.Unsetenv(EnvAPIPassword)
+	_, err = NewFromEnv()
+	if !errors.Is(err, ErrMissingCredentials) || !strings.Contains(err.Error(), EnvCustomerNumber+", "+EnvAPIPassword) || strings.Contains(err.Error(), EnvAPIKey) {
+		t.Fatalf("Expected the missing variables to be named, got %v", err)
+	}
+}
+
+func TestProvider_CredentialCommandFails(t *testing.T) {
+	command, _, _ := newCredentialHelper(t, "", `echo "vault is sealed" >&2; exit 3`)
+	p, _ := newCredentialCommandProvider(t, command)
+
+	_, err := p.GetRecords(context.Background(), fakeZone)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") || !strings.Contains(err.Error(), "vault is sealed") {
+		t.Fatalf("Expected the exit status and stderr in the error, got %v", err)
+	}
+}
+
+func TestProvider_CredentialCommandTimeout(t *testing.T) {
+	command, _, _ := newCredentialHelper(t, "", `exec sleep 5`)
+	p, _ := newCredentialCommandProvider(t, command)
+	p.CredentialCommandTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := p.GetRecords(context.Background(), fakeZone)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("Expected the command to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("The command wasn't stopped after the timeout, took %v", elapsed)
+	}
+}
+
+func TestProvider_CredentialCommandRotation(t *testing.T) {
+	command, setOutput, executions := newCredentialHelper(t, "customer_number=12345\napi_key=key\napi_password=old", "")
+	p, server := newCredentialCommandProvider(t, command)
+	server.SetCredentials("12345", "key", "old")
+
+	if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	// the password is rotated and the session expires, so the login with the cached credentials fails and the command is executed again
+	setOutput("customer_number=12345\napi_key=key\napi_password=new")
+	server.SetCredentials("12345", "key", "new")
+	server.ExpireSessions()
+	if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if count := executions(); count != 2 {
+		t.Fatalf("Expected the command to be executed again after the failed login, got %v executions", count)
+	}
+}
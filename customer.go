@@ -0,0 +1,108 @@
+// Zones of other customers, for example of the customers of a reseller
+
+package netcup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Customer contains the credentials of another netcup customer, whose zones are managed by the provider, for example
+// by a reseller. netcup API keys belong to one customer number, so every customer needs its own API key and password.
+type Customer struct {
+	CustomerNumber string `json:"customer_number"`
+	APIKey         string `json:"api_key"`
+	APIPassword    string `json:"api_password"`
+	// Zones are the zones of the customer, given like AllowedZones. The calls for them use the credentials of the customer,
+	// unless CallOptions.CustomerNumber is set.
+	Zones []string `json:"zones,omitempty"`
+}
+
+// customerKey is the context key for the customer number of the zone of a call, see withCustomer
+type customerKey struct{}
+
+// Returns a context for the calls for the zone, that use the customer number, whose Zones contain the zone.
+// The context is returned unchanged for the zones of CustomerNumber.
+func (p *Provider) withCustomer(ctx context.Context, zone string) context.Context {
+	for _, customer := range p.Customers {
+		if matchesAnyZone(zone, customer.Zones) {
+			return context.WithValue(ctx, customerKey{}, customer.CustomerNumber)
+		}
+	}
+	return ctx
+}
+
+// Returns the customer number of the call, if it is not CustomerNumber: CallOptions.CustomerNumber or the one of the
+// zone of the call. An empty string is returned for the customer of the provider.
+func (p *Provider) customerNumber(ctx context.Context) string {
+	customerNumber := callOptions(ctx).CustomerNumber
+	if customerNumber == "" {
+		customerNumber, _ = ctx.Value(customerKey{}).(string)
+	}
+	if customerNumber == p.CustomerNumber {
+		return ""
+	}
+	return customerNumber
+}
+
+// Returns the entry of Customers for the customer number, or nil if there is none.
+func (p *Provider) customer(customerNumber string) *Customer {
+	if customerNumber == "" {
+		return nil
+	}
+	for i := range p.Customers {
+		if p.Customers[i].CustomerNumber == customerNumber {
+			return &p.Customers[i]
+		}
+	}
+	return nil
+}
+
+func (customer *Customer) credentials() credentials {
+	return credentials{CustomerNumber: customer.CustomerNumber, APIKey: customer.APIKey, APIPassword: customer.APIPassword}
+}
+
+// Returns an error wrapping ErrMissingCredentials, if a credential field of the customer is empty.
+func (customer *Customer) checkCredentials() error {
+	if missing := customer.credentials().missing("CustomerNumber", "APIKey", "APIPassword"); len(missing) > 0 {
+		return fmt.Errorf("%v %w: %v of customer %v empty", loggingPrefixLibdnsNetcup, ErrMissingCredentials, strings.Join(missing, ", "), customer.CustomerNumber)
+	}
+	return nil
+}
+
+// Returns the session cache of another customer than the one of the provider.
+func (p *Provider) customerSessionCache(customerNumber string) *sessionCache {
+	p.customerSessionsMutex.Lock()
+	defer p.customerSessionsMutex.Unlock()
+	cache, found := p.customerSessions[customerNumber]
+	if !found {
+		if p.customerSessions == nil {
+			p.customerSessions = make(map[string]*sessionCache)
+		}
+		cache = &sessionCache{}
+		p.customerSessions[customerNumber] = cache
+	}
+	return cache
+}
+
+// Logs out the cached sessions of the other customers, like Logout. The first error is returned.
+func (p *Provider) logoutCustomers(ctx context.Context) error {
+	p.customerSessionsMutex.Lock()
+	var customerNumbers []string
+	for customerNumber := range p.customerSessions {
+		customerNumbers = append(customerNumbers, customerNumber)
+	}
+	p.customerSessionsMutex.Unlock()
+	sort.Strings(customerNumbers)
+
+	var firstErr error
+	for _, customerNumber := range customerNumbers {
+		err := p.Logout(context.WithValue(ctx, customerKey{}, customerNumber))
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
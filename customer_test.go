@@ -0,0 +1,134 @@
+package netcup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+const customerZone = "customer.example"
+
+// Returns the action, customer number and API key of every call to the fake server, separated by colons.
+func callCredentials(t *testing.T, server *netcuptest.Server) []string {
+	t.Helper()
+	var credentials []string
+	for _, call := range server.Calls() {
+		var param struct {
+			CustomerNumber string `json:"customernumber"`
+			APIKey         string `json:"apikey"`
+			DomainName     string `json:"domainname"`
+		}
+		if err := json.Unmarshal(call.Param, &param); err != nil {
+			t.Fatal(err)
+		}
+		credentials = append(credentials, strings.Join([]string{call.Action, param.DomainName, param.CustomerNumber, param.APIKey}, ":"))
+	}
+	return credentials
+}
+
+func TestProvider_Customers(t *testing.T) {
+	p, server := newFakeProvider(t)
+	server.AddZone(customerZone, 86400)
+	p.Customers = []Customer{{CustomerNumber: "67890", APIKey: "customer-key", APIPassword: "customer-password", Zones: []string{customerZone}}}
+	ctx := context.Background()
+
+	if _, err := p.GetRecords(ctx, fakeZone+"."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AppendRecords(ctx, customerZone+".", []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+	// the customers have their own sessions
+	if count := server.CallCount("login"); count != 2 {
+		t.Fatalf("Expected a login per customer, got %v", count)
+	}
+	for _, call := range callCredentials(t, server) {
+		parts := strings.Split(call, ":")
+		if parts[0] == "login" {
+			continue
+		}
+		customer := parts[1] == customerZone && parts[2] == "67890" && parts[3] == "customer-key"
+		own := parts[1] == fakeZone && parts[2] == "12345" && parts[3] == "key"
+		if !customer && !own {
+			t.Fatalf("Expected the credentials of the customer of the zone, got %v", call)
+		}
+	}
+
+	// the sessions are reused by the next calls for the same customer
+	server.ResetCalls()
+	if _, err := p.GetRecords(ctx, customerZone); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.CallCount("login"); count != 0 {
+		t.Fatalf("Expected the cached sessions to be reused, got %v logins", count)
+	}
+
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.SessionCount(); count != 0 {
+		t.Fatalf("Expected Close to log out the sessions of all customers, got %v sessions", count)
+	}
+}
+
+func TestProvider_CallOptionsCustomerNumber(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.Customers = []Customer{{CustomerNumber: "67890", APIKey: "customer-key", APIPassword: "customer-password"}}
+
+	tests := map[string]string{
+		// the entry in Customers has the credentials
+		"67890": "customer-key",
+		// without entry, the API key of the provider is used
+		"11111": "key",
+		// the customer of the provider
+		"12345": "key",
+	}
+	for customerNumber, apiKey := range tests {
+		t.Run(customerNumber, func(t *testing.T) {
+			server.ResetCalls()
+			ctx := WithCallOptions(context.Background(), CallOptions{CustomerNumber: customerNumber})
+			if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+				t.Fatal(err)
+			}
+			for _, call := range callCredentials(t, server) {
+				if !strings.HasSuffix(call, ":"+customerNumber+":"+apiKey) {
+					t.Fatalf("Expected the customer number %v with the API key %v, got %v", customerNumber, apiKey, call)
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_CustomerMissingCredentials(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.Customers = []Customer{{CustomerNumber: "67890", APIKey: "customer-key", Zones: []string{fakeZone}}}
+
+	_, err := p.GetRecords(context.Background(), fakeZone)
+	if !errors.Is(err, ErrMissingCredentials) || !strings.Contains(err.Error(), "APIPassword of customer 67890") {
+		t.Fatalf("Expected the missing password of the customer, got %v", err)
+	}
+	if calls := server.Actions(); len(calls) != 0 {
+		t.Fatalf("Expected no requests, got %v", calls)
+	}
+}
+
+func TestProvider_RedactedCustomers(t *testing.T) {
+	p := &Provider{CustomerNumber: "12345", APIKey: "key", APIPassword: "password",
+		Customers: []Customer{{CustomerNumber: "67890", APIKey: "customer-key", APIPassword: "customer-password"}}}
+
+	if formatted := p.String(); strings.Contains(formatted, "customer-key") || strings.Contains(formatted, "customer-password") {
+		t.Fatalf("Expected the credentials of the customers to be redacted, got %v", formatted)
+	}
+	// the provider itself is unchanged
+	if p.Customers[0].APIKey != "customer-key" {
+		t.Fatalf("Expected the provider to be unchanged, got %+v", p.Customers)
+	}
+}
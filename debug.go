@@ -0,0 +1,67 @@
+// Debug output of the raw requests to netcup and their responses
+
+package netcup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// redactedValue replaces the secrets in the bodies logged with Debug
+const redactedValue = "***"
+
+// redactedKeys are the keys of the JSON values, which are redacted in the bodies logged with Debug
+var redactedKeys = map[string]bool{"apipassword": true, "apikey": true, "apisessionid": true}
+
+// Returns the JSON body with the values of the credentials and session IDs replaced by redactedValue at any depth.
+// Keys are compared case-insensitively. A body, that isn't valid JSON, is only described by its length, since it can't
+// be redacted reliably.
+func redactJSON(body []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return "<" + strconv.Itoa(len(body)) + " bytes, not JSON>"
+	}
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return "<" + strconv.Itoa(len(body)) + " bytes, not JSON>"
+	}
+	return string(redacted)
+}
+
+// Returns the decoded JSON value with the values of redactedKeys replaced.
+func redactValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			if redactedKeys[strings.ToLower(key)] {
+				value[key] = redactedValue
+			} else {
+				value[key] = redactValue(nested)
+			}
+		}
+	case []interface{}:
+		for i, nested := range value {
+			value[i] = redactValue(nested)
+		}
+	}
+	return value
+}
+
+// Logs the raw body of a request or response, as kind tells, with the credentials redacted, if Debug is set.
+// Quiet doesn't suppress it.
+func (p *Provider) logBody(kind string, action string, body []byte) {
+	if !p.Debug || p.Logger == nil {
+		return
+	}
+	message := redactJSON(body)
+	if logger, ok := p.Logger.(structuredLogger); ok {
+		logger.logEntry(context.Background(), levelDebug, "raw netcup "+kind, []logAttr{{"action", action}, {"body", message}})
+		return
+	}
+	p.Logger.Printf("%v Raw %v of %v: %v", loggingPrefixLibdnsNetcup, kind, action, message)
+}
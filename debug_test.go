@@ -0,0 +1,60 @@
+package netcup
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/libdns/libdns"
+)
+
+func TestRedactJSON(t *testing.T) {
+	tests := []struct {
+		body, expected string
+	}{
+		{`{"action":"login","param":{"customernumber":"12345","apikey":"key","apipassword":"secret"}}`,
+			`{"action":"login","param":{"apikey":"***","apipassword":"***","customernumber":"12345"}}`},
+		// session IDs in responses, keys in any case and at any depth
+		{`{"responsedata":{"apisessionid":"session"},"statuscode":2000}`, `{"responsedata":{"apisessionid":"***"},"statuscode":2000}`},
+		{`{"param":{"APIKey":"key","list":[{"ApiSessionId":"session"}]}}`, `{"param":{"APIKey":"***","list":[{"ApiSessionId":"***"}]}}`},
+		// values, that aren't strings, are redacted too
+		{`{"apipassword":{"value":"secret"},"apikey":12345}`, `{"apikey":"***","apipassword":"***"}`},
+		// other values are kept, even if they look like secrets
+		{`{"destination":"apikey=secret","priority":"10"}`, `{"destination":"apikey=secret","priority":"10"}`},
+		{`<html>Maintenance apipassword secret</html>`, `<43 bytes, not JSON>`},
+		{`{"apikey":"key"}{"apipassword":"secret"}`, `<40 bytes, not JSON>`},
+	}
+	for _, tt := range tests {
+		if redacted := redactJSON([]byte(tt.body)); redacted != tt.expected {
+			t.Errorf("redactJSON(%v) = %v, expected %v", tt.body, redacted, tt.expected)
+		}
+	}
+}
+
+func TestProvider_Debug(t *testing.T) {
+	p, _ := newFakeProvider(t)
+	p.APIKey = "secret-api-key"
+	p.APIPassword = "secret-api-password"
+	logger := &recordingLogger{}
+	p.Logger = logger
+	p.Debug = true
+	p.Quiet = true
+
+	if _, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	var request, response bool
+	for _, message := range logger.messages {
+		request = request || strings.HasPrefix(message, "[libdns_netcup] Raw request of updateDnsRecords: ") && strings.Contains(message, `"destination":"192.0.2.1"`)
+		response = response || strings.HasPrefix(message, "[libdns_netcup] Raw response of login: ") && strings.Contains(message, `"apisessionid":"***"`)
+		if strings.Contains(message, "secret-api") || strings.Contains(message, "session1") {
+			t.Fatalf("Expected the credentials and session IDs to be redacted, got %v", message)
+		}
+	}
+	if !request || !response {
+		t.Fatalf("Expected the raw requests and responses, got %q", logger.messages)
+	}
+}
@@ -0,0 +1,146 @@
+// Delegation of subdomains to other nameservers
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrDelegationConflict is returned (wrapped) by DelegateSubdomain, if there are records at or below the delegated name,
+// that are neither NS records nor glue of the delegation. With CallOptions.Force these records are deleted instead.
+var ErrDelegationConflict = errors.New("delegation conflicts with existing records")
+
+// DelegateSubdomain delegates sub, a name relative to the zone like "k8s", to the given nameservers. It sets the NS records
+// at sub to the nameservers and, for nameservers below the delegated name, the glue A and AAAA records to the addresses in glue,
+// which are needed for these nameservers. Nameservers outside of the delegated name must not have glue.
+//
+// Other records at or below sub fail the delegation with ErrDelegationConflict, unless CallOptions.Force is set, which deletes them.
+func (p *Provider) DelegateSubdomain(ctx context.Context, zone string, sub string, nameservers []string, glue map[string][]net.IP) (*ChangeResult, error) {
+	sub = canonicalName(sub)
+	if sub == "@" {
+		return nil, fmt.Errorf("%v the apex of zone %v can't be delegated", loggingPrefixLibdnsNetcup, zone)
+	}
+	if len(nameservers) == 0 {
+		return nil, fmt.Errorf("%v no nameservers to delegate %v to", loggingPrefixLibdnsNetcup, sub)
+	}
+	zoneName := strings.ToLower(unFQDN(zone))
+	delegatedName := sub + "." + zoneName
+
+	glueAddresses := make(map[string][]net.IP)
+	for name, addresses := range glue {
+		glueAddresses[strings.ToLower(strings.TrimSuffix(name, "."))] = addresses
+	}
+
+	var delegationRecords []dnsRecord
+	glueNames := make(map[string]bool)
+	for _, nameserver := range nameservers {
+		nameserver = strings.ToLower(strings.TrimSuffix(nameserver, "."))
+		if !validHostName(nameserver) {
+			return nil, fmt.Errorf("%v invalid nameserver %q", loggingPrefixLibdnsNetcup, nameserver)
+		}
+		delegationRecords = append(delegationRecords, dnsRecord{HostName: sub, RecType: "NS", Destination: nameserver + "."})
+
+		if !isBelowName(nameserver, delegatedName) {
+			continue
+		}
+		addresses := glueAddresses[nameserver]
+		if len(addresses) == 0 {
+			return nil, fmt.Errorf("%v nameserver %v is below %v and needs glue addresses", loggingPrefixLibdnsNetcup, nameserver, delegatedName)
+		}
+		hostName := strings.TrimSuffix(nameserver, "."+zoneName)
+		glueNames[hostName] = true
+		for _, address := range addresses {
+			record := dnsRecord{HostName: hostName, RecType: "AAAA", Destination: address.String()}
+			if address.To4() != nil {
+				record.RecType = "A"
+			}
+			delegationRecords = append(delegationRecords, record)
+		}
+	}
+	for name := range glueAddresses {
+		if !isBelowName(name, delegatedName) || !glueNames[strings.TrimSuffix(name, "."+zoneName)] {
+			return nil, fmt.Errorf("%v glue for %v, which is not a nameserver of the delegation below %v", loggingPrefixLibdnsNetcup, name, delegatedName)
+		}
+	}
+
+	p.logf("%v Delegating %v to %v", loggingPrefixLibdnsNetcup, delegatedName, nameservers)
+
+	return p.changeZone(ctx, zone, "delegate", func(existingRecords []dnsRecord) ([]dnsRecord, error) {
+		var conflicts []dnsRecord
+		for _, record := range existingRecords {
+			hostName := strings.ToLower(record.HostName)
+			recType := canonicalType(record.RecType)
+			switch {
+			case hostName == sub && recType == "NS":
+			case glueNames[hostName] && (recType == "A" || recType == "AAAA"):
+			case hostName == sub || strings.HasSuffix(hostName, "."+sub):
+				conflicts = append(conflicts, record)
+			}
+		}
+		if len(conflicts) > 0 && !callOptions(ctx).Force {
+			return nil, fmt.Errorf("%v %v records at or below %v: %+v, use CallOptions.Force to delete them: %w",
+				loggingPrefixLibdnsNetcup, len(conflicts), delegatedName, conflicts, ErrDelegationConflict)
+		}
+
+		updates := getRecordsToSet(delegationRecords, existingRecords, MatchByNameType)
+		for _, record := range conflicts {
+			record.DeleteRecord = true
+			updates = append(updates, record)
+		}
+		return updates, nil
+	})
+}
+
+// RemoveDelegation removes the delegation of sub created by DelegateSubdomain: the NS records at sub and the A and AAAA records below it.
+func (p *Provider) RemoveDelegation(ctx context.Context, zone string, sub string) (*ChangeResult, error) {
+	sub = canonicalName(sub)
+	if sub == "@" {
+		return nil, fmt.Errorf("%v the apex of zone %v is not delegated", loggingPrefixLibdnsNetcup, zone)
+	}
+
+	p.logf("%v Removing delegation of %v from zone %v", loggingPrefixLibdnsNetcup, sub, zone)
+
+	return p.changeZone(ctx, zone, "remove_delegation", func(existingRecords []dnsRecord) ([]dnsRecord, error) {
+		var updates []dnsRecord
+		for _, record := range existingRecords {
+			hostName := strings.ToLower(record.HostName)
+			recType := canonicalType(record.RecType)
+			isNS := hostName == sub && recType == "NS"
+			isGlue := strings.HasSuffix(hostName, "."+sub) && (recType == "A" || recType == "AAAA")
+			if isNS || isGlue {
+				record.DeleteRecord = true
+				updates = append(updates, record)
+			}
+		}
+		return updates, nil
+	})
+}
+
+// Checks, if name equals parent or is below it.
+func isBelowName(name string, parent string) bool {
+	return name == parent || strings.HasSuffix(name, "."+parent)
+}
+
+// Checks, if name is a fully qualified host name without trailing dot: at least two labels of letters, digits, hyphens
+// and underscores, each at most 63 characters long and not starting or ending with a hyphen.
+func validHostName(name string) bool {
+	labels := strings.Split(name, ".")
+	if len(name) > 253 || len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// zoneContents returns the records of the fake zone as sorted "hostname type destination" strings.
+func zoneContents(server *netcuptest.Server) []string {
+	var contents []string
+	for _, record := range server.Records(fakeZone) {
+		contents = append(contents, record.HostName+" "+record.Type+" "+record.Destination)
+	}
+	sort.Strings(contents)
+	return contents
+}
+
+func assertZoneContents(t *testing.T, server *netcuptest.Server, expected ...string) {
+	t.Helper()
+	if contents := zoneContents(server); fmt.Sprint(contents) != fmt.Sprint(expected) {
+		t.Fatalf("Expected the zone to contain %q, got %q", expected, contents)
+	}
+}
+
+func TestProvider_DelegateSubdomainWithGlue(t *testing.T) {
+	p, server := newFakeProvider(t,
+		netcuptest.Record{ID: "1", HostName: "www", Type: "A", Destination: "192.0.2.1"},
+		// an old glue record of ns1 is replaced
+		netcuptest.Record{ID: "2", HostName: "ns1.k8s", Type: "A", Destination: "192.0.2.99"},
+	)
+
+	result, err := p.DelegateSubdomain(context.Background(), fakeZone, "k8s", []string{"ns1.k8s." + fakeZone + ".", "ns.external.example.net"},
+		map[string][]net.IP{"ns1.k8s." + fakeZone: {net.ParseIP("192.0.2.53"), net.ParseIP("2001:db8::53")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertZoneContents(t, server,
+		"k8s NS ns.external.example.net.",
+		"k8s NS ns1.k8s."+fakeZone+".",
+		"ns1.k8s A 192.0.2.53",
+		"ns1.k8s AAAA 2001:db8::53",
+		"www A 192.0.2.1",
+	)
+	if len(result.Appended) != 3 || len(result.Updated) != 1 || len(result.Deleted) != 0 {
+		t.Fatalf("Expected 3 appended records and the updated glue record, got %+v", result)
+	}
+}
+
+func TestProvider_DelegateSubdomainToExternalNameservers(t *testing.T) {
+	p, server := newFakeProvider(t,
+		netcuptest.Record{ID: "1", HostName: "k8s", Type: "NS", Destination: "old.example.net."},
+	)
+
+	if _, err := p.DelegateSubdomain(context.Background(), fakeZone, "K8S.", []string{"ns1.example.net", "ns2.example.net"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	assertZoneContents(t, server, "k8s NS ns1.example.net.", "k8s NS ns2.example.net.")
+
+	// delegating again with the same nameservers changes nothing
+	server.ResetCalls()
+	result, err := p.DelegateSubdomain(context.Background(), fakeZone, "k8s", []string{"ns1.example.net", "ns2.example.net"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Appended)+len(result.Updated)+len(result.Deleted) != 0 || server.CallCount("updateDnsRecords") != 0 {
+		t.Fatalf("Expected no changes, got %+v", result)
+	}
+}
+
+func TestProvider_DelegateSubdomainConflict(t *testing.T) {
+	p, server := newFakeProvider(t,
+		netcuptest.Record{ID: "1", HostName: "k8s", Type: "A", Destination: "192.0.2.1"},
+		netcuptest.Record{ID: "2", HostName: "api.k8s", Type: "CNAME", Destination: "k8s." + fakeZone + "."},
+		netcuptest.Record{ID: "3", HostName: "www", Type: "A", Destination: "192.0.2.2"},
+	)
+	nameservers := []string{"ns1.example.net"}
+
+	_, err := p.DelegateSubdomain(context.Background(), fakeZone, "k8s", nameservers, nil)
+	if !errors.Is(err, ErrDelegationConflict) {
+		t.Fatalf("Expected ErrDelegationConflict, got %v", err)
+	}
+	if count := server.CallCount("updateDnsRecords"); count != 0 {
+		t.Fatalf("Expected no update, got %v", count)
+	}
+
+	ctx := WithCallOptions(context.Background(), CallOptions{Force: true})
+	result, err := p.DelegateSubdomain(ctx, fakeZone, "k8s", nameservers, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertZoneContents(t, server, "k8s NS ns1.example.net.", "www A 192.0.2.2")
+	if len(result.Deleted) != 2 {
+		t.Fatalf("Expected the conflicting records to be deleted, got %+v", result)
+	}
+}
+
+func TestProvider_DelegateSubdomainValidation(t *testing.T) {
+	p, server := newFakeProvider(t)
+	ctx := context.Background()
+	inZone := "ns1.k8s." + fakeZone
+	address := []net.IP{net.ParseIP("192.0.2.53")}
+
+	tests := []struct {
+		name        string
+		sub         string
+		nameservers []string
+		glue        map[string][]net.IP
+	}{
+		{"apex", "@", []string{"ns1.example.net"}, nil},
+		{"no nameservers", "k8s", nil, nil},
+		{"invalid nameserver", "k8s", []string{"ns1 example net"}, nil},
+		{"nameserver without dot", "k8s", []string{"localhost"}, nil},
+		{"in-zone nameserver without glue", "k8s", []string{inZone}, nil},
+		{"glue for external nameserver", "k8s", []string{"ns1.example.net"}, map[string][]net.IP{"ns1.example.net": address}},
+		{"glue for unknown nameserver", "k8s", []string{inZone}, map[string][]net.IP{inZone: address, "ns2.k8s." + fakeZone: address}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.DelegateSubdomain(ctx, fakeZone, tt.sub, tt.nameservers, tt.glue); err == nil {
+				t.Fatal("Expected the delegation to be rejected")
+			}
+		})
+	}
+	if calls := server.Calls(); len(calls) != 0 {
+		t.Fatalf("Expected no API calls for invalid delegations, got %v", server.Actions())
+	}
+}
+
+func TestProvider_RemoveDelegation(t *testing.T) {
+	p, server := newFakeProvider(t,
+		netcuptest.Record{ID: "1", HostName: "k8s", Type: "NS", Destination: "ns1.k8s." + fakeZone + "."},
+		netcuptest.Record{ID: "2", HostName: "ns1.k8s", Type: "A", Destination: "192.0.2.53"},
+		netcuptest.Record{ID: "3", HostName: "www", Type: "A", Destination: "192.0.2.1"},
+		netcuptest.Record{ID: "4", HostName: "k8s2", Type: "NS", Destination: "ns1.example.net."},
+	)
+
+	result, err := p.RemoveDelegation(context.Background(), fakeZone, "k8s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertZoneContents(t, server, "k8s2 NS ns1.example.net.", "www A 192.0.2.1")
+	if len(result.Deleted) != 2 {
+		t.Fatalf("Expected the NS and glue record to be deleted, got %+v", result)
+	}
+}
@@ -0,0 +1,154 @@
+// Package dnsrr converts between resource records of github.com/miekg/dns and the libdns records
+// used by the netcup provider. It is a separate package, so only users of the conversion depend on miekg/dns.
+//
+// Record names are relative to the zone like in netcup, with "@" for the zone apex. Values use the
+// presentation format of the record data, except for the priority of MX and SRV records and the weight of
+// SRV records, which are kept in separate fields like in libdns: the value of an MX record is only the mail
+// server and the value of an SRV record is "port target". ToRR also accepts SRV values "weight port target"
+// with the weight in the value, like netcup stores them. TXT records are joined into one value, since netcup doesn't
+// know about the segments of a TXT record, and split into segments of at most 255 bytes again by ToRR like the provider
+// splits them (netcup.SplitTXT).
+//
+// It is a separate module, so miekg/dns doesn't become a dependency of the provider.
+package dnsrr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+	netcup "github.com/wizardrix/libdns_netcup"
+)
+
+// SupportedTypes are the record types supported by the netcup DNS API and by FromRR and ToRR.
+var SupportedTypes = netcup.SupportedRecordTypes()
+
+// FromRR converts a resource record of the given zone to a libdns record.
+// The owner name of the resource record has to be in the zone.
+func FromRR(zone string, rr dns.RR) (libdns.Record, error) {
+	header := rr.Header()
+	recType := dns.TypeToString[header.Rrtype]
+	if !isSupported(recType) {
+		return libdns.Record{}, fmt.Errorf("record type %v is not supported by netcup", recType)
+	}
+
+	name, err := relativeName(header.Name, zone)
+	if err != nil {
+		return libdns.Record{}, err
+	}
+
+	record := libdns.Record{
+		Type: recType,
+		Name: name,
+		TTL:  time.Duration(header.Ttl) * time.Second,
+	}
+
+	switch rr := rr.(type) {
+	case *dns.MX:
+		record.Priority = uint(rr.Preference)
+		record.Value = rr.Mx
+	case *dns.SRV:
+		record.Priority = uint(rr.Priority)
+		record.Weight = uint(rr.Weight)
+		record.Value = fmt.Sprintf("%d %v", rr.Port, rr.Target)
+	case *dns.TXT:
+		record.Value = strings.Join(rr.Txt, "")
+	default:
+		record.Value = strings.TrimPrefix(rr.String(), header.String())
+	}
+
+	return record, nil
+}
+
+// ToRR converts a libdns record of the given zone to a resource record.
+// Names of targets in the value, like the mail server of an MX record, are treated as fully qualified.
+func ToRR(zone string, record libdns.Record) (dns.RR, error) {
+	if !isSupported(record.Type) {
+		return nil, fmt.Errorf("record type %v is not supported by netcup", record.Type)
+	}
+
+	header := dns.RR_Header{
+		Name:   dns.Fqdn(libdns.AbsoluteName(record.Name, dns.Fqdn(zone))),
+		Rrtype: dns.StringToType[record.Type],
+		Class:  dns.ClassINET,
+		Ttl:    uint32(record.TTL / time.Second),
+	}
+
+	switch record.Type {
+	case "MX":
+		if record.Priority > 65535 {
+			return nil, fmt.Errorf("invalid priority %v of MX record %v", record.Priority, record.Name)
+		}
+		return &dns.MX{Hdr: header, Preference: uint16(record.Priority), Mx: dns.Fqdn(record.Value)}, nil
+	case "SRV":
+		return toSRV(header, record)
+	case "TXT":
+		return &dns.TXT{Hdr: header, Txt: netcup.SplitTXT(record.Value)}, nil
+	}
+
+	rr, err := dns.NewRR(fmt.Sprintf("%v %v", header.String(), record.Value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q of %v record %v: %v", record.Value, record.Type, record.Name, err)
+	}
+	if rr == nil {
+		return nil, fmt.Errorf("empty value of %v record %v", record.Type, record.Name)
+	}
+
+	return rr, nil
+}
+
+// Converts an SRV record with the value "port target" and the weight in its own field, or the value "weight port target".
+func toSRV(header dns.RR_Header, record libdns.Record) (dns.RR, error) {
+	fields := strings.Fields(record.Value)
+	var weight uint64
+	switch len(fields) {
+	case 2:
+		if record.Weight > 65535 {
+			return nil, fmt.Errorf("invalid weight %v of SRV record %v", record.Weight, record.Name)
+		}
+		weight = uint64(record.Weight)
+	case 3:
+		var err error
+		weight, err = strconv.ParseUint(fields[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight in value %q of SRV record %v: %v", record.Value, record.Name, err)
+		}
+		fields = fields[1:]
+	default:
+		return nil, fmt.Errorf("invalid value %q of SRV record %v, expected \"port target\"", record.Value, record.Name)
+	}
+	port, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in value %q of SRV record %v: %v", record.Value, record.Name, err)
+	}
+	if record.Priority > 65535 {
+		return nil, fmt.Errorf("invalid priority %v of SRV record %v", record.Priority, record.Name)
+	}
+
+	return &dns.SRV{
+		Hdr:      header,
+		Priority: uint16(record.Priority),
+		Weight:   uint16(weight),
+		Port:     uint16(port),
+		Target:   dns.Fqdn(fields[1]),
+	}, nil
+}
+
+// Returns the name relative to the zone like the provider, "@" for the zone apex, or an error, if it isn't in the zone.
+func relativeName(fqdn string, zone string) (string, error) {
+	fqdn = dns.Fqdn(strings.ToLower(fqdn))
+	zone = dns.Fqdn(strings.ToLower(zone))
+	if !dns.IsSubDomain(zone, fqdn) {
+		return "", fmt.Errorf("name %v is not in zone %v", fqdn, zone)
+	}
+
+	return netcup.RelativeName(fqdn, zone), nil
+}
+
+// Returns if the type is supported. Unlike netcup, miekg/dns only knows the types in upper case.
+func isSupported(recType string) bool {
+	return recType == strings.ToUpper(recType) && netcup.IsSupportedRecordType(recType)
+}
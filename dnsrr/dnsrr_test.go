@@ -0,0 +1,168 @@
+package dnsrr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+	netcup "github.com/wizardrix/libdns_netcup"
+)
+
+const zone = "example.com."
+
+// one record in canonical form for every supported type, as miekg/dns formats them (for example hex digits in upper case)
+var roundTripRecords = []libdns.Record{
+	{Type: "A", Name: "@", Value: "192.0.2.1", TTL: 300 * time.Second},
+	{Type: "AAAA", Name: "www", Value: "2001:db8::1", TTL: 300 * time.Second},
+	{Type: "CAA", Name: "@", Value: `0 issue "letsencrypt.org"`, TTL: 300 * time.Second},
+	{Type: "CNAME", Name: "ftp", Value: "www.example.com.", TTL: 300 * time.Second},
+	{Type: "DS", Name: "sub", Value: "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118", TTL: 300 * time.Second},
+	{Type: "MX", Name: "@", Value: "mail.example.com.", Priority: 10, TTL: 300 * time.Second},
+	{Type: "NS", Name: "sub", Value: "ns1.example.net.", TTL: 300 * time.Second},
+	{Type: "OPENPGPKEY", Name: "hash._openpgpkey", Value: "mQINBF6xPzEBEAC", TTL: 300 * time.Second},
+	{Type: "SMIMEA", Name: "hash._smimecert", Value: "3 1 1 0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6", TTL: 300 * time.Second},
+	{Type: "SRV", Name: "_sip._tcp", Value: "5060 sip.example.com.", Priority: 10, Weight: 5, TTL: 300 * time.Second},
+	{Type: "SSHFP", Name: "host", Value: "4 2 123456789ABCDEF67890123456789ABCDEF67890123456789ABCDEF123456789", TTL: 300 * time.Second},
+	{Type: "TLSA", Name: "_443._tcp.www", Value: "3 1 1 0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6", TTL: 300 * time.Second},
+	{Type: "TXT", Name: "_acme-challenge", Value: "token", TTL: 300 * time.Second},
+	{Type: "TXT", Name: "long", Value: strings.Repeat("a", 600), TTL: 300 * time.Second},
+}
+
+func TestRoundTripFromRecord(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, record := range roundTripRecords {
+		covered[record.Type] = true
+		rr, err := ToRR(zone, record)
+		if err != nil {
+			t.Fatalf("ToRR(%+v): %v", record, err)
+		}
+		// the resource record has to survive its presentation format, like a zone file
+		parsed, err := dns.NewRR(rr.String())
+		if err != nil {
+			t.Fatalf("Parsing %q: %v", rr.String(), err)
+		}
+		result, err := FromRR(zone, parsed)
+		if err != nil {
+			t.Fatalf("FromRR(%v): %v", parsed, err)
+		}
+		if !reflect.DeepEqual(result, record) {
+			t.Errorf("Round trip of %+v returned %+v", record, result)
+		}
+	}
+
+	for _, recType := range SupportedTypes {
+		if !covered[recType] {
+			t.Errorf("Supported type %v is not covered by the round trip test", recType)
+		}
+	}
+}
+
+func TestRoundTripFromRR(t *testing.T) {
+	rrs := []string{
+		"example.com. 3600 IN A 192.0.2.1",
+		"www.example.com. 3600 IN AAAA 2001:db8::1",
+		`example.com. 3600 IN CAA 128 issuewild "letsencrypt.org"`,
+		"ftp.example.com. 3600 IN CNAME www.example.com.",
+		"example.com. 3600 IN MX 20 mail.example.com.",
+		"_sip._tcp.example.com. 3600 IN SRV 10 5 5060 sip.example.com.",
+		`example.com. 3600 IN TXT "v=spf1" " -all"`,
+		"host.sub.example.com. 3600 IN SSHFP 1 1 123456789abcdef67890123456789abcdef67890",
+	}
+	for _, s := range rrs {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := FromRR(zone, rr)
+		if err != nil {
+			t.Fatalf("FromRR(%v): %v", rr, err)
+		}
+		result, err := ToRR(zone, record)
+		if err != nil {
+			t.Fatalf("ToRR(%+v): %v", record, err)
+		}
+		// TXT segments are joined, so only their concatenation is kept
+		if txt, ok := rr.(*dns.TXT); ok {
+			txt.Txt = []string{strings.Join(txt.Txt, "")}
+		}
+		if rr.String() != result.String() {
+			t.Errorf("Round trip of %v returned %v", rr, result)
+		}
+	}
+}
+
+func TestFromRR(t *testing.T) {
+	tests := []struct {
+		rr       string
+		expected libdns.Record
+	}{
+		{"Sub.Example.COM. 60 IN A 192.0.2.1", libdns.Record{Type: "A", Name: "sub", Value: "192.0.2.1", TTL: time.Minute}},
+		{"*.example.com. 60 IN A 192.0.2.1", libdns.Record{Type: "A", Name: "*", Value: "192.0.2.1", TTL: time.Minute}},
+		{`example.com. 60 IN TXT "v=spf1" " -all"`, libdns.Record{Type: "TXT", Name: "@", Value: "v=spf1 -all", TTL: time.Minute}},
+		{"_sip._tcp.example.com. 60 IN SRV 10 5 5060 sip.example.com.", libdns.Record{Type: "SRV", Name: "_sip._tcp", Value: "5060 sip.example.com.", Priority: 10, Weight: 5, TTL: time.Minute}},
+	}
+	for _, tt := range tests {
+		rr, err := dns.NewRR(tt.rr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := FromRR("example.com", rr)
+		if err != nil {
+			t.Fatalf("FromRR(%v): %v", tt.rr, err)
+		}
+		if !reflect.DeepEqual(record, tt.expected) {
+			t.Errorf("FromRR(%v) = %+v, expected %+v", tt.rr, record, tt.expected)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	outside, _ := dns.NewRR("www.example.org. 60 IN A 192.0.2.1")
+	if _, err := FromRR(zone, outside); err == nil {
+		t.Error("Expected an error for a name outside of the zone")
+	}
+	soa, _ := dns.NewRR("example.com. 60 IN SOA ns.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600")
+	if _, err := FromRR(zone, soa); err == nil {
+		t.Error("Expected an error for an unsupported type")
+	}
+
+	records := []libdns.Record{
+		{Type: "SOA", Name: "@", Value: "ns.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600"},
+		{Type: "A", Name: "www", Value: "not an address"},
+		{Type: "SRV", Name: "_sip._tcp", Value: "sip.example.com."},
+		{Type: "SRV", Name: "_sip._tcp", Value: "5060 sip.example.com.", Weight: 70000},
+		{Type: "MX", Name: "@", Value: "mail.example.com.", Priority: 70000},
+	}
+	for _, record := range records {
+		if _, err := ToRR(zone, record); err == nil {
+			t.Errorf("Expected an error for %+v", record)
+		}
+	}
+}
+
+func TestToRRSRVWithWeightInValue(t *testing.T) {
+	rr, err := ToRR(zone, libdns.Record{Type: "SRV", Name: "_sip._tcp", Value: "5 5060 sip.example.com.", Priority: 10, TTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "_sip._tcp.example.com.\t60\tIN\tSRV\t10 5 5060 sip.example.com."; rr.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, rr.String())
+	}
+}
+
+func TestToRRSplitsTXTLikeProvider(t *testing.T) {
+	// multi-byte characters are not split, like by the provider
+	value := strings.Repeat("ä", 200)
+	rr, err := ToRR(zone, libdns.Record{Type: "TXT", Name: "utf8", Value: value})
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments := rr.(*dns.TXT).Txt
+	if !reflect.DeepEqual(segments, netcup.SplitTXT(value)) || len(segments) != 2 || !utf8.ValidString(segments[0]) {
+		t.Fatalf("Expected the segments of the provider, got %q", segments)
+	}
+}
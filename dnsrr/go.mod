@@ -0,0 +1,20 @@
+module github.com/wizardrix/libdns_netcup/dnsrr
+
+go 1.17
+
+require (
+	github.com/libdns/libdns v0.2.2
+	github.com/miekg/dns v1.1.50
+	github.com/wizardrix/libdns_netcup v0.0.0-00010101000000-000000000000
+)
+
+require (
+	golang.org/x/mod v0.4.2 // indirect
+	golang.org/x/net v0.0.0-20210726213435-c6fcb2dbf985 // indirect
+	golang.org/x/sync v0.1.0 // indirect
+	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c // indirect
+	golang.org/x/tools v0.1.6-0.20210726203631-07bc1bf47fb2 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+)
+
+replace github.com/wizardrix/libdns_netcup => ../
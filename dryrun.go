@@ -0,0 +1,57 @@
+// Dry runs, which plan the changes of records without applying them
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDryRun is wrapped by the error returned by the methods, which can't plan their changes in a dry run, like the ones
+// changing the TTL of a zone. No request changing the zone is sent in a dry run.
+var ErrDryRun = errors.New("not applied in a dry run")
+
+// Returns if the changes of the call are only planned and logged, because DryRun or CallOptions.DryRun is set.
+func (p *Provider) dryRun(ctx context.Context) bool {
+	return p.DryRun || callOptions(ctx).DryRun
+}
+
+// Returns an error wrapping ErrDryRun for a request changing the zone, if the call is a dry run. It guards the update
+// requests, so a dry run never changes a zone, even if a method doesn't plan its changes.
+func (p *Provider) checkDryRun(ctx context.Context, action string, zone string) error {
+	if !p.dryRun(ctx) {
+		return nil
+	}
+	return fmt.Errorf("%v %v of zone %v %w", loggingPrefixLibdnsNetcup, action, zone, ErrDryRun)
+}
+
+// Logs the updates of the records planned by a dry run and returns the changes, they would make to the existing records.
+func (p *Provider) planChanges(zone string, operation string, existingRecords []dnsRecord, updates []dnsRecord, ttl time.Duration) *ChangeResult {
+	result := changeResult(existingRecords, applyUpdates(existingRecords, updates), ttl)
+	p.logf("%v Dry run of %v in zone %v, not applied: appending %+v, updating %+v to %+v, deleting %+v",
+		loggingPrefixLibdnsNetcup, operation, zone, result.Appended, result.Previous, result.Updated, result.Deleted)
+	return result
+}
+
+// Returns the records as they would be after the updates were sent to netcup: records to delete are removed, records
+// with an ID are replaced and the others are appended without ID.
+func applyUpdates(existingRecords []dnsRecord, updates []dnsRecord) []dnsRecord {
+	records := append([]dnsRecord(nil), existingRecords...)
+	for _, update := range updates {
+		switch {
+		case update.DeleteRecord:
+			records = removeRecordByID(update.ID, records)
+		case update.ID != "":
+			for i := range records {
+				if records[i].ID == update.ID {
+					records[i] = update
+				}
+			}
+		default:
+			records = append(records, update)
+		}
+	}
+	return records
+}
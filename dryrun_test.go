@@ -0,0 +1,107 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+func TestProvider_DryRun(t *testing.T) {
+	existing := []netcuptest.Record{
+		{ID: "1", HostName: "www", Type: "A", Destination: "192.0.2.1"},
+		{ID: "2", HostName: "mail", Type: "A", Destination: "192.0.2.2"},
+	}
+	p, server := newFakeProvider(t, existing...)
+	p.DryRun = true
+	logger := &recordingLogger{}
+	p.Logger = logger
+	ctx := context.Background()
+
+	appended, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{{Name: "ftp", Type: "A", Value: "192.0.2.3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(appended) != 1 || appended[0].Name != "ftp" || appended[0].ID != "" {
+		t.Fatalf("Expected the record to append without ID, got %+v", appended)
+	}
+
+	set, err := p.SetRecords(ctx, fakeZone, []libdns.Record{{ID: "1", Name: "www", Type: "A", Value: "192.0.2.4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 1 || set[0].ID != "1" || set[0].Value != "192.0.2.4" {
+		t.Fatalf("Expected the record to update, got %+v", set)
+	}
+
+	deleted, err := p.DeleteRecords(ctx, fakeZone, []libdns.Record{{ID: "2", Name: "mail", Type: "A", Value: "192.0.2.2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != "2" {
+		t.Fatalf("Expected the record to delete, got %+v", deleted)
+	}
+
+	if count := server.CallCount("updateDnsRecords"); count != 0 {
+		t.Fatalf("Expected no updates in a dry run, got %v", count)
+	}
+	if records := server.Records(fakeZone); !reflect.DeepEqual(records, existing) {
+		t.Fatalf("Expected the zone to be unchanged, got %+v", records)
+	}
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	var plans int
+	for _, message := range logger.messages {
+		if strings.Contains(message, "Dry run of ") && strings.Contains(message, "not applied") {
+			plans++
+		}
+	}
+	if plans != 3 {
+		t.Fatalf("Expected the three plans to be logged, got %q", logger.messages)
+	}
+}
+
+func TestProvider_DryRunCallOptions(t *testing.T) {
+	p, server := newFakeProvider(t,
+		netcuptest.Record{ID: "1", HostName: "www", Type: "A", Destination: "192.0.2.1"},
+		netcuptest.Record{ID: "2", HostName: "old", Type: "TXT", Destination: "value"},
+	)
+	ctx := WithCallOptions(context.Background(), CallOptions{DryRun: true})
+
+	result, err := p.SyncRecords(ctx, fakeZone, []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.5"}, {Name: "new", Type: "TXT", Value: "value"}}, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Updated) != 1 || result.Updated[0].Value != "192.0.2.5" || len(result.Previous) != 1 || result.Previous[0].Value != "192.0.2.1" ||
+		len(result.Appended) != 1 || result.Appended[0].Name != "new" || len(result.Deleted) != 1 || result.Deleted[0].Name != "old" {
+		t.Fatalf("Expected the planned changes, got %+v", result)
+	}
+	if count := server.CallCount("updateDnsRecords"); count != 0 {
+		t.Fatalf("Expected no updates in a dry run, got %v", count)
+	}
+
+	// without the options the changes are applied
+	if _, err = p.SyncRecords(context.Background(), fakeZone, []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.5"}}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.CallCount("updateDnsRecords"); count != 1 {
+		t.Fatalf("Expected the update without dry run, got %v", count)
+	}
+}
+
+func TestProvider_DryRunZoneTTL(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.DryRun = true
+
+	if err := p.SetZoneTTL(context.Background(), fakeZone, time.Hour); !errors.Is(err, ErrDryRun) {
+		t.Fatalf("Expected the TTL change to fail in a dry run, got %v", err)
+	}
+	if count := server.CallCount("updateDnsZone"); count != 0 {
+		t.Fatalf("Expected no updates in a dry run, got %v", count)
+	}
+}
@@ -0,0 +1,153 @@
+package e2e
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/certmagic"
+	"github.com/mholt/acmez/acme"
+	"github.com/miekg/dns"
+	netcup "github.com/wizardrix/libdns_netcup"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+const zone = "example.com"
+
+// startSOAServer starts a DNS server, that is authoritative for the zone, so the solver can determine the zone without network access.
+func startSOAServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		res := new(dns.Msg)
+		res.SetReply(req)
+		soa := &dns.SOA{
+			Hdr:     dns.RR_Header{Name: zone + ".", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+			Ns:      "root-dns.netcup.net.",
+			Mbox:    "root-dns.netcup.net.",
+			Serial:  2022011201,
+			Refresh: 28800,
+			Retry:   7200,
+			Expire:  1209600,
+			Minttl:  300,
+		}
+		if req.Question[0].Name == zone+"." && req.Question[0].Qtype == dns.TypeSOA {
+			res.Answer = append(res.Answer, soa)
+		} else {
+			res.Rcode = dns.RcodeNameError
+			res.Ns = append(res.Ns, soa)
+		}
+		w.WriteMsg(res)
+	})
+
+	server := &dns.Server{PacketConn: conn, Handler: handler}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return conn.LocalAddr().String()
+}
+
+func newSolver(t *testing.T) (*certmagic.DNS01Solver, *netcuptest.Server) {
+	server := netcuptest.NewServer()
+	server.AddZone(zone, 86400, netcuptest.Record{HostName: "@", Type: "A", Destination: "192.0.2.1"})
+	t.Cleanup(server.Close)
+
+	solver := &certmagic.DNS01Solver{
+		DNSProvider: &netcup.Provider{
+			CustomerNumber:        "12345",
+			APIKey:                "key",
+			APIPassword:           "password",
+			Endpoint:              server.URL,
+			AllowInsecureEndpoint: true,
+		},
+		PropagationTimeout: -1,
+		Resolvers:          []string{startSOAServer(t)},
+	}
+
+	return solver, server
+}
+
+func challenge(domain, token string) acme.Challenge {
+	return acme.Challenge{
+		Type:             acme.ChallengeTypeDNS01,
+		Identifier:       acme.Identifier{Type: "dns", Value: domain},
+		Token:            token,
+		KeyAuthorization: token + ".thumbprint",
+	}
+}
+
+func txtValues(server *netcuptest.Server, hostName string) []string {
+	var values []string
+	for _, record := range server.Records(zone) {
+		if record.Type == "TXT" && record.HostName == hostName {
+			values = append(values, record.Destination)
+		}
+	}
+	return values
+}
+
+func TestDNS01Solver(t *testing.T) {
+	tests := []struct {
+		name       string
+		challenges []acme.Challenge
+	}{
+		{
+			name:       "single name",
+			challenges: []acme.Challenge{challenge("www.example.com", "token1")},
+		},
+		{
+			// the authorization of a wildcard name has the identifier of the base name, so both challenges
+			// need a TXT record with the same name, but different values
+			name:       "name and wildcard",
+			challenges: []acme.Challenge{challenge("example.com", "token1"), challenge("example.com", "token2")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			solver, server := newSolver(t)
+			ctx := context.Background()
+			before := server.Records(zone)
+
+			for _, chal := range test.challenges {
+				if err := solver.Present(ctx, chal); err != nil {
+					t.Fatal(err)
+				}
+				if err := solver.Wait(ctx, chal); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, chal := range test.challenges {
+				hostName := strings.TrimSuffix(chal.DNS01TXTRecordName(), "."+zone)
+				if !contains(txtValues(server, hostName), chal.DNS01KeyAuthorization()) {
+					t.Fatalf("TXT record %v with value %v not found in %+v", hostName, chal.DNS01KeyAuthorization(), server.Records(zone))
+				}
+			}
+
+			for _, chal := range test.challenges {
+				if err := solver.CleanUp(ctx, chal); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			after := server.Records(zone)
+			if len(after) != len(before) || after[0] != before[0] {
+				t.Fatalf("Expected only the original records %+v to remain, got %+v", before, after)
+			}
+		})
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
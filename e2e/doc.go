@@ -0,0 +1,4 @@
+// Package e2e contains end-to-end tests of the netcup provider with its consumers, like certmagic's DNS-01 solver.
+//
+// It is a separate module, so the dependencies of the consumers don't become dependencies of the provider.
+package e2e
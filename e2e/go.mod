@@ -0,0 +1,28 @@
+module github.com/wizardrix/libdns_netcup/e2e
+
+go 1.21
+
+require (
+	github.com/caddyserver/certmagic v0.20.0
+	github.com/mholt/acmez v1.2.0
+	github.com/miekg/dns v1.1.55
+	github.com/wizardrix/libdns_netcup v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/klauspost/cpuid/v2 v2.2.5 // indirect
+	github.com/libdns/libdns v0.2.2 // indirect
+	github.com/zeebo/blake3 v0.2.3 // indirect
+	go.uber.org/atomic v1.11.0 // indirect
+	go.uber.org/multierr v1.11.0 // indirect
+	go.uber.org/zap v1.24.0 // indirect
+	golang.org/x/crypto v0.14.0 // indirect
+	golang.org/x/mod v0.11.0 // indirect
+	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/sync v0.3.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	golang.org/x/tools v0.10.0 // indirect
+)
+
+replace github.com/wizardrix/libdns_netcup => ../
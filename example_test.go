@@ -0,0 +1,52 @@
+package netcup_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libdns/libdns"
+	netcup "github.com/wizardrix/libdns_netcup"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// The whole request flow of a method call, from the login to the logout, runs against the fake server of netcuptest,
+// which is an httptest.Server.
+func Example_fakeServer() {
+	server := netcuptest.NewServer()
+	defer server.Close()
+	server.AddZone("example.com", 300, netcuptest.Record{HostName: "www", Type: "A", Destination: "192.0.2.1"})
+
+	provider := &netcup.Provider{
+		CustomerNumber: "12345",
+		APIKey:         "key",
+		APIPassword:    "password",
+		Endpoint:       server.URL,
+		// the fake server doesn't use TLS
+		AllowInsecureEndpoint: true,
+	}
+	ctx := context.Background()
+
+	appended, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{{Name: "_acme-challenge", Type: "TXT", Value: "token"}})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("appended %v %v %v\n", appended[0].Name, appended[0].Type, appended[0].Value)
+	if err = provider.Logout(ctx); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(len(server.Records("example.com")), "records")
+	for _, action := range []string{"login", "infoDnsZone", "infoDnsRecords", "updateDnsRecords", "logout"} {
+		fmt.Printf("%v: %v\n", action, server.CallCount(action))
+	}
+	// Output:
+	// appended _acme-challenge TXT token
+	// 2 records
+	// login: 1
+	// infoDnsZone: 1
+	// infoDnsRecords: 2
+	// updateDnsRecords: 1
+	// logout: 1
+}
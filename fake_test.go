@@ -0,0 +1,32 @@
+// Test setup for tests against the fake netcup server
+
+package netcup
+
+import (
+	"testing"
+
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+const fakeZone = "example.com"
+
+// newFakeProvider starts a fake netcup server with the zone "example.com" containing the given records and
+// returns a provider, whose requests are sent to that server.
+func newFakeProvider(t *testing.T, records ...netcuptest.Record) (*Provider, *netcuptest.Server) {
+	server := netcuptest.NewServer()
+	server.AddZone(fakeZone, 86400, records...)
+	t.Cleanup(server.Close)
+
+	p := &Provider{
+		CustomerNumber: "12345",
+		APIKey:         "key",
+		APIPassword:    "password",
+		Endpoint:       server.URL,
+		// the fake server doesn't use TLS
+		AllowInsecureEndpoint: true,
+		// the fake server has no quota
+		RequestsPerSecond: -1,
+	}
+
+	return p, server
+}
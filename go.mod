@@ -2,4 +2,6 @@ module github.com/wizardrix/libdns_netcup
 
 go 1.17
 
-require github.com/libdns/libdns v0.2.1
+require github.com/libdns/libdns v0.2.2
+
+require golang.org/x/sync v0.1.0
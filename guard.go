@@ -0,0 +1,111 @@
+// Guard against operations on zones, that must not be touched by the provider
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// ErrZoneNotAllowed is returned (wrapped) for operations on zones, that are not in Provider.AllowedZones or are in
+// Provider.DeniedZones. Check for it with errors.Is.
+var ErrZoneNotAllowed = errors.New("zone not allowed")
+
+// ErrDeleteThresholdExceeded is matched by a DeleteThresholdError with errors.Is.
+var ErrDeleteThresholdExceeded = errors.New("delete threshold exceeded")
+
+// DeleteThresholdError is returned, if an operation would delete more records than allowed by
+// Provider.MaxDeleteFraction or Provider.MaxDeleteCount. Nothing was changed in this case.
+type DeleteThresholdError struct {
+	Zone string
+	// Records contains the records, that would have been deleted
+	Records []libdns.Record
+	// ZoneRecordCount is the number of records in the zone before the operation
+	ZoneRecordCount int
+}
+
+func (err *DeleteThresholdError) Error() string {
+	return fmt.Sprintf("%v %v: deleting %v of %v records in zone %v, use CallOptions.Force to delete them anyway: %+v",
+		loggingPrefixLibdnsNetcup, ErrDeleteThresholdExceeded, len(err.Records), err.ZoneRecordCount, err.Zone, err.Records)
+}
+
+// Is makes errors.Is(err, ErrDeleteThresholdExceeded) true.
+func (err *DeleteThresholdError) Is(target error) bool {
+	return target == ErrDeleteThresholdExceeded
+}
+
+// Checks if the deletions in the updates exceed the thresholds of the provider, relative to the number of records in the zone.
+func (p *Provider) checkDeleteThreshold(ctx context.Context, zone string, updates []dnsRecord, zoneRecordCount int, ttl time.Duration) error {
+	if callOptions(ctx).Force || !p.hasDeleteThreshold() {
+		return nil
+	}
+
+	var deletions []dnsRecord
+	for _, record := range updates {
+		if record.DeleteRecord {
+			deletions = append(deletions, record)
+		}
+	}
+	if len(deletions) == 0 {
+		return nil
+	}
+
+	exceeded := p.MaxDeleteCount > 0 && len(deletions) > p.MaxDeleteCount
+	if p.MaxDeleteFraction > 0 && zoneRecordCount > 0 && float64(len(deletions))/float64(zoneRecordCount) > p.MaxDeleteFraction {
+		exceeded = true
+	}
+	if !exceeded {
+		return nil
+	}
+
+	return &DeleteThresholdError{Zone: zone, Records: toLibdnsRecords(deletions, ttl), ZoneRecordCount: zoneRecordCount}
+}
+
+func (p *Provider) hasDeleteThreshold() bool {
+	return p.MaxDeleteCount > 0 || p.MaxDeleteFraction > 0
+}
+
+// Checks the zone against the allowed and denied zones of the provider. The denied zones take precedence.
+// Reads are only checked, if AllowAllReads is not set.
+func (p *Provider) checkZoneAllowed(zone string, read bool) error {
+	if read && p.AllowAllReads {
+		return nil
+	}
+
+	if matchesAnyZone(zone, p.DeniedZones) {
+		return fmt.Errorf("%v zone %v is denied: %w", loggingPrefixLibdnsNetcup, zone, ErrZoneNotAllowed)
+	}
+	if len(p.AllowedZones) > 0 && !matchesAnyZone(zone, p.AllowedZones) {
+		return fmt.Errorf("%v zone %v is not allowed: %w", loggingPrefixLibdnsNetcup, zone, ErrZoneNotAllowed)
+	}
+
+	return nil
+}
+
+// Checks if the zone matches one of the patterns. A pattern is either a zone name or "*." followed by a zone name,
+// which matches all zones below that zone, but not the zone itself. Names are compared case-insensitively and without trailing dot.
+func matchesAnyZone(zone string, patterns []string) bool {
+	zone = normalizeZone(zone)
+	for _, pattern := range patterns {
+		pattern = normalizeZone(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(zone, pattern[1:]) {
+				return true
+			}
+		} else if zone == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the zone name in lower case without trailing dot.
+func normalizeZone(zone string) string {
+	return strings.ToLower(unFQDN(strings.TrimSpace(zone)))
+}
@@ -0,0 +1,189 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+func TestMatchesAnyZone(t *testing.T) {
+	tests := []struct {
+		zone     string
+		patterns []string
+		expected bool
+	}{
+		{"example.com", []string{"example.com"}, true},
+		{"example.com.", []string{"Example.COM"}, true},
+		{"example.com", []string{"example.com."}, true},
+		{"example.org", []string{"example.com"}, false},
+		{"sub.example.com", []string{"example.com"}, false},
+		{"sub.example.com", []string{"*.example.com"}, true},
+		{"a.b.example.com.", []string{"*.example.com"}, true},
+		{"example.com", []string{"*.example.com"}, false},
+		{"badexample.com", []string{"*.example.com"}, false},
+		{"example.com", nil, false},
+		{"example.org", []string{"example.com", "*.org"}, true},
+	}
+	for _, tt := range tests {
+		if result := matchesAnyZone(tt.zone, tt.patterns); result != tt.expected {
+			t.Errorf("matchesAnyZone(%q, %q) = %v, expected %v", tt.zone, tt.patterns, result, tt.expected)
+		}
+	}
+}
+
+func TestProvider_CheckZoneAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		denied   []string
+		zone     string
+		expected bool
+	}{
+		{name: "no lists", zone: "example.com", expected: true},
+		{name: "allowed", allowed: []string{"example.com"}, zone: "example.com", expected: true},
+		{name: "not allowed", allowed: []string{"example.com"}, zone: "example.org", expected: false},
+		{name: "denied", denied: []string{"example.com"}, zone: "example.com", expected: false},
+		{name: "not denied", denied: []string{"example.com"}, zone: "example.org", expected: true},
+		{name: "denied takes precedence", allowed: []string{"*.example.com"}, denied: []string{"prod.example.com"}, zone: "prod.example.com", expected: false},
+		{name: "allowed next to denied", allowed: []string{"*.example.com"}, denied: []string{"prod.example.com"}, zone: "dev.example.com", expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{AllowedZones: tt.allowed, DeniedZones: tt.denied}
+			err := p.checkZoneAllowed(tt.zone, false)
+			if tt.expected && err != nil {
+				t.Fatalf("Expected zone %v to be allowed, got %v", tt.zone, err)
+			}
+			if !tt.expected && !errors.Is(err, ErrZoneNotAllowed) {
+				t.Fatalf("Expected ErrZoneNotAllowed for zone %v, got %v", tt.zone, err)
+			}
+		})
+	}
+}
+
+func TestProvider_ZoneNotAllowedFailsBeforeAPICalls(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.DeniedZones = []string{fakeZone}
+	ctx := context.Background()
+	records := []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}
+
+	operations := map[string]func() error{
+		"GetRecords": func() error {
+			_, err := p.GetRecords(ctx, fakeZone)
+			return err
+		},
+		"AppendRecords": func() error {
+			_, err := p.AppendRecords(ctx, fakeZone, records)
+			return err
+		},
+		"SetRecords": func() error {
+			_, err := p.SetRecords(ctx, fakeZone, records)
+			return err
+		},
+		"DeleteRecords": func() error {
+			_, err := p.DeleteRecords(ctx, fakeZone, records)
+			return err
+		},
+		"LowerTTL":   func() error { return p.LowerTTL(ctx, fakeZone, time.Minute) },
+		"RestoreTTL": func() error { return p.RestoreTTL(ctx, fakeZone) },
+	}
+	for name, operation := range operations {
+		if err := operation(); !errors.Is(err, ErrZoneNotAllowed) {
+			t.Errorf("%v: expected ErrZoneNotAllowed, got %v", name, err)
+		}
+	}
+	if calls := server.Calls(); len(calls) != 0 {
+		t.Fatalf("Expected no API calls, got %v", server.Actions())
+	}
+
+	p.AllowAllReads = true
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatalf("Reads should be allowed with AllowAllReads, got %v", err)
+	}
+	if _, err := p.AppendRecords(ctx, fakeZone, records); !errors.Is(err, ErrZoneNotAllowed) {
+		t.Fatalf("Writes should still be denied with AllowAllReads, got %v", err)
+	}
+}
+
+func TestProvider_DeleteThreshold(t *testing.T) {
+	zone := []netcuptest.Record{
+		{HostName: "a", Type: "A", Destination: "192.0.2.1"},
+		{HostName: "b", Type: "A", Destination: "192.0.2.2"},
+		{HostName: "c", Type: "A", Destination: "192.0.2.3"},
+		{HostName: "d", Type: "A", Destination: "192.0.2.4"},
+	}
+	deleteTwo := []libdns.Record{{Type: "A", Name: "a"}, {Type: "A", Name: "b"}}
+
+	tests := []struct {
+		name     string
+		fraction float64
+		count    int
+		force    bool
+		exceeded bool
+	}{
+		{name: "disabled", exceeded: false},
+		{name: "fraction at the limit", fraction: 0.5, exceeded: false},
+		{name: "fraction above the limit", fraction: 0.49, exceeded: true},
+		{name: "count at the limit", count: 2, exceeded: false},
+		{name: "count above the limit", count: 1, exceeded: true},
+		{name: "count exceeded, fraction not", fraction: 0.9, count: 1, exceeded: true},
+		{name: "forced", fraction: 0.1, count: 1, force: true, exceeded: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, server := newFakeProvider(t, zone...)
+			p.MaxDeleteFraction = tt.fraction
+			p.MaxDeleteCount = tt.count
+			ctx := WithCallOptions(context.Background(), CallOptions{Force: tt.force})
+
+			deleted, err := p.DeleteRecords(ctx, fakeZone, deleteTwo)
+			if !tt.exceeded {
+				if err != nil || len(deleted) != 2 {
+					t.Fatalf("Expected 2 deleted records, got %+v and error %v", deleted, err)
+				}
+				return
+			}
+
+			var thresholdErr *DeleteThresholdError
+			if !errors.Is(err, ErrDeleteThresholdExceeded) || !errors.As(err, &thresholdErr) {
+				t.Fatalf("Expected a DeleteThresholdError, got %v", err)
+			}
+			if len(thresholdErr.Records) != 2 || thresholdErr.ZoneRecordCount != 4 {
+				t.Fatalf("Expected the 2 records that would have been deleted out of 4, got %+v", thresholdErr)
+			}
+			if count := server.CallCount("updateDnsRecords"); count != 0 {
+				t.Fatalf("No update expected, got %v", count)
+			}
+		})
+	}
+}
+
+func TestProvider_DeleteThresholdSetRecords(t *testing.T) {
+	p, server := newFakeProvider(t,
+		netcuptest.Record{HostName: "@", Type: "TXT", Destination: "a"},
+		netcuptest.Record{HostName: "@", Type: "TXT", Destination: "b"},
+		netcuptest.Record{HostName: "@", Type: "TXT", Destination: "c"},
+	)
+	p.MaxDeleteCount = 1
+
+	// setting one value deletes the other two
+	_, err := p.SetRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "a"}})
+	if !errors.Is(err, ErrDeleteThresholdExceeded) {
+		t.Fatalf("Expected ErrDeleteThresholdExceeded, got %v", err)
+	}
+	if records := server.Records(fakeZone); len(records) != 3 {
+		t.Fatalf("Expected the zone to be unchanged, got %+v", records)
+	}
+
+	ctx := WithCallOptions(context.Background(), CallOptions{Force: true})
+	if _, err = p.SetRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if records := server.Records(fakeZone); len(records) != 1 {
+		t.Fatalf("Expected only one record after the forced set, got %+v", records)
+	}
+}
@@ -0,0 +1,84 @@
+// Hooks for the requests to netcup and their responses
+
+package netcup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// RequestHook is called before every attempt of a request to netcup with its API action, like "infoDnsRecords". It may
+// add headers to the request. The body of the request is a copy with the API password redacted, changes to it are not sent.
+type RequestHook func(ctx context.Context, action string, req *http.Request)
+
+// ResponseHook is called after every attempt of a request to netcup with its API action, the response, the duration
+// from sending the request to decoding the response, and the error of the attempt. The response is nil, if there
+// is no response from netcup, for example after a network error or an HTTP status other than 2xx.
+type ResponseHook func(ctx context.Context, action string, res *Response, duration time.Duration, err error)
+
+// Response is a response of netcup as passed to the ResponseHooks.
+type Response struct {
+	// Status is "success", "error" or "warning"
+	Status       string
+	StatusCode   int
+	ShortMessage string
+	LongMessage  string
+	// ClientRequestID is the ID echoed by netcup
+	ClientRequestID string
+	// ResponseData is the JSON of the data of the response, like the records
+	ResponseData json.RawMessage
+}
+
+// redactedPassword replaces the API password in the request bodies passed to the RequestHooks
+const redactedPassword = "REDACTED"
+
+// Calls the RequestHooks with the request, whose body is replaced by a copy with the API password redacted while they
+// run. The body is restored afterwards.
+func (p *Provider) callRequestHooks(ctx context.Context, req request, httpReq *http.Request, requestBody []byte) {
+	if len(p.RequestHooks) == 0 {
+		return
+	}
+	if req.Param.APIPassword != "" {
+		req.Param.APIPassword = redactedPassword
+	}
+	redactedBody, err := json.Marshal(req)
+	if err != nil {
+		redactedBody = nil
+	}
+
+	for _, hook := range p.RequestHooks {
+		httpReq.Body = io.NopCloser(bytes.NewReader(redactedBody))
+		hook(ctx, req.Action, httpReq)
+	}
+	httpReq.Body = io.NopCloser(bytes.NewReader(requestBody))
+	httpReq.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(requestBody)), nil
+	}
+	httpReq.ContentLength = int64(len(requestBody))
+}
+
+// Calls the ResponseHooks with the result of an attempt, that started at start.
+func (p *Provider) callResponseHooks(ctx context.Context, action string, res *response, start time.Time, err error) {
+	if len(p.ResponseHooks) == 0 {
+		return
+	}
+	duration := time.Since(start)
+	var hookResponse *Response
+	if res != nil {
+		hookResponse = &Response{
+			Status:          res.Status,
+			StatusCode:      res.StatusCode,
+			ShortMessage:    res.ShortMessage,
+			LongMessage:     res.LongMessage,
+			ClientRequestID: res.ClientRequestID,
+			ResponseData:    res.ResponseData,
+		}
+	}
+	for _, hook := range p.ResponseHooks {
+		hook(ctx, action, hookResponse, duration, err)
+	}
+}
@@ -0,0 +1,113 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// headerTransport records a header of the requests.
+type headerTransport struct {
+	mutex  sync.Mutex
+	header string
+	values []string
+}
+
+func (transport *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.mutex.Lock()
+	transport.values = append(transport.values, req.Header.Get(transport.header))
+	transport.mutex.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestProvider_RequestHooks(t *testing.T) {
+	p, server := newFakeProvider(t)
+	transport := &headerTransport{header: "X-Debug"}
+	p.HTTPClient = &http.Client{Transport: transport}
+
+	var mutex sync.Mutex
+	var order []string
+	var bodies []string
+	p.RequestHooks = []RequestHook{
+		func(ctx context.Context, action string, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			mutex.Lock()
+			defer mutex.Unlock()
+			order = append(order, "first "+action)
+			bodies = append(bodies, string(body))
+			req.Header.Set("X-Debug", action)
+		},
+		func(ctx context.Context, action string, req *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			order = append(order, "second "+action)
+		},
+	}
+
+	// the login succeeds, so the body with the password is sent after the hooks
+	if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(order) != 2*len(server.Calls()) || order[0] != "first login" || order[1] != "second login" {
+		t.Fatalf("Expected the hooks to be called in order for every request, got %v", order)
+	}
+	for _, body := range bodies {
+		if strings.Contains(body, `"password"`) {
+			t.Fatalf("Expected the password to be redacted, got %v", body)
+		}
+	}
+	if !strings.Contains(bodies[0], `"apipassword":"REDACTED"`) {
+		t.Fatalf("Expected the redacted password in the body of the login, got %v", bodies[0])
+	}
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	if transport.values[0] != "login" {
+		t.Fatalf("Expected the header of the hook to be sent, got %q", transport.values)
+	}
+}
+
+func TestProvider_ResponseHooks(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.RetryPolicy.MaxAttempts = 1
+	server.FailNext("infoDnsRecords", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error."})
+
+	type result struct {
+		action   string
+		res      *Response
+		duration time.Duration
+		err      error
+	}
+	var mutex sync.Mutex
+	results := make(map[string]result)
+	p.ResponseHooks = []ResponseHook{func(ctx context.Context, action string, res *Response, duration time.Duration, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[action] = result{action, res, duration, err}
+	}}
+
+	if _, err := p.GetRecords(context.Background(), fakeZone); err == nil {
+		t.Fatal("Expected the reading of the records to fail")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	login := results["login"]
+	if login.res == nil || login.res.Status != "success" || login.err != nil || login.duration <= 0 {
+		t.Fatalf("Expected the successful login, got %+v", login)
+	}
+	records := results["infoDnsRecords"]
+	var apiErr *APIError
+	if records.res == nil || records.res.ShortMessage != "Validation Error." || !errors.As(records.err, &apiErr) {
+		t.Fatalf("Expected the response and the error of the failed request, got %+v", records)
+	}
+}
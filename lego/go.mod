@@ -0,0 +1,23 @@
+module github.com/wizardrix/libdns_netcup/lego
+
+go 1.20
+
+require (
+	github.com/go-acme/lego/v4 v4.14.2
+	github.com/libdns/libdns v0.2.2
+	github.com/wizardrix/libdns_netcup v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/cenkalti/backoff/v4 v4.2.1 // indirect
+	github.com/go-jose/go-jose/v3 v3.0.0 // indirect
+	github.com/miekg/dns v1.1.55 // indirect
+	golang.org/x/crypto v0.10.0 // indirect
+	golang.org/x/mod v0.11.0 // indirect
+	golang.org/x/net v0.11.0 // indirect
+	golang.org/x/sync v0.3.0 // indirect
+	golang.org/x/sys v0.9.0 // indirect
+	golang.org/x/tools v0.10.0 // indirect
+)
+
+replace github.com/wizardrix/libdns_netcup => ../
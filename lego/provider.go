@@ -0,0 +1,172 @@
+// Package lego implements the DNS provider interface of go-acme/lego (challenge.Provider) with the netcup provider.
+//
+// It is a separate module, so lego doesn't become a dependency of the provider.
+package lego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/go-acme/lego/v4/platform/config/env"
+	"github.com/libdns/libdns"
+	netcup "github.com/wizardrix/libdns_netcup"
+)
+
+// Environment variables, following the conventions of the DNS providers of lego
+const (
+	envNamespace = "NETCUP_"
+
+	EnvCustomerNumber = envNamespace + "CUSTOMER_NUMBER"
+	EnvAPIKey         = envNamespace + "API_KEY"
+	EnvAPIPassword    = envNamespace + "API_PASSWORD"
+	EnvZone           = envNamespace + "ZONE"
+
+	EnvPropagationTimeout = envNamespace + "PROPAGATION_TIMEOUT"
+	EnvPollingInterval    = envNamespace + "POLLING_INTERVAL"
+	EnvHTTPTimeout        = envNamespace + "HTTP_TIMEOUT"
+)
+
+// Config is used to configure the creation of the DNSProvider.
+type Config struct {
+	CustomerNumber string
+	APIKey         string
+	APIPassword    string
+	// Zone is the zone of the challenge records. If it is empty, the zone is looked up in DNS.
+	Zone string
+
+	PropagationTimeout time.Duration
+	PollingInterval    time.Duration
+	// HTTPTimeout limits the duration of Present and CleanUp
+	HTTPTimeout time.Duration
+}
+
+// NewDefaultConfig returns a default configuration for the DNSProvider.
+// netcup updates its name servers only every few minutes, so the default propagation timeout is longer than usual.
+func NewDefaultConfig() *Config {
+	return &Config{
+		Zone:               env.GetOrFile(EnvZone),
+		PropagationTimeout: env.GetOrDefaultSecond(EnvPropagationTimeout, 15*time.Minute),
+		PollingInterval:    env.GetOrDefaultSecond(EnvPollingInterval, 30*time.Second),
+		HTTPTimeout:        env.GetOrDefaultSecond(EnvHTTPTimeout, 30*time.Second),
+	}
+}
+
+// DNSProvider implements the challenge.Provider interface of lego.
+type DNSProvider struct {
+	config   *Config
+	provider *netcup.Provider
+}
+
+// NewDNSProvider returns a DNSProvider instance configured for netcup.
+// The credentials must be passed in the environment variables NETCUP_CUSTOMER_NUMBER, NETCUP_API_KEY and NETCUP_API_PASSWORD.
+func NewDNSProvider() (*DNSProvider, error) {
+	values, err := env.Get(EnvCustomerNumber, EnvAPIKey, EnvAPIPassword)
+	if err != nil {
+		return nil, fmt.Errorf("netcup: %w", err)
+	}
+
+	config := NewDefaultConfig()
+	config.CustomerNumber = values[EnvCustomerNumber]
+	config.APIKey = values[EnvAPIKey]
+	config.APIPassword = values[EnvAPIPassword]
+
+	return NewDNSProviderConfig(config)
+}
+
+// NewDNSProviderConfig returns a DNSProvider instance configured for netcup.
+func NewDNSProviderConfig(config *Config) (*DNSProvider, error) {
+	if config == nil {
+		return nil, errors.New("netcup: the configuration of the DNS provider is nil")
+	}
+	if config.CustomerNumber == "" || config.APIKey == "" || config.APIPassword == "" {
+		return nil, errors.New("netcup: credentials missing")
+	}
+
+	provider := &netcup.Provider{
+		CustomerNumber: config.CustomerNumber,
+		APIKey:         config.APIKey,
+		APIPassword:    config.APIPassword,
+	}
+
+	return &DNSProvider{config: config, provider: provider}, nil
+}
+
+// Present creates a TXT record to fulfill the DNS-01 challenge.
+// Existing TXT records with the same name are kept, so challenges for the same name can be presented at the same time,
+// for example for a domain and its wildcard.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	ctx, cancel := d.context()
+	defer cancel()
+
+	zone, record, err := d.challengeRecord(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+
+	if _, err = d.provider.AppendRecords(ctx, zone, []libdns.Record{record}); err != nil {
+		return fmt.Errorf("netcup: failed to create TXT record %v: %w", record.Name, err)
+	}
+
+	return nil
+}
+
+// CleanUp removes the TXT record of the DNS-01 challenge. Only the record with the value of this challenge is deleted.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	ctx, cancel := d.context()
+	defer cancel()
+
+	zone, record, err := d.challengeRecord(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+
+	if _, err = d.provider.DeleteRecords(ctx, zone, []libdns.Record{record}); err != nil {
+		return fmt.Errorf("netcup: failed to delete TXT record %v: %w", record.Name, err)
+	}
+
+	return nil
+}
+
+// Timeout returns the timeout and interval to use when checking for DNS propagation.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.config.PropagationTimeout, d.config.PollingInterval
+}
+
+// Returns the zone and the TXT record of the challenge.
+func (d *DNSProvider) challengeRecord(domain, keyAuth string) (string, libdns.Record, error) {
+	info := dns01.GetChallengeInfo(domain, keyAuth)
+
+	zone := dns01.ToFqdn(d.config.Zone)
+	if d.config.Zone == "" {
+		var err error
+		zone, err = dns01.FindZoneByFqdn(info.EffectiveFQDN)
+		if err != nil {
+			return "", libdns.Record{}, fmt.Errorf("netcup: could not find the zone of %v: %w", info.EffectiveFQDN, err)
+		}
+	}
+
+	record := libdns.Record{
+		Type:  "TXT",
+		Name:  libdns.RelativeName(info.EffectiveFQDN, zone),
+		Value: info.Value,
+	}
+
+	return dns01.UnFqdn(zone), record, nil
+}
+
+func (d *DNSProvider) context() (context.Context, context.CancelFunc) {
+	if d.config.HTTPTimeout > 0 {
+		return context.WithTimeout(context.Background(), d.config.HTTPTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// Interface guards
+var (
+	_ challenge.Provider        = (*DNSProvider)(nil)
+	_ challenge.ProviderTimeout = (*DNSProvider)(nil)
+)
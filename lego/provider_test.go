@@ -0,0 +1,124 @@
+package lego
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+const zone = "example.com"
+
+func newFakeDNSProvider(t *testing.T) (*DNSProvider, *netcuptest.Server) {
+	server := netcuptest.NewServer()
+	server.AddZone(zone, 86400, netcuptest.Record{HostName: "www", Type: "A", Destination: "192.0.2.1"})
+	t.Cleanup(server.Close)
+
+	config := NewDefaultConfig()
+	config.CustomerNumber = "12345"
+	config.APIKey = "key"
+	config.APIPassword = "password"
+	config.Zone = zone
+	provider, err := NewDNSProviderConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.provider.Endpoint = server.URL
+	provider.provider.AllowInsecureEndpoint = true
+
+	return provider, server
+}
+
+// txtValues returns the sorted values of the TXT records with the given host name
+func txtValues(server *netcuptest.Server, hostName string) []string {
+	values := []string{}
+	for _, record := range server.Records(zone) {
+		if record.Type == "TXT" && record.HostName == hostName {
+			values = append(values, record.Destination)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+func TestDNSProvider_PresentAndCleanUp(t *testing.T) {
+	provider, server := newFakeDNSProvider(t)
+	// a domain and its wildcard share the challenge record name, but have different values.
+	// lego passes the domain of the authorization, which is the same for both.
+	first := dns01.GetChallengeInfo("example.com", "keyAuth1")
+	second := dns01.GetChallengeInfo("example.com", "keyAuth2")
+
+	if err := provider.Present("example.com", "token1", "keyAuth1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Present("example.com", "token2", "keyAuth2"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{first.Value, second.Value}
+	sort.Strings(expected)
+	if values := txtValues(server, "_acme-challenge"); len(values) != 2 || values[0] != expected[0] || values[1] != expected[1] {
+		t.Fatalf("Expected both challenge values %v, got %v", expected, values)
+	}
+
+	if err := provider.CleanUp("example.com", "token1", "keyAuth1"); err != nil {
+		t.Fatal(err)
+	}
+	if values := txtValues(server, "_acme-challenge"); len(values) != 1 || values[0] != second.Value {
+		t.Fatalf("Only the value of the second challenge should remain, got %v", values)
+	}
+
+	if err := provider.CleanUp("example.com", "token2", "keyAuth2"); err != nil {
+		t.Fatal(err)
+	}
+	if values := txtValues(server, "_acme-challenge"); len(values) != 0 {
+		t.Fatalf("No challenge record should remain, got %v", values)
+	}
+	if records := server.Records(zone); len(records) != 1 || records[0].HostName != "www" {
+		t.Fatalf("Other records must not be changed, got %+v", records)
+	}
+}
+
+func TestDNSProvider_Subdomain(t *testing.T) {
+	provider, server := newFakeDNSProvider(t)
+
+	if err := provider.Present("sub.example.com", "token", "keyAuth"); err != nil {
+		t.Fatal(err)
+	}
+	if values := txtValues(server, "_acme-challenge.sub"); len(values) != 1 {
+		t.Fatalf("Expected the challenge record relative to the zone, got %+v", server.Records(zone))
+	}
+}
+
+func TestDNSProvider_PresentTwiceIsIdempotent(t *testing.T) {
+	provider, server := newFakeDNSProvider(t)
+
+	for i := 0; i < 2; i++ {
+		if err := provider.Present("example.com", "token", "keyAuth"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if values := txtValues(server, "_acme-challenge"); len(values) != 1 {
+		t.Fatalf("Expected one challenge record, got %v", values)
+	}
+}
+
+func TestNewDNSProvider(t *testing.T) {
+	t.Setenv(EnvCustomerNumber, "12345")
+	t.Setenv(EnvAPIKey, "key")
+	t.Setenv(EnvAPIPassword, "")
+	if _, err := NewDNSProvider(); err == nil {
+		t.Fatal("Expected an error for the missing API password")
+	}
+
+	t.Setenv(EnvAPIPassword, "password")
+	t.Setenv(EnvPropagationTimeout, "60")
+	t.Setenv(EnvPollingInterval, "5")
+	provider, err := NewDNSProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout, interval := provider.Timeout(); timeout.Seconds() != 60 || interval.Seconds() != 5 {
+		t.Fatalf("Expected the propagation settings from the environment, got %v and %v", timeout, interval)
+	}
+}
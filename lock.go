@@ -0,0 +1,111 @@
+// Locking of zones across processes
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Locker locks a zone for the duration of a mutating operation. It allows to serialize the operations of multiple
+// processes sharing one netcup account, for example with a file lock or a lock in a database, since netcup replaces
+// whole record sets and interleaved updates lose records.
+//
+// Lock blocks until the lock for the zone is acquired or the context is done. The returned function releases the lock.
+type Locker interface {
+	Lock(ctx context.Context, zone string) (unlock func(), err error)
+}
+
+// ErrLockFailed is matched by a LockError with errors.Is.
+var ErrLockFailed = errors.New("failed to lock zone")
+
+// LockError is returned, if the Locker failed to lock the zone. Nothing was changed in this case, so the operation can be retried.
+type LockError struct {
+	Zone string
+	Err  error
+}
+
+func (err *LockError) Error() string {
+	return fmt.Sprintf("%v %v %v: %v", loggingPrefixLibdnsNetcup, ErrLockFailed, err.Zone, err.Err)
+}
+
+// Unwrap returns the error of the Locker.
+func (err *LockError) Unwrap() error {
+	return err.Err
+}
+
+// Is makes errors.Is(err, ErrLockFailed) true.
+func (err *LockError) Is(target error) bool {
+	return target == ErrLockFailed
+}
+
+// Retryable reports, that the operation can be retried, since it didn't change anything.
+func (err *LockError) Retryable() bool {
+	return true
+}
+
+// Locks the zone for a mutating operation: always in-process and, if a Locker is set, with the Locker.
+// The returned function releases both locks.
+func (p *Provider) lockZone(ctx context.Context, zone string) (unlock func(), err error) {
+	unlockInProcess, err := p.lockZoneInProcess(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if p.Locker == nil {
+		return unlockInProcess, nil
+	}
+
+	unlockZone, err := p.Locker.Lock(ctx, normalizeZone(zone))
+	if err != nil {
+		unlockInProcess()
+		return nil, &LockError{Zone: zone, Err: err}
+	}
+
+	return func() {
+		unlockZone()
+		unlockInProcess()
+	}, nil
+}
+
+// Locks the zone in-process, so the calls for the zone are serialized, while calls for other zones run concurrently.
+// The wait for the lock ends with the context. The call counts as in progress until it is unlocked, so Close can wait
+// for it, and fails with ErrProviderClosed, if Close is already waiting for the calls.
+func (p *Provider) lockZoneInProcess(ctx context.Context, zone string) (unlock func(), err error) {
+	p.operationsMutex.Lock()
+	if p.callsClosed {
+		p.operationsMutex.Unlock()
+		return nil, ErrProviderClosed
+	}
+	p.callsGroup.Add(1)
+	p.operationsMutex.Unlock()
+
+	lock := p.zoneLock(zone)
+	select {
+	case lock <- struct{}{}:
+	case <-ctx.Done():
+		p.callsGroup.Done()
+		return nil, fmt.Errorf("%v waiting for the lock of zone %v: %w", loggingPrefixLibdnsNetcup, zone, ctx.Err())
+	}
+	return func() {
+		<-lock
+		p.callsGroup.Done()
+	}, nil
+}
+
+// Returns the lock of the zone, a channel with a capacity of one, which is created on the first call for the zone and
+// kept for later calls.
+func (p *Provider) zoneLock(zone string) chan struct{} {
+	p.zoneLocksMutex.Lock()
+	defer p.zoneLocksMutex.Unlock()
+	key := normalizeZone(zone)
+	lock, found := p.zoneLocks[key]
+	if !found {
+		if p.zoneLocks == nil {
+			p.zoneLocks = make(map[string]chan struct{})
+		}
+		lock = make(chan struct{}, 1)
+		p.zoneLocks[key] = lock
+	}
+	return lock
+}
@@ -0,0 +1,166 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// memoryLocker is an in-memory Locker, that can be shared by multiple providers like a lock in a database.
+type memoryLocker struct {
+	mutex sync.Mutex
+	locks map[string]chan struct{}
+}
+
+func (l *memoryLocker) Lock(ctx context.Context, zone string) (func(), error) {
+	l.mutex.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]chan struct{})
+	}
+	lock, ok := l.locks[zone]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		l.locks[zone] = lock
+	}
+	l.mutex.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return func() {
+		<-lock
+	}, nil
+}
+
+func TestProvider_LockerSerializesProviders(t *testing.T) {
+	first, server := newFakeProvider(t)
+	second := &Provider{CustomerNumber: first.CustomerNumber, APIKey: first.APIKey, APIPassword: first.APIPassword, Endpoint: first.Endpoint, AllowInsecureEndpoint: true}
+	locker := &memoryLocker{}
+	first.Locker = locker
+	second.Locker = locker
+	// every operation has its own session
+	first.SessionIdleTimeout = -1
+	second.SessionIdleTimeout = -1
+	// the update takes a while, so without the lock the operations of both providers would overlap
+	server.SetLatency("updateDnsRecords", 20*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		p := first
+		if i%2 == 1 {
+			p = second
+		}
+		record := libdns.Record{Type: "TXT", Name: "@", Value: fmt.Sprintf("token%d", i)}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{record}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// serialized operations never have two sessions at the same time
+	sessions := 0
+	for _, action := range server.Actions() {
+		switch action {
+		case "login":
+			sessions++
+			if sessions > 1 {
+				t.Fatalf("Operations overlapped: %v", server.Actions())
+			}
+		case "logout":
+			sessions--
+		}
+	}
+	if records := server.Records(fakeZone); len(records) != 10 {
+		t.Fatalf("Expected 10 records, got %v", len(records))
+	}
+}
+
+// failingLocker fails to lock every zone
+type failingLocker struct{}
+
+func (failingLocker) Lock(ctx context.Context, zone string) (func(), error) {
+	return nil, errors.New("lock service unavailable")
+}
+
+func TestProvider_LockerFailure(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.Locker = failingLocker{}
+
+	_, err := p.SetRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}})
+	var lockErr *LockError
+	if !errors.Is(err, ErrLockFailed) || !errors.As(err, &lockErr) || !lockErr.Retryable() || lockErr.Zone != fakeZone {
+		t.Fatalf("Expected a retryable LockError for zone %v, got %v", fakeZone, err)
+	}
+	if calls := server.Calls(); len(calls) != 0 {
+		t.Fatalf("Expected no API calls without lock, got %v", server.Actions())
+	}
+
+	// the in-process lock must be released after the failure
+	p.Locker = nil
+	if _, err = p.SetRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvider_ZonesAreLockedSeparately(t *testing.T) {
+	p, server := newFakeProvider(t)
+	server.AddZone("example.org", 86400)
+	ctx := context.Background()
+
+	// a slow call for example.com holds its lock
+	unlock, err := p.lockZoneInProcess(ctx, "Example.COM")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// calls for another zone aren't blocked
+	if _, err := p.AppendRecords(ctx, "example.org", []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// calls for the same zone wait, also with another spelling of its name
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.GetRecords(ctx, fakeZone+".")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Expected the call for the locked zone to wait, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvider_ZoneLockWaitEndsWithContext(t *testing.T) {
+	p, _ := newFakeProvider(t)
+	p.OperationTimeout = 50 * time.Millisecond
+	unlock, err := p.lockZoneInProcess(context.Background(), fakeZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	start := time.Now()
+	if _, err := p.GetRecords(context.Background(), fakeZone); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the wait for the lock to end with the operation timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("Expected the call to return after the operation timeout, took %v", elapsed)
+	}
+}
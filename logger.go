@@ -0,0 +1,95 @@
+// Diagnostic output of the provider
+
+package netcup
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Logger receives the diagnostic messages of the provider, like the requests sent and the failures, that don't fail the
+// operation. A *log.Logger can be used, and NewSlogLogger adapts a *slog.Logger. The messages start with the prefix
+// "[libdns_netcup]" or, for the messages of the netcup API, "[netcup]".
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logLevel is the severity of a message for structured loggers
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// logAttr is an attribute of a structured log entry
+type logAttr struct {
+	key   string
+	value interface{}
+}
+
+// structuredLogger is implemented by Loggers, which take entries with a level and attributes, like the one of NewSlogLogger.
+type structuredLogger interface {
+	logEntry(ctx context.Context, level logLevel, msg string, attrs []logAttr)
+}
+
+// Logs the message with Logger at the given level, if it is set.
+// With Quiet only warnings and failures are logged.
+func (p *Provider) logAt(level logLevel, format string, v ...interface{}) {
+	if p.Logger == nil || p.Quiet && level < levelWarn {
+		return
+	}
+	if logger, ok := p.Logger.(structuredLogger); ok {
+		logger.logEntry(context.Background(), level, fmt.Sprintf(format, v...), nil)
+		return
+	}
+	p.Logger.Printf(format, v...)
+}
+
+// Logs the message with Logger, if it is set.
+func (p *Provider) logf(format string, v ...interface{}) {
+	p.logAt(levelInfo, format, v...)
+}
+
+// Logs a problem, that doesn't fail the operation, with Logger, if it is set.
+func (p *Provider) warnf(format string, v ...interface{}) {
+	p.logAt(levelWarn, format, v...)
+}
+
+// Logs a failure with Logger, if it is set.
+func (p *Provider) errorf(format string, v ...interface{}) {
+	p.logAt(levelError, format, v...)
+}
+
+// Logs an attempt of a request. A structured logger gets every attempt with its action, zone, duration, status code and
+// client request ID, at debug level or at warn level, if it failed. Other loggers get the message of netcup after
+// successful requests. With Quiet only failed attempts are logged. Credentials and session IDs are never logged.
+func (p *Provider) logRequest(ctx context.Context, req request, res *response, duration time.Duration, err error) {
+	if p.Logger == nil || p.Quiet && err == nil {
+		return
+	}
+	logger, ok := p.Logger.(structuredLogger)
+	if !ok {
+		if err == nil && res != nil {
+			p.Logger.Printf("%v %v: %v", loggingPrefixNetcup, res.ShortMessage, res.LongMessage)
+		}
+		return
+	}
+
+	attrs := []logAttr{{"action", req.Action}}
+	if req.Param.DomainName != "" {
+		attrs = append(attrs, logAttr{"zone", req.Param.DomainName})
+	}
+	attrs = append(attrs, logAttr{"duration", duration}, logAttr{"clientrequestid", req.Param.ClientRequestID})
+	if res != nil {
+		attrs = append(attrs, logAttr{"statuscode", res.StatusCode}, logAttr{"message", res.ShortMessage})
+	}
+	if err != nil {
+		logger.logEntry(ctx, levelWarn, "netcup request failed", append(attrs, logAttr{"error", err.Error()}))
+		return
+	}
+	logger.logEntry(ctx, levelDebug, "netcup request", attrs)
+}
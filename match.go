@@ -0,0 +1,79 @@
+// Policies for matching input records with existing records
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MatchPolicy determines, how the input records of AppendRecords, SetRecords and DeleteRecords are matched with
+// the existing records of the zone. An input record with an ID always matches the record with that ID.
+type MatchPolicy int
+
+const (
+	// MatchDefault uses the match policy of the provider, or MatchByNameType if that isn't set either.
+	MatchDefault MatchPolicy = iota
+	// MatchByNameType matches input records without ID by host name and type (and priority for MX records).
+	// SetRecords replaces all records with the host name and type of an input record, AppendRecords skips input records
+	// equal to an existing record and DeleteRecords deletes the record with the host name and type, or all records
+	// with the value, if one is given. If DeleteRecords finds multiple records without a value to tell them apart,
+	// it fails with ErrAmbiguousMatch.
+	MatchByNameType
+	// MatchByIDOnly matches input records only by ID. Input records without ID are always added by AppendRecords and
+	// SetRecords, and rejected by DeleteRecords.
+	MatchByIDOnly
+	// MatchByNameTypeValue matches input records without ID by host name, type, priority and value. SetRecords only adds
+	// records, that don't exist yet, and never changes or deletes other records with the same host name and type.
+	// DeleteRecords needs the value of input records without ID.
+	MatchByNameTypeValue
+)
+
+// ErrAmbiguousMatch is returned (wrapped), if an input record can't be matched to a single existing record with the match policy.
+var ErrAmbiguousMatch = errors.New("ambiguous record match")
+
+var matchPolicyNames = map[MatchPolicy]string{
+	MatchDefault:         "",
+	MatchByNameType:      "by_name_type",
+	MatchByIDOnly:        "by_id_only",
+	MatchByNameTypeValue: "by_name_type_value",
+}
+
+// String returns the name of the policy as used in JSON, for example "by_name_type".
+func (policy MatchPolicy) String() string {
+	if name, ok := matchPolicyNames[policy]; ok {
+		return name
+	}
+	return fmt.Sprintf("MatchPolicy(%d)", int(policy))
+}
+
+// MarshalText encodes the policy as its name.
+func (policy MatchPolicy) MarshalText() ([]byte, error) {
+	if _, ok := matchPolicyNames[policy]; !ok {
+		return nil, fmt.Errorf("%v unknown match policy %d", loggingPrefixLibdnsNetcup, int(policy))
+	}
+	return []byte(policy.String()), nil
+}
+
+// UnmarshalText decodes the policy from its name.
+func (policy *MatchPolicy) UnmarshalText(text []byte) error {
+	for candidate, name := range matchPolicyNames {
+		if name == string(text) {
+			*policy = candidate
+			return nil
+		}
+	}
+	return fmt.Errorf("%v unknown match policy %q", loggingPrefixLibdnsNetcup, text)
+}
+
+// Returns the match policy of the call, which is the one of the call options, the provider or MatchByNameType.
+func (p *Provider) matchPolicy(ctx context.Context) MatchPolicy {
+	if policy := callOptions(ctx).MatchPolicy; policy != MatchDefault {
+		return policy
+	}
+	if p.MatchPolicy != MatchDefault {
+		return p.MatchPolicy
+	}
+	return MatchByNameType
+}
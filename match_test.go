@@ -0,0 +1,153 @@
+package netcup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+var matchPolicyZone = []netcuptest.Record{
+	{ID: "1", HostName: "www", Type: "A", Destination: "192.0.2.1"},
+	{ID: "2", HostName: "www", Type: "A", Destination: "192.0.2.2"},
+	{ID: "3", HostName: "mail", Type: "A", Destination: "192.0.2.10"},
+}
+
+func TestProvider_MatchPolicy(t *testing.T) {
+	type operation func(p *Provider, ctx context.Context, records []libdns.Record) error
+	set := func(p *Provider, ctx context.Context, records []libdns.Record) error {
+		_, err := p.SetRecords(ctx, fakeZone, records)
+		return err
+	}
+	appendRecords := func(p *Provider, ctx context.Context, records []libdns.Record) error {
+		_, err := p.AppendRecords(ctx, fakeZone, records)
+		return err
+	}
+	deleteRecords := func(p *Provider, ctx context.Context, records []libdns.Record) error {
+		_, err := p.DeleteRecords(ctx, fakeZone, records)
+		return err
+	}
+
+	tests := []struct {
+		name      string
+		operation operation
+		batch     []libdns.Record
+		// expected zone or error per policy
+		expected map[MatchPolicy][]string
+		errs     map[MatchPolicy]error
+	}{
+		{
+			name:      "SetRecords",
+			operation: set,
+			batch:     []libdns.Record{{Type: "A", Name: "www", Value: "192.0.2.3"}, {Type: "A", Name: "mail", Value: "192.0.2.10"}},
+			expected: map[MatchPolicy][]string{
+				MatchByNameType:      {"mail A 0 192.0.2.10", "www A 0 192.0.2.3"},
+				MatchByIDOnly:        {"mail A 0 192.0.2.10", "mail A 0 192.0.2.10", "www A 0 192.0.2.1", "www A 0 192.0.2.2", "www A 0 192.0.2.3"},
+				MatchByNameTypeValue: {"mail A 0 192.0.2.10", "www A 0 192.0.2.1", "www A 0 192.0.2.2", "www A 0 192.0.2.3"},
+			},
+		},
+		{
+			name:      "AppendRecords",
+			operation: appendRecords,
+			batch:     []libdns.Record{{Type: "A", Name: "www", Value: "192.0.2.1"}},
+			expected: map[MatchPolicy][]string{
+				MatchByNameType:      {"mail A 0 192.0.2.10", "www A 0 192.0.2.1", "www A 0 192.0.2.2"},
+				MatchByIDOnly:        {"mail A 0 192.0.2.10", "www A 0 192.0.2.1", "www A 0 192.0.2.1", "www A 0 192.0.2.2"},
+				MatchByNameTypeValue: {"mail A 0 192.0.2.10", "www A 0 192.0.2.1", "www A 0 192.0.2.2"},
+			},
+		},
+		{
+			name:      "DeleteRecords without value",
+			operation: deleteRecords,
+			batch:     []libdns.Record{{Type: "A", Name: "www"}},
+			errs: map[MatchPolicy]error{
+				MatchByNameType:      ErrAmbiguousMatch,
+				MatchByIDOnly:        errAny,
+				MatchByNameTypeValue: errAny,
+			},
+		},
+		{
+			name:      "DeleteRecords with value",
+			operation: deleteRecords,
+			batch:     []libdns.Record{{Type: "A", Name: "www", Value: "192.0.2.1"}},
+			expected: map[MatchPolicy][]string{
+				MatchByNameType:      {"mail A 0 192.0.2.10", "www A 0 192.0.2.2"},
+				MatchByNameTypeValue: {"mail A 0 192.0.2.10", "www A 0 192.0.2.2"},
+			},
+			errs: map[MatchPolicy]error{
+				MatchByIDOnly: errAny,
+			},
+		},
+		{
+			name:      "DeleteRecords of a single candidate",
+			operation: deleteRecords,
+			batch:     []libdns.Record{{Type: "A", Name: "mail"}},
+			expected: map[MatchPolicy][]string{
+				MatchByNameType: {"www A 0 192.0.2.1", "www A 0 192.0.2.2"},
+			},
+			errs: map[MatchPolicy]error{
+				MatchByIDOnly:        errAny,
+				MatchByNameTypeValue: errAny,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, policy := range []MatchPolicy{MatchByNameType, MatchByIDOnly, MatchByNameTypeValue} {
+			t.Run(tt.name+" "+policy.String(), func(t *testing.T) {
+				p, server := newFakeProvider(t, matchPolicyZone...)
+				p.MatchPolicy = policy
+
+				err := tt.operation(p, context.Background(), tt.batch)
+				if expectedErr, ok := tt.errs[policy]; ok {
+					if err == nil || (expectedErr != errAny && !errors.Is(err, expectedErr)) {
+						t.Fatalf("Expected error %v, got %v", expectedErr, err)
+					}
+					if count := server.CallCount("updateDnsRecords"); count != 0 {
+						t.Fatalf("No update expected after an error, got %v", count)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if zone := canonical(server.Records(fakeZone)); !reflect.DeepEqual(zone, tt.expected[policy]) {
+					t.Fatalf("Expected zone %v, got %v", tt.expected[policy], zone)
+				}
+			})
+		}
+	}
+}
+
+// errAny matches any error in TestProvider_MatchPolicy
+var errAny = errors.New("any error")
+
+func TestProvider_MatchPolicyCallOption(t *testing.T) {
+	p, server := newFakeProvider(t, matchPolicyZone...)
+	p.MatchPolicy = MatchByIDOnly
+
+	ctx := WithCallOptions(context.Background(), CallOptions{MatchPolicy: MatchByNameType})
+	if _, err := p.DeleteRecords(ctx, fakeZone, []libdns.Record{{Type: "A", Name: "mail"}}); err != nil {
+		t.Fatalf("The match policy of the call should override the one of the provider, got %v", err)
+	}
+	if records := server.Records(fakeZone); len(records) != 2 {
+		t.Fatalf("Expected the mail record to be deleted, got %+v", records)
+	}
+}
+
+func TestMatchPolicy_JSON(t *testing.T) {
+	var p Provider
+	if err := json.Unmarshal([]byte(`{"match_policy": "by_name_type_value"}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.MatchPolicy != MatchByNameTypeValue {
+		t.Fatalf("Expected MatchByNameTypeValue, got %v", p.MatchPolicy)
+	}
+	if err := json.Unmarshal([]byte(`{"match_policy": "by_guess"}`), &p); err == nil {
+		t.Fatal("Expected an error for an unknown match policy")
+	}
+}
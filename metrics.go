@@ -0,0 +1,52 @@
+// Metrics of the requests to netcup, for example for Prometheus
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Metrics receives measurements of the operations of the provider and their requests to netcup, for example to export
+// them to Prometheus without a dependency of the provider on it. The package prometheus of this module is an adapter.
+// The methods are called concurrently and on the goroutine of the operation, so they should return quickly.
+type Metrics interface {
+	// ObserveOperation is called at the end of every operation, like the libdns methods, with its name like "get",
+	// "append", "set", "delete" or "sync", its duration and its error, nil if it succeeded.
+	ObserveOperation(operation string, duration time.Duration, err error)
+	// ObserveRequest is called after every request to netcup with its action, like "login" or "updateDnsRecords", the
+	// time until the response was read and its error, nil if it succeeded. Retries are requests of their own.
+	ObserveRequest(action string, duration time.Duration, err error)
+	// IncRetry is called before a failed request is sent again.
+	IncRetry(action string)
+}
+
+// ErrorStatus returns a short label of the error of an operation or request for metrics: "ok" for nil, the status code
+// of netcup like "4013" for an APIError, "http_503" for an unexpected HTTP status, "timeout" and "canceled" for the
+// errors of the context, "network" for network errors and "error" for all others.
+func ErrorStatus(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return strconv.Itoa(apiErr.StatusCode)
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return "http_" + strconv.Itoa(statusErr.StatusCode)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	var transportErr *transportError
+	if errors.As(err, &transportErr) {
+		return "network"
+	}
+	return "error"
+}
@@ -0,0 +1,123 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// recordingMetrics records the observations as "operation name status" and "request action status" and the retries.
+type recordingMetrics struct {
+	mutex        sync.Mutex
+	observations []string
+	retries      []string
+}
+
+func (metrics *recordingMetrics) ObserveOperation(operation string, duration time.Duration, err error) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.observations = append(metrics.observations, fmt.Sprintf("operation %v %v", operation, ErrorStatus(err)))
+}
+
+func (metrics *recordingMetrics) ObserveRequest(action string, duration time.Duration, err error) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.observations = append(metrics.observations, fmt.Sprintf("request %v %v", action, ErrorStatus(err)))
+}
+
+func (metrics *recordingMetrics) IncRetry(action string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.retries = append(metrics.retries, action)
+}
+
+// Returns the number of observations.
+func (metrics *recordingMetrics) count(observation string) int {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	var count int
+	for _, recorded := range metrics.observations {
+		if recorded == observation {
+			count++
+		}
+	}
+	return count
+}
+
+func TestProvider_Metrics(t *testing.T) {
+	p, server := newFakeProvider(t)
+	metrics := &recordingMetrics{}
+	p.Metrics = metrics
+	ctx := context.Background()
+	record := libdns.Record{Type: "TXT", Name: "@", Value: "token"}
+
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{record}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SetRecords(ctx, fakeZone, []libdns.Record{record}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DeleteRecords(ctx, fakeZone, []libdns.Record{record}); err != nil {
+		t.Fatal(err)
+	}
+	// all four libdns methods are observed
+	for _, operation := range []string{"get", "append", "set", "delete"} {
+		if count := metrics.count("operation " + operation + " ok"); count != 1 {
+			t.Fatalf("Expected the operation %v to be observed once, got %v", operation, metrics.observations)
+		}
+	}
+	// as well as every request
+	for _, action := range []string{"login", "infoDnsZone", "infoDnsRecords", "updateDnsRecords"} {
+		if count := metrics.count("request " + action + " ok"); count != server.CallCount(action) {
+			t.Fatalf("Expected %v requests %v, got %v", server.CallCount(action), action, metrics.observations)
+		}
+	}
+}
+
+func TestProvider_MetricsFailures(t *testing.T) {
+	p, server := newFakeProvider(t)
+	metrics := &recordingMetrics{}
+	p.Metrics = metrics
+	p.RetryPolicy = RetryPolicy{BaseDelay: time.Millisecond}
+	server.FailNext("infoDnsRecords", netcuptest.Failure{HTTPStatusCode: 503, ShortMessage: "Service Unavailable"})
+	server.FailNext("updateDnsRecords", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error.", LongMessage: "Something is wrong."})
+
+	_, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}})
+	if err == nil {
+		t.Fatal("Expected the rejected update to fail")
+	}
+	status := fmt.Sprint(netcuptest.StatusValidationError)
+	if metrics.count("request infoDnsRecords http_503") != 1 || metrics.count("request updateDnsRecords "+status) != 1 || metrics.count("operation append "+status) != 1 {
+		t.Fatalf("Expected the failures by status, got %v", metrics.observations)
+	}
+	if len(metrics.retries) != 1 || metrics.retries[0] != "infoDnsRecords" {
+		t.Fatalf("Expected the retry of infoDnsRecords, got %v", metrics.retries)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := map[error]string{
+		nil:                         "ok",
+		&APIError{StatusCode: 4013}: "4013",
+		&ProviderError{Action: "login", Err: &APIError{StatusCode: 4013}}:                    "4013",
+		&ProviderError{Action: "login", Err: &httpStatusError{StatusCode: 502}}:              "http_502",
+		&ProviderError{Action: "login", Err: &transportError{err: context.DeadlineExceeded}}: "timeout",
+		context.Canceled: "canceled",
+		&transportError{err: errors.New("connection refused")}: "network",
+		ErrZoneNotAllowed: "error",
+	}
+	for err, expected := range tests {
+		if status := ErrorStatus(err); status != expected {
+			t.Errorf("ErrorStatus(%v) = %v, expected %v", err, status, expected)
+		}
+	}
+}
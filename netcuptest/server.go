@@ -0,0 +1,600 @@
+// Package netcuptest provides a fake netcup DNS API server for tests.
+//
+// The server implements the subset of the netcup CCP API used by the netcup provider
+// (login, logout, listallDomains, infoDnsZone, infoDnsRecords, updateDnsRecords and updateDnsZone) and keeps
+// the zones in memory. It records every call, so tests can make assertions about the
+// requests sent by the provider, and it can inject latency and failures.
+package netcuptest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status codes used by the fake server in its responses.
+const (
+	StatusSuccess         = 2000
+	StatusInvalidSession  = 4001
+	StatusValidationError = 4013
+	StatusZoneNotFound    = 5029
+)
+
+// Record is a DNS record as it is stored by the fake server.
+type Record struct {
+	ID          string
+	HostName    string
+	Type        string
+	Priority    int
+	Destination string
+	// State is reported by infoDnsRecords, "yes" if it is empty. It is kept, when the record is updated.
+	State string
+}
+
+// Zone is a DNS zone as it is stored by the fake server.
+type Zone struct {
+	Name    string
+	TTL     int64
+	Serial  string
+	Records []Record
+}
+
+// Call is a request received by the fake server.
+type Call struct {
+	Action string
+	Param  json.RawMessage
+}
+
+// Failure describes an error response, which is returned instead of handling the request.
+type Failure struct {
+	StatusCode   int
+	ShortMessage string
+	LongMessage  string
+	// HTTPStatusCode answers the request with this HTTP status and ShortMessage as plain text body instead, if it is set
+	HTTPStatusCode int
+	// RetryAfter is sent as Retry-After header, if it is set
+	RetryAfter string
+	// CloseConnection closes the connection without a response instead, like a dropped connection, if it is set
+	CloseConnection bool
+}
+
+// Server is a fake netcup DNS API server. All methods are safe for concurrent use.
+type Server struct {
+	// URL of the fake endpoint
+	URL string
+
+	server        *httptest.Server
+	mutex         sync.Mutex
+	zones         map[string]*Zone
+	sessions      map[string]bool
+	calls         []Call
+	latency       map[string]time.Duration
+	failures      map[string][]Failure
+	responses     map[string][]interface{}
+	nextSessionID int
+	nextRecordID  int
+	// compression of the responses with gzip, if the client accepts it
+	compression bool
+	// credentials accepted by login, if set
+	credentials *[3]string
+}
+
+type record struct {
+	ID           string `json:"id"`
+	HostName     string `json:"hostname"`
+	Type         string `json:"type"`
+	Priority     string `json:"priority"`
+	Destination  string `json:"destination"`
+	DeleteRecord bool   `json:"deleterecord"`
+	State        string `json:"state"`
+}
+
+type recordSet struct {
+	DNSRecords []record `json:"dnsrecords"`
+}
+
+type zone struct {
+	Name         string `json:"name"`
+	TTL          string `json:"ttl"`
+	Serial       string `json:"serial"`
+	Refresh      string `json:"refresh"`
+	Retry        string `json:"retry"`
+	Expire       string `json:"expire"`
+	DNSSECStatus bool   `json:"dnssecstatus"`
+}
+
+type param struct {
+	DomainName      string     `json:"domainname"`
+	CustomerNumber  string     `json:"customernumber"`
+	APIKey          string     `json:"apikey"`
+	APIPassword     string     `json:"apipassword"`
+	APISessionID    string     `json:"apisessionid"`
+	DNSRecordSet    *recordSet `json:"dnsrecordset"`
+	DNSZone         *zone      `json:"dnszone"`
+	ClientRequestID string     `json:"clientrequestid"`
+}
+
+type request struct {
+	Action string          `json:"action"`
+	Param  json.RawMessage `json:"param"`
+}
+
+type response struct {
+	ServerRequestID string      `json:"serverrequestid"`
+	ClientRequestID string      `json:"clientrequestid"`
+	Action          string      `json:"action"`
+	Status          string      `json:"status"`
+	StatusCode      int         `json:"statuscode"`
+	ShortMessage    string      `json:"shortmessage"`
+	LongMessage     string      `json:"longmessage"`
+	ResponseData    interface{} `json:"responsedata"`
+}
+
+// NewServer starts a fake netcup DNS API server without any zones.
+// It has to be closed with Close.
+func NewServer() *Server {
+	s := &Server{
+		zones:     make(map[string]*Zone),
+		sessions:  make(map[string]bool),
+		latency:   make(map[string]time.Duration),
+		failures:  make(map[string][]Failure),
+		responses: make(map[string][]interface{}),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client returns an HTTP client, that sends all requests to the fake server, regardless of their URL.
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{Transport: &rewriteTransport{target: target, base: http.DefaultTransport}}
+}
+
+// AddZone adds a zone with the given TTL and records. Records without an ID get a generated one.
+func (s *Server) AddZone(name string, ttl int64, records ...Record) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z := &Zone{Name: name, TTL: ttl, Serial: "2022011201"}
+	for _, rec := range records {
+		if rec.ID == "" {
+			rec.ID = s.newRecordID()
+		} else if id, err := strconv.Atoi(rec.ID); err == nil && id > s.nextRecordID {
+			// generated IDs must not collide with the given ones
+			s.nextRecordID = id
+		}
+		z.Records = append(z.Records, rec)
+	}
+	s.zones[name] = z
+}
+
+// Zone returns a copy of the zone with the given name.
+func (s *Server) Zone(name string) (Zone, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z, ok := s.zones[name]
+	if !ok {
+		return Zone{}, false
+	}
+	zoneCopy := *z
+	zoneCopy.Records = append([]Record(nil), z.Records...)
+
+	return zoneCopy, true
+}
+
+// Records returns a copy of the records of the zone with the given name.
+func (s *Server) Records(name string) []Record {
+	z, _ := s.Zone(name)
+	return z.Records
+}
+
+// Calls returns all calls received so far, in the order they were received.
+func (s *Server) Calls() []Call {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Call(nil), s.calls...)
+}
+
+// Actions returns the actions of all calls received so far, in the order they were received.
+func (s *Server) Actions() []string {
+	var actions []string
+	for _, call := range s.Calls() {
+		actions = append(actions, call.Action)
+	}
+	return actions
+}
+
+// CallCount returns the number of calls received for the given action.
+func (s *Server) CallCount(action string) int {
+	count := 0
+	for _, call := range s.Calls() {
+		if call.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// ResetCalls forgets all calls received so far.
+func (s *Server) ResetCalls() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.calls = nil
+}
+
+// SetLatency delays every response to the given action by d. An empty action delays all actions.
+func (s *Server) SetLatency(action string, d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.latency[action] = d
+}
+
+// SetCompression makes the server compress its responses with gzip, if the client sends Accept-Encoding: gzip.
+// Requests compressed with gzip are always accepted.
+func (s *Server) SetCompression(enabled bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.compression = enabled
+}
+
+// FailNext makes the next calls of the given action fail with the given failures, one failure per call.
+func (s *Server) FailNext(action string, failures ...Failure) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failures[action] = append(s.failures[action], failures...)
+}
+
+// RespondNext makes the next calls of the given action succeed with the given response data, one per call,
+// instead of handling the request. The data is encoded as JSON, so it can be used to send responses the
+// fake server wouldn't produce itself, like a zone without TTL.
+func (s *Server) RespondNext(action string, responseData ...interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.responses[action] = append(s.responses[action], responseData...)
+}
+
+// SetCredentials makes login fail for all other credentials than the given ones. By default all credentials are accepted.
+func (s *Server) SetCredentials(customerNumber, apiKey, apiPassword string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.credentials = &[3]string{customerNumber, apiKey, apiPassword}
+}
+
+// ExpireSessions invalidates all sessions, as netcup does after some minutes of inactivity.
+func (s *Server) ExpireSessions() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sessions = make(map[string]bool)
+}
+
+// SessionCount returns the number of sessions, which are logged in.
+func (s *Server) SessionCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.sessions)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var requestBody io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requestBody = reader
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	s.calls = append(s.calls, Call{Action: req.Action, Param: req.Param})
+	delay := s.latency[""] + s.latency[req.Action]
+	s.mutex.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	var failure *Failure
+	if failures := s.failures[req.Action]; len(failures) > 0 {
+		s.failures[req.Action] = failures[1:]
+		failure = &failures[0]
+	}
+	s.mutex.Unlock()
+
+	var res response
+	switch {
+	case failure != nil && failure.CloseConnection:
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			conn.Close()
+		}
+		return
+	case failure != nil && failure.HTTPStatusCode != 0:
+		if failure.RetryAfter != "" {
+			w.Header().Set("Retry-After", failure.RetryAfter)
+		}
+		http.Error(w, failure.ShortMessage, failure.HTTPStatusCode)
+		return
+	case failure != nil:
+		if failure.RetryAfter != "" {
+			w.Header().Set("Retry-After", failure.RetryAfter)
+		}
+		res = errorResponse(failure.StatusCode, failure.ShortMessage, failure.LongMessage)
+	default:
+		res = s.handle(req)
+	}
+	res.Action = req.Action
+	var p param
+	if json.Unmarshal(req.Param, &p) == nil {
+		res.ClientRequestID = p.ClientRequestID
+	}
+	res.ServerRequestID = strconv.Itoa(len(s.Calls()))
+
+	w.Header().Set("Content-Type", "application/json")
+	s.mutex.Lock()
+	compression := s.compression
+	s.mutex.Unlock()
+	if compression && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		writer := gzip.NewWriter(w)
+		defer writer.Close()
+		json.NewEncoder(writer).Encode(res)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) handle(req request) response {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if responses := s.responses[req.Action]; len(responses) > 0 {
+		s.responses[req.Action] = responses[1:]
+		return successResponse("Response set by the test", "Response set by the test.", responses[0])
+	}
+
+	var p param
+	if err := json.Unmarshal(req.Param, &p); err != nil {
+		return errorResponse(StatusValidationError, "Validation Error.", err.Error())
+	}
+
+	if req.Action == "login" {
+		if s.credentials != nil && *s.credentials != [3]string{p.CustomerNumber, p.APIKey, p.APIPassword} {
+			return errorResponse(StatusValidationError, "Validation Error.", "The login to the API failed.")
+		}
+		s.nextSessionID++
+		sessionID := fmt.Sprintf("session%d", s.nextSessionID)
+		s.sessions[sessionID] = true
+		return successResponse("Login successful", "Session has been created successful.", map[string]string{"apisessionid": sessionID})
+	}
+
+	if !s.sessions[p.APISessionID] {
+		return errorResponse(StatusInvalidSession, "The session id is not in a valid format.", "The session id is not in a valid format. Most likely the session expired.")
+	}
+
+	if req.Action == "logout" {
+		delete(s.sessions, p.APISessionID)
+		return successResponse("Logout successful", "Session has been terminated successful.", "")
+	}
+
+	if req.Action == "listallDomains" {
+		var domains []map[string]string
+		for _, name := range s.zoneNames() {
+			domains = append(domains, map[string]string{"domainname": name})
+		}
+		return successResponse("Domains found", "Domains for this customer were found.", domains)
+	}
+
+	z, ok := s.zones[p.DomainName]
+	if !ok {
+		return errorResponse(StatusZoneNotFound, "Can not get DNS records for zone.", fmt.Sprintf("DNS zone %v not found.", p.DomainName))
+	}
+
+	switch req.Action {
+	case "infoDnsZone":
+		return successResponse("DNS zone found", "DNS zone was found.", toWireZone(z))
+	case "infoDnsRecords":
+		return successResponse("DNS records found", "DNS Records for this zone were found.", toWireRecordSet(z.Records))
+	case "updateDnsZone":
+		if p.DNSZone == nil {
+			return errorResponse(StatusValidationError, "Validation Error.", "Value in field dnszone is missing.")
+		}
+		ttl, err := strconv.ParseInt(p.DNSZone.TTL, 10, 64)
+		if err != nil {
+			return errorResponse(StatusValidationError, "Validation Error.", "Value in field ttl does not match requirements of type: ttl.")
+		}
+		z.TTL = ttl
+		return successResponse("DNS zone was updated successfully", "DNS zone was updated successfully.", toWireZone(z))
+	case "updateDnsRecords":
+		if p.DNSRecordSet == nil {
+			return errorResponse(StatusValidationError, "Validation Error.", "Value in field dnsrecordset is missing.")
+		}
+		records, res := s.updateRecords(z.Records, p.DNSRecordSet.DNSRecords)
+		if res != nil {
+			return *res
+		}
+		z.Records = records
+		return successResponse("DNS records successful updated", "The given DNS records for this zone were updated.", toWireRecordSet(z.Records))
+	}
+
+	return errorResponse(StatusValidationError, "Validation Error.", fmt.Sprintf("Unknown action %v.", req.Action))
+}
+
+// zoneNames returns the names of all zones in alphabetical order.
+func (s *Server) zoneNames() []string {
+	names := make([]string, 0, len(s.zones))
+	for name := range s.zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// updateRecords applies the given update to a copy of the records. Like netcup, the whole update fails if one record is invalid.
+func (s *Server) updateRecords(existing []Record, updates []record) ([]Record, *response) {
+	records := append([]Record(nil), existing...)
+	for _, update := range updates {
+		index := -1
+		if update.ID != "" {
+			for i, rec := range records {
+				if rec.ID == update.ID {
+					index = i
+				}
+			}
+			if index < 0 {
+				res := errorResponse(StatusValidationError, "Validation Error.", fmt.Sprintf("DNS record with id %v does not exist.", update.ID))
+				return nil, &res
+			}
+		}
+
+		if update.DeleteRecord {
+			if index < 0 {
+				res := errorResponse(StatusValidationError, "Validation Error.", "Value in field id is missing.")
+				return nil, &res
+			}
+			records = append(records[:index], records[index+1:]...)
+			continue
+		}
+
+		if update.HostName == "" || update.Type == "" || update.Destination == "" {
+			res := errorResponse(StatusValidationError, "Validation Error.", "Value in field hostname, type or destination is missing.")
+			return nil, &res
+		}
+
+		if ip := net.ParseIP(update.Destination); (update.Type == "A" && (ip == nil || ip.To4() == nil)) || (update.Type == "AAAA" && (ip == nil || ip.To4() != nil)) {
+			res := errorResponse(StatusValidationError, "Validation Error.", fmt.Sprintf("Value in field destination does not match requirements of type: %v.", update.Type))
+			return nil, &res
+		}
+
+		priority, _ := strconv.Atoi(update.Priority)
+		rec := Record{
+			ID:          update.ID,
+			HostName:    update.HostName,
+			Type:        update.Type,
+			Priority:    priority,
+			Destination: update.Destination,
+		}
+		if index < 0 {
+			rec.ID = s.newRecordID()
+			records = append(records, rec)
+		} else {
+			// the state is read only
+			rec.State = records[index].State
+			records[index] = rec
+		}
+	}
+
+	return records, nil
+}
+
+func (s *Server) newRecordID() string {
+	s.nextRecordID++
+	return strconv.Itoa(s.nextRecordID)
+}
+
+func toWireZone(z *Zone) zone {
+	return zone{
+		Name:    z.Name,
+		TTL:     strconv.FormatInt(z.TTL, 10),
+		Serial:  z.Serial,
+		Refresh: "28800",
+		Retry:   "7200",
+		Expire:  "1209600",
+	}
+}
+
+func toWireRecordSet(records []Record) recordSet {
+	set := recordSet{DNSRecords: []record{}}
+	for _, rec := range records {
+		state := rec.State
+		if state == "" {
+			state = "yes"
+		}
+		set.DNSRecords = append(set.DNSRecords, record{
+			ID:          rec.ID,
+			HostName:    rec.HostName,
+			Type:        rec.Type,
+			Priority:    strconv.Itoa(rec.Priority),
+			Destination: rec.Destination,
+			State:       state,
+		})
+	}
+	return set
+}
+
+func successResponse(shortMessage, longMessage string, data interface{}) response {
+	return response{
+		Status:       "success",
+		StatusCode:   StatusSuccess,
+		ShortMessage: shortMessage,
+		LongMessage:  longMessage,
+		ResponseData: data,
+	}
+}
+
+func errorResponse(statusCode int, shortMessage, longMessage string) response {
+	return response{
+		Status:       "error",
+		StatusCode:   statusCode,
+		ShortMessage: shortMessage,
+		LongMessage:  longMessage,
+		ResponseData: "",
+	}
+}
+
+// rewriteTransport sends all requests to the target URL.
+type rewriteTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rewritten := req.Clone(req.Context())
+	rewritten.URL.Scheme = t.target.Scheme
+	rewritten.URL.Host = t.target.Host
+	rewritten.Host = t.target.Host
+
+	return t.base.RoundTrip(rewritten)
+}
@@ -0,0 +1,86 @@
+// Audit callback for the changes of records
+
+package netcup
+
+import (
+	"context"
+	"time"
+)
+
+// ChangeEvent describes the changes of the records of a zone made by one operation. It is passed to Provider.OnChange.
+type ChangeEvent struct {
+	// Zone is the name of the zone without trailing dot
+	Zone string
+	// Operation is the name of the operation like "append", "set", "delete" or "sync", as sent with the webhook
+	Operation string
+	// Change contains the appended, updated and deleted records with their IDs, and the values of the updated records
+	// before the change
+	Change ChangeResult
+	// Time is the time of the change
+	Time time.Time
+	// ClientRequestID is the client request ID of the operation, which starts the IDs of its requests to netcup
+	ClientRequestID string
+}
+
+// Passes the changes between the records before and after an update to OnChange, if it is set and records were changed.
+// The events are delivered in order on another goroutine, so OnChange can't block or fail the operation.
+func (p *Provider) notifyChange(ctx context.Context, zone string, operation string, before []dnsRecord, after []dnsRecord, ttl time.Duration) {
+	if p.OnChange == nil {
+		return
+	}
+	change := changeResult(before, after, ttl)
+	if len(change.Appended)+len(change.Updated)+len(change.Deleted) == 0 {
+		return
+	}
+
+	clientRequestID, _ := ctx.Value(clientRequestIDKey{}).(string)
+	event := ChangeEvent{
+		Zone:            zone,
+		Operation:       operation,
+		Change:          *change,
+		Time:            time.Now().UTC(),
+		ClientRequestID: clientRequestID,
+	}
+
+	p.changeEventsMutex.Lock()
+	defer p.changeEventsMutex.Unlock()
+	p.changeEvents = append(p.changeEvents, event)
+	if !p.changeEventsDelivering {
+		p.changeEventsDelivering = true
+		p.changeEventsGroup.Add(1)
+		go p.deliverChangeEvents()
+	}
+}
+
+// Passes the pending events to OnChange, until there are none left.
+func (p *Provider) deliverChangeEvents() {
+	defer p.changeEventsGroup.Done()
+	for {
+		p.changeEventsMutex.Lock()
+		if len(p.changeEvents) == 0 {
+			p.changeEventsDelivering = false
+			p.changeEventsMutex.Unlock()
+			return
+		}
+		event := p.changeEvents[0]
+		p.changeEvents = p.changeEvents[1:]
+		p.changeEventsMutex.Unlock()
+
+		p.callOnChange(event)
+	}
+}
+
+// Calls OnChange with the event. A panic of OnChange is logged and doesn't affect the other events.
+func (p *Provider) callOnChange(event ChangeEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.errorf("%v OnChange panicked for the change of zone %v by %v: %v", loggingPrefixLibdnsNetcup, event.Zone, event.Operation, r)
+		}
+	}()
+	p.OnChange(event)
+}
+
+// Waits until all pending events are passed to OnChange.
+func (p *Provider) waitForChangeEvents() {
+	p.changeEventsGroup.Wait()
+}
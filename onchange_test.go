@@ -0,0 +1,128 @@
+package netcup
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+func TestProvider_OnChange(t *testing.T) {
+	p, _ := newFakeProvider(t,
+		netcuptest.Record{ID: "1", HostName: "www", Type: "A", Destination: "192.0.2.1"},
+		netcuptest.Record{ID: "2", HostName: "mail", Type: "A", Destination: "192.0.2.2"},
+	)
+	var mutex sync.Mutex
+	var events []ChangeEvent
+	p.OnChange = func(event ChangeEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, event)
+	}
+	ctx := context.Background()
+
+	if _, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+	// the IDs of the records are enough for the change, but OnChange needs the old values
+	if _, err := p.SetRecords(ctx, fakeZone, []libdns.Record{{ID: "1", Type: "A", Name: "www", Value: "192.0.2.3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DeleteRecords(ctx, fakeZone, []libdns.Record{{ID: "2", Type: "A", Name: "mail", Value: "192.0.2.2"}}); err != nil {
+		t.Fatal(err)
+	}
+	// nothing is changed, so there is no event
+	if _, err := p.DeleteRecords(ctx, fakeZone, []libdns.Record{{Type: "A", Name: "missing", Value: "192.0.2.9"}}); err != nil {
+		t.Fatal(err)
+	}
+	p.waitForChangeEvents()
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %+v", events)
+	}
+	for _, event := range events {
+		if event.Zone != fakeZone || event.Time.IsZero() || event.ClientRequestID == "" {
+			t.Fatalf("Unexpected event %+v", event)
+		}
+	}
+	if append := events[0]; append.Operation != "append" || len(append.Change.Appended) != 1 || append.Change.Appended[0].Value != "token" || append.Change.Appended[0].ID == "" {
+		t.Fatalf("Expected the appended record with its ID, got %+v", append)
+	}
+	if set := events[1]; set.Operation != "set" || len(set.Change.Updated) != 1 || set.Change.Updated[0].Value != "192.0.2.3" || set.Change.Previous[0].Value != "192.0.2.1" {
+		t.Fatalf("Expected the updated record with its old value, got %+v", set)
+	}
+	if deleted := events[2]; deleted.Operation != "delete" || len(deleted.Change.Deleted) != 1 || deleted.Change.Deleted[0].ID != "2" {
+		t.Fatalf("Expected the deleted record, got %+v", deleted)
+	}
+}
+
+func TestProvider_OnChangePanic(t *testing.T) {
+	p, server := newFakeProvider(t)
+	logger := &recordingLogger{}
+	p.Logger = logger
+	calls := make(chan ChangeEvent, 2)
+	p.OnChange = func(event ChangeEvent) {
+		calls <- event
+		panic("audit log unavailable")
+	}
+	ctx := context.Background()
+
+	for _, value := range []string{"first", "second"} {
+		if _, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: value, Value: "token"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.waitForChangeEvents()
+	if records := server.Records(fakeZone); len(records) != 2 {
+		t.Fatalf("Expected the records to be appended, got %+v", records)
+	}
+	// the panic doesn't stop the delivery of the next event
+	if len(calls) != 2 {
+		t.Fatalf("Expected OnChange to be called for both changes, got %v calls", len(calls))
+	}
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	var logged bool
+	for _, message := range logger.messages {
+		logged = logged || strings.Contains(message, "OnChange panicked")
+	}
+	if !logged {
+		t.Fatalf("Expected the panic to be logged, got %q", logger.messages)
+	}
+}
+
+func TestProvider_OnChangeDoesNotBlock(t *testing.T) {
+	p, _ := newFakeProvider(t)
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	var names []string
+	p.OnChange = func(event ChangeEvent) {
+		<-release
+		mutex.Lock()
+		defer mutex.Unlock()
+		names = append(names, event.Change.Appended[0].Name)
+	}
+	ctx := context.Background()
+
+	start := time.Now()
+	for _, name := range []string{"first", "second", "third"} {
+		if _, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: name, Value: "token"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the operations not to wait for OnChange, took %v", elapsed)
+	}
+	close(release)
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the events are delivered in the order of the changes
+	if len(names) != 3 || names[0] != "first" || names[1] != "second" || names[2] != "third" {
+		t.Fatalf("Expected the events in order, got %v", names)
+	}
+}
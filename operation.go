@@ -0,0 +1,164 @@
+// Asynchronous operations with progress handles
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/libdns/libdns"
+)
+
+// ErrProviderClosed is returned when an operation is started or a call is made after Provider.Close.
+var ErrProviderClosed = errors.New("provider is closed")
+
+// Operation is the handle of an operation running in the background. It is safe for concurrent use.
+type Operation struct {
+	cancel context.CancelFunc
+	// closed, when the operation is finished and the result is set
+	done chan struct{}
+
+	mutex  sync.Mutex
+	sent   int
+	total  int
+	result *ChangeResult
+	err    error
+}
+
+// Progress returns the number of records sent to netcup so far and the total number of records to send.
+// The total is 0, until the changes are computed.
+func (op *Operation) Progress() (done, total int) {
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+	return op.sent, op.total
+}
+
+// Done returns a channel, that is closed when the operation is finished.
+func (op *Operation) Done() <-chan struct{} {
+	return op.done
+}
+
+// Result waits for the operation to finish and returns its result. If the operation failed or was canceled
+// after some changes were sent, the result contains these changes along with the error.
+func (op *Operation) Result() (*ChangeResult, error) {
+	<-op.done
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+	return op.result, op.err
+}
+
+// Cancel stops the operation before the next chunk of changes is sent. It doesn't wait for the operation to finish.
+func (op *Operation) Cancel() {
+	op.cancel()
+}
+
+func (op *Operation) setProgress(done, total int) {
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+	op.sent, op.total = done, total
+}
+
+// StartSync starts SyncRecords in the background and returns its handle. The operation ends when ctx is done,
+// it is canceled or the provider is closed.
+func (p *Provider) StartSync(ctx context.Context, zone string, desired []libdns.Record, options SyncOptions) (*Operation, error) {
+	return p.startOperation(ctx, func(ctx context.Context, op *Operation) (*ChangeResult, error) {
+		return p.syncRecords(ctx, zone, desired, options, op.setProgress)
+	})
+}
+
+// Runs the operation in a goroutine, that is managed by the provider.
+func (p *Provider) startOperation(ctx context.Context, run func(context.Context, *Operation) (*ChangeResult, error)) (*Operation, error) {
+	p.operationsMutex.Lock()
+	defer p.operationsMutex.Unlock()
+	if p.closed {
+		return nil, ErrProviderClosed
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	op := &Operation{cancel: cancel, done: make(chan struct{})}
+	if p.operations == nil {
+		p.operations = make(map[*Operation]struct{})
+	}
+	p.operations[op] = struct{}{}
+	p.operationsGroup.Add(1)
+
+	go func() {
+		defer p.operationsGroup.Done()
+		result, err := run(ctx, op)
+		cancel()
+
+		op.mutex.Lock()
+		op.result, op.err = result, err
+		op.mutex.Unlock()
+		close(op.done)
+
+		p.operationsMutex.Lock()
+		delete(p.operations, op)
+		p.operationsMutex.Unlock()
+	}()
+
+	return op, nil
+}
+
+// Close shuts the provider down: it cancels all running operations, applies the open coalesce windows, waits for
+// the calls in progress, the pending OnChange events and the webhook requests and logs out the cached session. Calls
+// afterwards fail with ErrProviderClosed. The session is kept, if it is shared with other providers by ShareSessions or
+// stored in a SessionStore. Close can be called multiple times and concurrently with other calls. The context limits
+// the wait for the webhook requests, which are given up then, and is used for the logout.
+func (p *Provider) Close(ctx context.Context) error {
+	p.operationsMutex.Lock()
+	p.closed = true
+	for op := range p.operations {
+		op.Cancel()
+	}
+	p.operationsMutex.Unlock()
+
+	p.operationsGroup.Wait()
+	p.waitForBatches()
+	p.waitForChangeEvents()
+
+	p.operationsMutex.Lock()
+	p.callsClosed = true
+	p.operationsMutex.Unlock()
+	p.callsGroup.Wait()
+	p.operationsMutex.Lock()
+	p.shutDown = true
+	p.operationsMutex.Unlock()
+
+	// the calls in progress may have started webhook requests
+	p.waitForWebhooks(ctx)
+
+	if p.ShareSessions || p.SessionStore != nil {
+		return nil
+	}
+	err := p.Logout(ctx)
+	if customersErr := p.logoutCustomers(ctx); err == nil {
+		err = customersErr
+	}
+	return err
+}
+
+// Waits until the open coalesce windows are applied.
+func (p *Provider) waitForBatches() {
+	p.batchesMutex.Lock()
+	var batches []*coalescedBatch
+	for _, batch := range p.batches {
+		batches = append(batches, batch)
+	}
+	p.batchesMutex.Unlock()
+
+	for _, batch := range batches {
+		<-batch.done
+	}
+}
+
+// Returns ErrProviderClosed, if the provider was closed.
+func (p *Provider) checkShutDown() error {
+	p.operationsMutex.Lock()
+	defer p.operationsMutex.Unlock()
+	if p.shutDown {
+		return ErrProviderClosed
+	}
+	return nil
+}
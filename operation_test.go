@@ -0,0 +1,183 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// desiredTXTRecords returns n TXT records with distinct values.
+func desiredTXTRecords(n int) []libdns.Record {
+	records := make([]libdns.Record, n)
+	for i := range records {
+		records[i] = libdns.Record{Type: "TXT", Name: "@", Value: fmt.Sprintf("value-%v", i)}
+	}
+	return records
+}
+
+// waitForProgress polls the progress of the operation, until at least done records are sent, and returns it.
+func waitForProgress(t *testing.T, op *Operation, done int) (int, int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if sent, total := op.Progress(); sent >= done {
+			return sent, total
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Operation didn't reach a progress of %v", done)
+	return 0, 0
+}
+
+func TestProvider_StartSyncProgress(t *testing.T) {
+	p, server := newFakeProvider(t)
+	server.SetLatency("updateDnsRecords", 50*time.Millisecond)
+
+	op, err := p.StartSync(context.Background(), fakeZone, desiredTXTRecords(6), SyncOptions{ChunkSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every chunk is reported on its own
+	for _, expected := range []int{2, 4, 6} {
+		if sent, total := waitForProgress(t, op, expected); sent != expected || total != 6 {
+			t.Fatalf("Expected a progress of %v/6, got %v/%v", expected, sent, total)
+		}
+	}
+
+	<-op.Done()
+	result, err := op.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Appended) != 6 || len(server.Records(fakeZone)) != 6 {
+		t.Fatalf("Expected 6 appended records, got %+v", result)
+	}
+}
+
+func TestProvider_StartSyncCancel(t *testing.T) {
+	p, server := newFakeProvider(t)
+	server.SetLatency("updateDnsRecords", 100*time.Millisecond)
+
+	op, err := p.StartSync(context.Background(), fakeZone, desiredTXTRecords(6), SyncOptions{ChunkSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForProgress(t, op, 2)
+	op.Cancel()
+
+	result, err := op.Result()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the operation to be canceled, got %v", err)
+	}
+	if sent, total := op.Progress(); sent >= total {
+		t.Fatalf("Expected the operation to stop before all records are sent, got %v/%v", sent, total)
+	}
+	if result == nil || len(result.Appended) == 0 || len(result.Appended) >= 6 {
+		t.Fatalf("Expected the records of the sent chunks in the result, got %+v", result)
+	}
+}
+
+func TestProvider_CloseCancelsOperations(t *testing.T) {
+	p, server := newFakeProvider(t)
+	server.SetLatency("updateDnsRecords", 100*time.Millisecond)
+
+	op, err := p.StartSync(context.Background(), fakeZone, desiredTXTRecords(6), SyncOptions{ChunkSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForProgress(t, op, 2)
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close waits for the operation
+	select {
+	case <-op.Done():
+	default:
+		t.Fatal("Expected the operation to be finished after Close")
+	}
+	if _, err := op.Result(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the operation to be canceled, got %v", err)
+	}
+	if _, err := p.StartSync(context.Background(), fakeZone, nil, SyncOptions{}); !errors.Is(err, ErrProviderClosed) {
+		t.Fatalf("Expected ErrProviderClosed after Close, got %v", err)
+	}
+}
+
+func TestProvider_Close(t *testing.T) {
+	p, server := newFakeProvider(t)
+	ctx := context.Background()
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.SessionCount(); count != 0 {
+		t.Fatalf("Expected the cached session to be ended, got %v sessions", count)
+	}
+	if _, err := p.GetRecords(ctx, fakeZone); !errors.Is(err, ErrProviderClosed) {
+		t.Fatalf("Expected ErrProviderClosed, got %v", err)
+	}
+	// closing again does nothing
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvider_CloseWaitsForCalls(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.CoalesceWindow = 50 * time.Millisecond
+	server.SetLatency("infoDnsRecords", 50*time.Millisecond)
+	ctx := context.Background()
+
+	results := make(chan error, 2)
+	go func() {
+		_, err := p.GetRecords(ctx, fakeZone)
+		results <- err
+	}()
+	go func() {
+		_, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}})
+		results <- err
+	}()
+	// both calls are in progress
+	time.Sleep(10 * time.Millisecond)
+
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("Expected the calls in progress to succeed, got %v", err)
+		}
+	}
+	if records := server.Records(fakeZone); len(records) != 1 {
+		t.Fatalf("Expected the coalesced record to be appended, got %+v", records)
+	}
+	if count := server.SessionCount(); count != 0 {
+		t.Fatalf("Expected the session to be ended, got %v sessions", count)
+	}
+}
+
+func TestProvider_CloseKeepsSharedSession(t *testing.T) {
+	first, second, server := newSharingProviders(t)
+	ctx := context.Background()
+	if _, err := first.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.CallCount("login"); count != 1 {
+		t.Fatalf("Expected the shared session to be kept, got %v logins", count)
+	}
+}
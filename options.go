@@ -0,0 +1,38 @@
+// Options for single method calls
+
+package netcup
+
+import "context"
+
+// CallOptions change the behavior of a single method call. The libdns interfaces have no parameter for them,
+// so they are passed with the context, see WithCallOptions.
+type CallOptions struct {
+	// Force skips the deletion safety threshold (Provider.MaxDeleteFraction and Provider.MaxDeleteCount)
+	// and makes DelegateSubdomain delete conflicting records.
+	Force bool
+	// MatchPolicy overrides Provider.MatchPolicy, if it is set.
+	MatchPolicy MatchPolicy
+	// OnProgress overrides Provider.OnProgress, if it is set.
+	OnProgress func(Progress)
+	// DryRun makes the call only plan and log its changes, like Provider.DryRun.
+	DryRun bool
+	// UserAgentSuffix overrides Provider.UserAgentSuffix, if it is set, for example to identify the job, that made the call.
+	UserAgentSuffix string
+	// CustomerNumber makes the call use another customer number than Provider.CustomerNumber, with the credentials of
+	// its entry in Provider.Customers, or with the API key and password of the provider, if it has none.
+	CustomerNumber string
+}
+
+// callOptionsKey is the context key for the CallOptions
+type callOptionsKey struct{}
+
+// WithCallOptions returns a context, that applies the given options to the provider methods called with it.
+func WithCallOptions(ctx context.Context, options CallOptions) context.Context {
+	return context.WithValue(ctx, callOptionsKey{}, options)
+}
+
+// Returns the options of the call, the zero value if none are set.
+func callOptions(ctx context.Context) CallOptions {
+	options, _ := ctx.Value(callOptionsKey{}).(CallOptions)
+	return options
+}
@@ -0,0 +1,21 @@
+module github.com/wizardrix/libdns_netcup/otel
+
+go 1.20
+
+require (
+	github.com/libdns/libdns v0.2.2
+	github.com/wizardrix/libdns_netcup v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.21.0
+	go.opentelemetry.io/otel/sdk v1.21.0
+	go.opentelemetry.io/otel/trace v1.21.0
+)
+
+require (
+	github.com/go-logr/logr v1.3.0 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/metric v1.21.0 // indirect
+	golang.org/x/sync v0.1.0 // indirect
+	golang.org/x/sys v0.14.0 // indirect
+)
+
+replace github.com/wizardrix/libdns_netcup => ../
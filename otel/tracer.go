@@ -0,0 +1,80 @@
+// Package otel traces the operations of the netcup provider and their requests to netcup (netcup.Tracer) with
+// OpenTelemetry.
+//
+// It is a separate module, so OpenTelemetry doesn't become a dependency of the provider.
+package otel
+
+import (
+	"context"
+
+	netcup "github.com/wizardrix/libdns_netcup"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the OpenTelemetry tracer
+const instrumentationName = "github.com/wizardrix/libdns_netcup"
+
+// Tracer implements netcup.Tracer with an OpenTelemetry tracer. The spans of the operations are children of the span
+// of the context passed to them, and the attributes set by the provider, like netcup.zone or netcup.status_code, are
+// set as OpenTelemetry attributes:
+//
+//	provider.Tracer = otel.New(nil)
+//	ctx, span := tracer.Start(ctx, "renew certificate")
+//	defer span.End()
+//	records, err := provider.GetRecords(ctx, "example.com")
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ netcup.Tracer = (*Tracer)(nil)
+
+// New returns a Tracer, whose spans are created by the tracer provider, or the global one of OpenTelemetry, if it is
+// nil.
+func New(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: provider.Tracer(instrumentationName)}
+}
+
+// StartOperation starts an internal span named like "netcup.get" or "netcup.append".
+func (tracer *Tracer) StartOperation(ctx context.Context, operation string) (context.Context, netcup.Span) {
+	ctx, span := tracer.tracer.Start(ctx, "netcup."+operation, trace.WithSpanKind(trace.SpanKindInternal))
+	return ctx, &Span{span: span}
+}
+
+// StartRequest starts a client span named like "netcup.login" or "netcup.updateDnsRecords".
+func (tracer *Tracer) StartRequest(ctx context.Context, action string) (context.Context, netcup.Span) {
+	ctx, span := tracer.tracer.Start(ctx, "netcup."+action, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, &Span{span: span}
+}
+
+// Span implements netcup.Span with an OpenTelemetry span.
+type Span struct {
+	span trace.Span
+}
+
+var _ netcup.Span = (*Span)(nil)
+
+func (span *Span) SetAttribute(key string, value interface{}) {
+	switch value := value.(type) {
+	case string:
+		span.span.SetAttributes(attribute.String(key, value))
+	case int:
+		span.span.SetAttributes(attribute.Int(key, value))
+	case bool:
+		span.span.SetAttributes(attribute.Bool(key, value))
+	}
+}
+
+// End records the error, if there is one, and sets the status of the span to error.
+func (span *Span) End(err error) {
+	if err != nil {
+		span.span.RecordError(err)
+		span.span.SetStatus(codes.Error, err.Error())
+	}
+	span.span.End()
+}
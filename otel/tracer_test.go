@@ -0,0 +1,84 @@
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	netcup "github.com/wizardrix/libdns_netcup"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const zone = "example.com"
+
+// Returns the value of the attribute of the span, or an invalid value, if it isn't set.
+func attributeValue(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracer(t *testing.T) {
+	server := netcuptest.NewServer()
+	defer server.Close()
+	server.AddZone(zone, 86400)
+	server.FailNext("updateDnsRecords", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error.", LongMessage: "Something is wrong."})
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	p := &netcup.Provider{
+		CustomerNumber:        "12345",
+		APIKey:                "key",
+		APIPassword:           "password",
+		Endpoint:              server.URL,
+		AllowInsecureEndpoint: true,
+		RequestsPerSecond:     -1,
+		RetryPolicy:           netcup.RetryPolicy{BaseDelay: time.Millisecond},
+		Tracer:                New(provider),
+	}
+	ctx, root := provider.Tracer("test").Start(context.Background(), "caller")
+
+	records := []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}
+	if _, err := p.AppendRecords(ctx, zone, records); err == nil {
+		t.Fatal("Expected the failure of the update")
+	}
+	root.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	operation, ok := spans["netcup.append"]
+	if !ok {
+		t.Fatalf("Expected a span of the operation, got %v", spans)
+	}
+	if operation.Parent().SpanID() != root.SpanContext().SpanID() || operation.SpanKind() != trace.SpanKindInternal {
+		t.Fatal("Expected an internal span as child of the span of the context")
+	}
+	if operation.Status().Code != codes.Error || attributeValue(operation, netcup.AttributeZone).AsString() != zone || attributeValue(operation, netcup.AttributeRecords).AsInt64() != 1 {
+		t.Fatalf("Expected a failed span with the zone and the number of records, got %v and %v", operation.Status(), operation.Attributes())
+	}
+
+	for _, action := range []string{"login", "infoDnsRecords", "updateDnsRecords"} {
+		span, ok := spans["netcup."+action]
+		if !ok {
+			t.Fatalf("Expected a span of %v", action)
+		}
+		if span.Parent().SpanID() != operation.SpanContext().SpanID() || span.SpanKind() != trace.SpanKindClient {
+			t.Fatalf("Expected the span of %v to be a client span as child of the operation", action)
+		}
+	}
+	update := spans["netcup.updateDnsRecords"]
+	if update.Status().Code != codes.Error || attributeValue(update, netcup.AttributeStatusCode).AsInt64() != netcuptest.StatusValidationError || len(update.Events()) != 1 {
+		t.Fatalf("Expected the failed update with the status code of netcup and the error, got %v and %v", update.Status(), update.Attributes())
+	}
+}
@@ -0,0 +1,138 @@
+// Progress reporting of operations
+
+package netcup
+
+import (
+	"context"
+	"sync"
+)
+
+// Phase is the step an operation is in.
+type Phase string
+
+const (
+	// PhaseReading is reported, before the zone and its records are read.
+	PhaseReading Phase = "reading"
+	// PhaseUpdating is reported, before the first chunk of changes is sent and after each chunk.
+	PhaseUpdating Phase = "updating"
+	// PhaseVerifying is reported, before the records are read again to get the IDs of the written records.
+	PhaseVerifying Phase = "verifying"
+)
+
+// Progress is the state of an operation passed to the progress hook (Provider.OnProgress or CallOptions.OnProgress).
+// An operation is complete, when RecordsDone equals RecordsTotal in PhaseUpdating. The totals are 0 until the changes are computed.
+type Progress struct {
+	// Operation is the name of the operation like "append", "set", "delete" or "sync", as sent with the webhook
+	Operation string
+	Zone      string
+	Phase     Phase
+	// ChunksDone and ChunksTotal are the number of updates sent to netcup so far and in total
+	ChunksDone  int
+	ChunksTotal int
+	// RecordsDone and RecordsTotal are the number of changed records sent to netcup so far and in total
+	RecordsDone  int
+	RecordsTotal int
+}
+
+// progressReporter passes the progress of one operation to the hook. The hook is called in the order of the reports, but on its
+// own goroutine, so a slow hook doesn't block the operation while it holds the zone lock. A nil reporter reports nothing.
+type progressReporter struct {
+	hook     func(Progress)
+	progress Progress
+
+	mutex   sync.Mutex
+	wake    *sync.Cond
+	pending []Progress
+	closed  bool
+	// closed, when all reports are passed to the hook
+	done chan struct{}
+}
+
+// Returns the reporter for the operation, nil if no progress hook is set. finish must be called, when the operation is finished.
+func (p *Provider) startProgress(ctx context.Context, operation string, zone string) *progressReporter {
+	hook := callOptions(ctx).OnProgress
+	if hook == nil {
+		hook = p.OnProgress
+	}
+	if hook == nil {
+		return nil
+	}
+
+	reporter := &progressReporter{
+		hook:     hook,
+		progress: Progress{Operation: operation, Zone: unFQDN(zone)},
+		done:     make(chan struct{}),
+	}
+	reporter.wake = sync.NewCond(&reporter.mutex)
+	go reporter.deliver()
+	return reporter
+}
+
+// Reports the start of the phase.
+func (reporter *progressReporter) phase(phase Phase) {
+	if reporter == nil {
+		return
+	}
+	reporter.progress.Phase = phase
+	reporter.report()
+}
+
+// Sets the number of chunks and records to send and reports the start of PhaseUpdating.
+func (reporter *progressReporter) updating(chunks int, records int) {
+	if reporter == nil {
+		return
+	}
+	reporter.progress.ChunksTotal, reporter.progress.RecordsTotal = chunks, records
+	reporter.phase(PhaseUpdating)
+}
+
+// Reports a chunk with the given number of records as sent.
+func (reporter *progressReporter) chunkDone(records int) {
+	if reporter == nil {
+		return
+	}
+	reporter.progress.ChunksDone++
+	reporter.progress.RecordsDone += records
+	reporter.report()
+}
+
+// Waits until all reports are passed to the hook. Nothing is reported afterwards.
+func (reporter *progressReporter) finish() {
+	if reporter == nil {
+		return
+	}
+	reporter.mutex.Lock()
+	reporter.closed = true
+	reporter.wake.Signal()
+	reporter.mutex.Unlock()
+	<-reporter.done
+}
+
+func (reporter *progressReporter) report() {
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+	reporter.pending = append(reporter.pending, reporter.progress)
+	reporter.wake.Signal()
+}
+
+// Passes the reports to the hook, until the reporter is finished.
+func (reporter *progressReporter) deliver() {
+	defer close(reporter.done)
+	for {
+		reporter.mutex.Lock()
+		for len(reporter.pending) == 0 && !reporter.closed {
+			reporter.wake.Wait()
+		}
+		pending := reporter.pending
+		reporter.pending = nil
+		closed := reporter.closed
+		reporter.mutex.Unlock()
+
+		for _, progress := range pending {
+			reporter.hook(progress)
+		}
+		if closed && len(pending) == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package netcup
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// progressRecorder collects the reported progress.
+type progressRecorder struct {
+	mutex    sync.Mutex
+	reported []Progress
+}
+
+func (recorder *progressRecorder) record(progress Progress) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.reported = append(recorder.reported, progress)
+}
+
+func (recorder *progressRecorder) progress() []Progress {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	return append([]Progress(nil), recorder.reported...)
+}
+
+func TestProvider_SyncProgress(t *testing.T) {
+	p, _ := newFakeProvider(t)
+	recorder := &progressRecorder{}
+	p.OnProgress = recorder.record
+
+	if _, err := p.SyncRecords(context.Background(), fakeZone, desiredTXTRecords(5), SyncOptions{ChunkSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// all reports are delivered before SyncRecords returns
+	reported := recorder.progress()
+	if len(reported) != 5 || reported[0].Phase != PhaseReading {
+		t.Fatalf("Expected the reading phase, the start of the update and 3 chunks, got %+v", reported)
+	}
+	for i, progress := range reported {
+		if progress.Operation != "sync" || progress.Zone != fakeZone {
+			t.Fatalf("Expected the operation and zone in the progress, got %+v", progress)
+		}
+		if i > 1 && (progress.ChunksDone != reported[i-1].ChunksDone+1 || progress.RecordsDone <= reported[i-1].RecordsDone) {
+			t.Fatalf("Expected the progress to increase with every chunk, got %+v after %+v", progress, reported[i-1])
+		}
+	}
+	last := reported[len(reported)-1]
+	if last.Phase != PhaseUpdating || last.ChunksDone != 3 || last.ChunksTotal != 3 || last.RecordsDone != 5 || last.RecordsTotal != 5 {
+		t.Fatalf("Expected the complete progress at the end, got %+v", last)
+	}
+}
+
+func TestProvider_ProgressCallOption(t *testing.T) {
+	p, _ := newFakeProvider(t)
+	providerRecorder, callRecorder := &progressRecorder{}, &progressRecorder{}
+	p.OnProgress = providerRecorder.record
+
+	ctx := WithCallOptions(context.Background(), CallOptions{OnProgress: callRecorder.record})
+	if _, err := p.AppendRecords(ctx, fakeZone, desiredTXTRecords(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if reported := providerRecorder.progress(); len(reported) != 0 {
+		t.Fatalf("Expected the hook of the call to replace the hook of the provider, got %+v", reported)
+	}
+	expectedPhases := []Phase{PhaseReading, PhaseUpdating, PhaseUpdating, PhaseVerifying}
+	reported := callRecorder.progress()
+	if len(reported) != len(expectedPhases) {
+		t.Fatalf("Expected the phases %v, got %+v", expectedPhases, reported)
+	}
+	for i, progress := range reported {
+		if progress.Phase != expectedPhases[i] || progress.Operation != "append" {
+			t.Fatalf("Expected the phases %v, got %+v", expectedPhases, reported)
+		}
+	}
+}
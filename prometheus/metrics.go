@@ -0,0 +1,108 @@
+// Package prometheus exports the metrics of the netcup provider (netcup.Metrics) to Prometheus.
+//
+// It is a separate module, so Prometheus doesn't become a dependency of the provider.
+package prometheus
+
+import (
+	"time"
+
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	netcup "github.com/wizardrix/libdns_netcup"
+)
+
+// namespace of the metric names
+const namespace = "netcup"
+
+// Metrics implements netcup.Metrics with these Prometheus metrics:
+//
+//   - netcup_operations_total{operation, status}: the operations like "get" or "append" by the status of their error
+//   - netcup_operation_duration_seconds{operation}: a histogram of the durations of the operations
+//   - netcup_requests_total{action, status}: the requests to netcup like "login" or "updateDnsRecords" by the status of
+//     their error, like "ok", the status code of netcup or "http_503", see netcup.ErrorStatus
+//   - netcup_request_duration_seconds{action}: a histogram of the durations of the requests
+//   - netcup_retries_total{action}: the requests sent again after a failure
+//
+// Metrics is a prometheus.Collector, so it is registered like other collectors:
+//
+//	metrics := prometheus.New()
+//	stdprometheus.MustRegister(metrics)
+//	provider.Metrics = metrics
+type Metrics struct {
+	operations        *stdprometheus.CounterVec
+	operationDuration *stdprometheus.HistogramVec
+	requests          *stdprometheus.CounterVec
+	requestDuration   *stdprometheus.HistogramVec
+	retries           *stdprometheus.CounterVec
+}
+
+var _ netcup.Metrics = (*Metrics)(nil)
+var _ stdprometheus.Collector = (*Metrics)(nil)
+
+// New returns the metrics, which need to be registered with a prometheus.Registerer.
+func New() *Metrics {
+	return &Metrics{
+		operations: stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "operations_total",
+			Help:      "Operations of the netcup provider by status.",
+		}, []string{"operation", "status"}),
+		operationDuration: stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Durations of the operations of the netcup provider.",
+			// an operation takes at least a few requests
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"operation"}),
+		requests: stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Requests to the netcup API by action and status.",
+		}, []string{"action", "status"}),
+		requestDuration: stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Durations of the requests to the netcup API.",
+			Buckets:   stdprometheus.DefBuckets,
+		}, []string{"action"}),
+		retries: stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retries_total",
+			Help:      "Requests to the netcup API sent again after a failure.",
+		}, []string{"action"}),
+	}
+}
+
+// ObserveOperation implements netcup.Metrics.
+func (metrics *Metrics) ObserveOperation(operation string, duration time.Duration, err error) {
+	metrics.operations.WithLabelValues(operation, netcup.ErrorStatus(err)).Inc()
+	metrics.operationDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// ObserveRequest implements netcup.Metrics.
+func (metrics *Metrics) ObserveRequest(action string, duration time.Duration, err error) {
+	metrics.requests.WithLabelValues(action, netcup.ErrorStatus(err)).Inc()
+	metrics.requestDuration.WithLabelValues(action).Observe(duration.Seconds())
+}
+
+// IncRetry implements netcup.Metrics.
+func (metrics *Metrics) IncRetry(action string) {
+	metrics.retries.WithLabelValues(action).Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (metrics *Metrics) Describe(descs chan<- *stdprometheus.Desc) {
+	metrics.operations.Describe(descs)
+	metrics.operationDuration.Describe(descs)
+	metrics.requests.Describe(descs)
+	metrics.requestDuration.Describe(descs)
+	metrics.retries.Describe(descs)
+}
+
+// Collect implements prometheus.Collector.
+func (metrics *Metrics) Collect(collected chan<- stdprometheus.Metric) {
+	metrics.operations.Collect(collected)
+	metrics.operationDuration.Collect(collected)
+	metrics.requests.Collect(collected)
+	metrics.requestDuration.Collect(collected)
+	metrics.retries.Collect(collected)
+}
@@ -0,0 +1,74 @@
+package prometheus
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	netcup "github.com/wizardrix/libdns_netcup"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+const zone = "example.com"
+
+func TestMetrics(t *testing.T) {
+	server := netcuptest.NewServer()
+	defer server.Close()
+	server.AddZone(zone, 86400)
+	server.SetLatency("updateDnsRecords", 10*time.Millisecond)
+	server.FailNext("login", netcuptest.Failure{HTTPStatusCode: 503, ShortMessage: "Service Unavailable"})
+	server.FailNext("updateDnsRecords", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error.", LongMessage: "Something is wrong."})
+
+	metrics := New()
+	registry := stdprometheus.NewPedanticRegistry()
+	if err := registry.Register(metrics); err != nil {
+		t.Fatal(err)
+	}
+	p := &netcup.Provider{
+		CustomerNumber:        "12345",
+		APIKey:                "key",
+		APIPassword:           "password",
+		Endpoint:              server.URL,
+		AllowInsecureEndpoint: true,
+		RequestsPerSecond:     -1,
+		RetryPolicy:           netcup.RetryPolicy{BaseDelay: time.Millisecond},
+		Metrics:               metrics,
+	}
+	ctx := context.Background()
+	records := []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}
+
+	if _, err := p.AppendRecords(ctx, zone, records); err == nil {
+		t.Fatal("Expected the rejected update to fail")
+	}
+	if _, err := p.AppendRecords(ctx, zone, records); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP netcup_operations_total Operations of the netcup provider by status.
+# TYPE netcup_operations_total counter
+netcup_operations_total{operation="append",status="4013"} 1
+netcup_operations_total{operation="append",status="ok"} 1
+# HELP netcup_requests_total Requests to the netcup API by action and status.
+# TYPE netcup_requests_total counter
+netcup_requests_total{action="infoDnsRecords",status="ok"} 3
+netcup_requests_total{action="infoDnsZone",status="ok"} 2
+netcup_requests_total{action="login",status="http_503"} 1
+netcup_requests_total{action="login",status="ok"} 1
+netcup_requests_total{action="updateDnsRecords",status="4013"} 1
+netcup_requests_total{action="updateDnsRecords",status="ok"} 1
+# HELP netcup_retries_total Requests to the netcup API sent again after a failure.
+# TYPE netcup_retries_total counter
+netcup_retries_total{action="login"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "netcup_operations_total", "netcup_requests_total", "netcup_retries_total"); err != nil {
+		t.Fatal(err)
+	}
+	if count := testutil.CollectAndCount(metrics, "netcup_request_duration_seconds"); count != 4 {
+		t.Fatalf("Expected a histogram per action, got %v", count)
+	}
+}
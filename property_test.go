@@ -0,0 +1,351 @@
+// Property-based tests for the write paths against the fake netcup server
+
+package netcup
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+var (
+	propertyNames  = []string{"@", "*", "www", "*.dev", "mail"}
+	propertyTypes  = []string{"A", "AAAA", "TXT", "MX", "CNAME"}
+	propertyValues = map[string][]string{
+		"A":     {"192.0.2.1", "192.0.2.2", "192.0.2.3"},
+		"AAAA":  {"2001:db8::1", "2001:db8::2"},
+		"TXT":   {"v=spf1 -all", "token1", "token2"},
+		"MX":    {"mx1.example.com", "mx2.example.com"},
+		"CNAME": {"target.example.com", "other.example.com"},
+	}
+)
+
+// propertyRecord returns a random record. The small pools of names and values make collisions with existing records likely.
+func propertyRecord(rand *rand.Rand) libdns.Record {
+	recType := propertyTypes[rand.Intn(len(propertyTypes))]
+	values := propertyValues[recType]
+	record := libdns.Record{
+		Type:  recType,
+		Name:  propertyNames[rand.Intn(len(propertyNames))],
+		Value: values[rand.Intn(len(values))],
+	}
+	if recType == "MX" {
+		record.Priority = uint(10 * (1 + rand.Intn(2)))
+	}
+	return record
+}
+
+// propertyCase is a random zone and a random batch of input records.
+type propertyCase struct {
+	Zone  []netcuptest.Record
+	Batch []libdns.Record
+}
+
+func (propertyCase) Generate(rand *rand.Rand, size int) reflect.Value {
+	var c propertyCase
+	for i := rand.Intn(size/4 + 1); i > 0; i-- {
+		record := propertyRecord(rand)
+		c.Zone = append(c.Zone, netcuptest.Record{
+			HostName:    record.Name,
+			Type:        record.Type,
+			Priority:    int(record.Priority),
+			Destination: record.Value,
+		})
+	}
+	for i := 1 + rand.Intn(size/8+1); i > 0; i-- {
+		c.Batch = append(c.Batch, propertyRecord(rand))
+	}
+	return reflect.ValueOf(c)
+}
+
+// String formats the case as Go source, so a counterexample can be copied into a regression test.
+func (c propertyCase) String() string {
+	var sb strings.Builder
+	sb.WriteString("zone := []netcuptest.Record{\n")
+	for _, record := range c.Zone {
+		fmt.Fprintf(&sb, "\t{HostName: %q, Type: %q, Priority: %d, Destination: %q},\n", record.HostName, record.Type, record.Priority, record.Destination)
+	}
+	sb.WriteString("}\nbatch := []libdns.Record{\n")
+	for _, record := range c.Batch {
+		fmt.Fprintf(&sb, "\t{Type: %q, Name: %q, Value: %q, Priority: %d},\n", record.Type, record.Name, record.Value, record.Priority)
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// canonical returns the records as sorted strings, ignoring the IDs.
+func canonical(records []netcuptest.Record) []string {
+	result := []string{}
+	for _, record := range records {
+		result = append(result, fmt.Sprintf("%v %v %v %v", record.HostName, record.Type, record.Priority, record.Destination))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// canonicalWithIDs returns the records as sorted strings, including the IDs.
+func canonicalWithIDs(records []netcuptest.Record) []string {
+	result := []string{}
+	for _, record := range records {
+		result = append(result, fmt.Sprintf("%v %v %v %v %v", record.ID, record.HostName, record.Type, record.Priority, record.Destination))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// isSubset checks if every element of a is in b, counting duplicates.
+func isSubset(a, b []string) bool {
+	counts := make(map[string]int)
+	for _, elm := range b {
+		counts[elm]++
+	}
+	for _, elm := range a {
+		if counts[elm] == 0 {
+			return false
+		}
+		counts[elm]--
+	}
+	return true
+}
+
+// checkProperty runs the given operation for random cases against a fresh zone and checks the property
+// on the zone before and after the operation.
+func checkProperty(t *testing.T, operation func(p *Provider, batch []libdns.Record) error, property func(p *Provider, server *netcuptest.Server, c propertyCase, before, after []netcuptest.Record) string) {
+	p, server := newFakeProvider(t)
+
+	f := func(c propertyCase) bool {
+		server.AddZone(fakeZone, 86400, c.Zone...)
+		before := server.Records(fakeZone)
+		if err := operation(p, c.Batch); err != nil {
+			t.Logf("Operation failed: %v\n%v", err, c)
+			return false
+		}
+		after := server.Records(fakeZone)
+		if msg := property(p, server, c, before, after); msg != "" {
+			t.Logf("%v\nbefore: %v\nafter: %v\n%v", msg, canonical(before), canonical(after), c)
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 200}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProperty_SetRecordsReflectsDesiredGroups(t *testing.T) {
+	checkProperty(t, func(p *Provider, batch []libdns.Record) error {
+		_, err := p.SetRecords(context.Background(), fakeZone, batch)
+		return err
+	}, func(p *Provider, server *netcuptest.Server, c propertyCase, before, after []netcuptest.Record) string {
+		groups := make(map[string]bool)
+		var desired []netcuptest.Record
+		for _, record := range c.Batch {
+			groups[record.Name+" "+record.Type] = true
+			desired = append(desired, netcuptest.Record{HostName: record.Name, Type: record.Type, Priority: int(record.Priority), Destination: record.Value})
+		}
+
+		var inGroups, otherBefore, otherAfter []netcuptest.Record
+		for _, record := range after {
+			if groups[record.HostName+" "+record.Type] {
+				inGroups = append(inGroups, record)
+			} else {
+				otherAfter = append(otherAfter, record)
+			}
+		}
+		for _, record := range before {
+			if !groups[record.HostName+" "+record.Type] {
+				otherBefore = append(otherBefore, record)
+			}
+		}
+
+		if !reflect.DeepEqual(uniqueStrings(canonical(inGroups)), uniqueStrings(canonical(desired))) || len(inGroups) != len(uniqueStrings(canonical(desired))) {
+			return "Records of the set groups differ from the desired records"
+		}
+		if !reflect.DeepEqual(canonicalWithIDs(otherBefore), canonicalWithIDs(otherAfter)) {
+			return "Records outside of the set groups were changed"
+		}
+		return ""
+	})
+}
+
+func TestProperty_AppendRecordsNeverRemoves(t *testing.T) {
+	checkProperty(t, func(p *Provider, batch []libdns.Record) error {
+		_, err := p.AppendRecords(context.Background(), fakeZone, batch)
+		return err
+	}, func(p *Provider, server *netcuptest.Server, c propertyCase, before, after []netcuptest.Record) string {
+		if !isSubset(canonicalWithIDs(before), canonicalWithIDs(after)) {
+			return "Existing records were removed or changed"
+		}
+		return ""
+	})
+}
+
+func TestProperty_DeleteRecordsNeverAdds(t *testing.T) {
+	checkProperty(t, func(p *Provider, batch []libdns.Record) error {
+		_, err := p.DeleteRecords(context.Background(), fakeZone, batch)
+		return err
+	}, func(p *Provider, server *netcuptest.Server, c propertyCase, before, after []netcuptest.Record) string {
+		if !isSubset(canonicalWithIDs(after), canonicalWithIDs(before)) {
+			return "Records were added or changed"
+		}
+		return ""
+	})
+}
+
+func TestProperty_OperationsAreIdempotent(t *testing.T) {
+	operations := map[string]func(p *Provider, batch []libdns.Record) error{
+		"AppendRecords": func(p *Provider, batch []libdns.Record) error {
+			_, err := p.AppendRecords(context.Background(), fakeZone, batch)
+			return err
+		},
+		"SetRecords": func(p *Provider, batch []libdns.Record) error {
+			_, err := p.SetRecords(context.Background(), fakeZone, batch)
+			return err
+		},
+		"DeleteRecords": func(p *Provider, batch []libdns.Record) error {
+			_, err := p.DeleteRecords(context.Background(), fakeZone, batch)
+			return err
+		},
+	}
+
+	for name, operation := range operations {
+		operation := operation
+		t.Run(name, func(t *testing.T) {
+			twice := func(p *Provider, batch []libdns.Record) error {
+				if err := operation(p, batch); err != nil {
+					return err
+				}
+				return operation(p, batch)
+			}
+			checkProperty(t, twice, func(p *Provider, server *netcuptest.Server, c propertyCase, before, after []netcuptest.Record) string {
+				server.AddZone(fakeZone, 86400, c.Zone...)
+				if err := operation(p, c.Batch); err != nil {
+					return err.Error()
+				}
+				if !reflect.DeepEqual(canonical(server.Records(fakeZone)), canonical(after)) {
+					return "Applying the operation twice differs from applying it once"
+				}
+				return ""
+			})
+		})
+	}
+}
+
+func uniqueStrings(values []string) []string {
+	var unique []string
+	for i, value := range values {
+		if i == 0 || values[i-1] != value {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// Regression tests for counterexamples found by the property tests
+func TestProperty_Regressions(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation func(p *Provider, batch []libdns.Record) error
+		zone      []netcuptest.Record
+		batch     []libdns.Record
+		expected  []netcuptest.Record
+	}{
+		{
+			name: "SetRecords with multiple values of the same name and type",
+			operation: func(p *Provider, batch []libdns.Record) error {
+				_, err := p.SetRecords(context.Background(), fakeZone, batch)
+				return err
+			},
+			zone: []netcuptest.Record{
+				{HostName: "@", Type: "MX", Priority: 20, Destination: "mx1.example.com"},
+				{HostName: "@", Type: "MX", Priority: 10, Destination: "mx2.example.com"},
+				{HostName: "@", Type: "TXT", Destination: "token1"},
+			},
+			batch: []libdns.Record{
+				{Type: "MX", Name: "@", Value: "mx2.example.com", Priority: 20},
+				{Type: "MX", Name: "@", Value: "mx1.example.com", Priority: 20},
+			},
+			expected: []netcuptest.Record{
+				{HostName: "@", Type: "MX", Priority: 20, Destination: "mx1.example.com"},
+				{HostName: "@", Type: "MX", Priority: 20, Destination: "mx2.example.com"},
+				{HostName: "@", Type: "TXT", Destination: "token1"},
+			},
+		},
+		{
+			name: "AppendRecords with an equal record that is not the first of its name and type",
+			operation: func(p *Provider, batch []libdns.Record) error {
+				_, err := p.AppendRecords(context.Background(), fakeZone, batch)
+				return err
+			},
+			zone: []netcuptest.Record{
+				{HostName: "www", Type: "AAAA", Destination: "2001:db8::2"},
+				{HostName: "www", Type: "AAAA", Destination: "2001:db8::1"},
+			},
+			batch: []libdns.Record{
+				{Type: "AAAA", Name: "www", Value: "2001:db8::1"},
+			},
+			expected: []netcuptest.Record{
+				{HostName: "www", Type: "AAAA", Destination: "2001:db8::1"},
+				{HostName: "www", Type: "AAAA", Destination: "2001:db8::2"},
+			},
+		},
+		{
+			name: "DeleteRecords with a value that differs from the first record of its name and type",
+			operation: func(p *Provider, batch []libdns.Record) error {
+				_, err := p.DeleteRecords(context.Background(), fakeZone, batch)
+				return err
+			},
+			zone: []netcuptest.Record{
+				{HostName: "www", Type: "TXT", Destination: "token1"},
+				{HostName: "www", Type: "TXT", Destination: "token2"},
+			},
+			batch: []libdns.Record{
+				{Type: "TXT", Name: "www", Value: "token2"},
+				{Type: "TXT", Name: "www", Value: "token2"},
+				{Type: "TXT", Name: "www", Value: "token3"},
+			},
+			expected: []netcuptest.Record{
+				{HostName: "www", Type: "TXT", Destination: "token1"},
+			},
+		},
+		{
+			name: "DeleteRecords with identical records",
+			operation: func(p *Provider, batch []libdns.Record) error {
+				_, err := p.DeleteRecords(context.Background(), fakeZone, batch)
+				return err
+			},
+			zone: []netcuptest.Record{
+				{HostName: "*.dev", Type: "AAAA", Destination: "2001:db8::1"},
+				{HostName: "*.dev", Type: "AAAA", Destination: "2001:db8::1"},
+				{HostName: "*.dev", Type: "AAAA", Destination: "2001:db8::2"},
+			},
+			batch: []libdns.Record{
+				{Type: "AAAA", Name: "*.dev", Value: "2001:db8::1"},
+			},
+			expected: []netcuptest.Record{
+				{HostName: "*.dev", Type: "AAAA", Destination: "2001:db8::2"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, server := newFakeProvider(t, test.zone...)
+			if err := test.operation(p, test.batch); err != nil {
+				t.Fatal(err)
+			}
+			if records := canonical(server.Records(fakeZone)); !reflect.DeepEqual(records, canonical(test.expected)) {
+				t.Fatalf("Expected records %v, got %v", canonical(test.expected), records)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+// Rate limiting of the requests to netcup
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRequestsPerSecond is used, if Provider.RequestsPerSecond is not set
+const defaultRequestsPerSecond = 5
+
+// defaultRateLimitWait is the wait after netcup rejected a request because of its limit of requests per minute, if it
+// doesn't tell how long to wait, and the default of Provider.MaxRateLimitWait
+const defaultRateLimitWait = time.Minute
+
+// ErrRateLimited is matched by a RateLimitError with errors.Is.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitError is returned, if netcup rejected a request, because the limit of requests per minute was exceeded,
+// and the request wasn't retried or failed again.
+type RateLimitError struct {
+	// Action is the API action of the rejected request
+	Action string
+	// RetryAfter is the wait before another request requested by netcup with the Retry-After header or in its message,
+	// like "try again in 30 seconds", zero if it didn't tell.
+	RetryAfter time.Duration
+	// Err is the rejection, an *APIError or the HTTP status 429
+	Err error
+}
+
+func (err *RateLimitError) Error() string {
+	return fmt.Sprintf("%v %v by %v: %v", loggingPrefixLibdnsNetcup, ErrRateLimited, err.Action, err.Err)
+}
+
+// Is makes errors.Is(err, ErrRateLimited) true.
+func (err *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+func (err *RateLimitError) Unwrap() error {
+	return err.Err
+}
+
+// rateLimitMessagePattern matches the messages of netcup for requests rejected because of its rate limit.
+var rateLimitMessagePattern = regexp.MustCompile(`(?i)too many requests|requests per minute|request limit|rate limit`)
+
+// rateLimitWaitPattern matches a wait in the messages of netcup, like "try again in 30 seconds" or "in 1 minute"
+var rateLimitWaitPattern = regexp.MustCompile(`(?i)\bin (\d+) ?(seconds?|minutes?)\b`)
+
+// Returns if netcup rejected the request because of its rate limit. netcup answers it with the status code of validation
+// errors, so only these are checked for the messages of the rate limit.
+func (err *APIError) rateLimited() bool {
+	return err.StatusCode == statusValidationError &&
+		(rateLimitMessagePattern.MatchString(err.ShortMessage) || rateLimitMessagePattern.MatchString(err.LongMessage))
+}
+
+// Returns the wait requested in the messages of a rejection, zero if they don't tell.
+func (err *APIError) retryAfter() time.Duration {
+	for _, message := range []string{err.LongMessage, err.ShortMessage} {
+		match := rateLimitWaitPattern.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		count, convErr := strconv.Atoi(match[1])
+		if convErr != nil {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(match[2]), "minute") {
+			return time.Duration(count) * time.Minute
+		}
+		return time.Duration(count) * time.Second
+	}
+	return 0
+}
+
+// Returns the error of a failed request as RateLimitError, if it is a rejection because of the rate limit of netcup.
+func asRateLimitError(action string, err error, header http.Header) error {
+	switch err := err.(type) {
+	case *APIError:
+		if err.rateLimited() {
+			retryAfter := parseRetryAfter(header.Get("Retry-After"))
+			if retryAfter == 0 {
+				retryAfter = err.retryAfter()
+			}
+			return &RateLimitError{Action: action, RetryAfter: retryAfter, Err: err}
+		}
+	case *httpStatusError:
+		if err.StatusCode == http.StatusTooManyRequests {
+			return &RateLimitError{Action: action, RetryAfter: parseRetryAfter(header.Get("Retry-After")), Err: err}
+		}
+	}
+	return err
+}
+
+// Returns the wait of a Retry-After header in seconds or as HTTP date, zero if it is empty or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && time.Until(date) > 0 {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// Returns the wait before retrying a request rejected because of the rate limit of netcup: RetryAfter or a minute,
+// limited by MaxRateLimitWait, or a negative duration, if rejected requests are not retried.
+func (p *Provider) rateLimitWait(err *RateLimitError) time.Duration {
+	maxWait := p.MaxRateLimitWait
+	if maxWait < 0 {
+		return -1
+	}
+	if maxWait == 0 {
+		maxWait = defaultRateLimitWait
+	}
+	wait := err.RetryAfter
+	if wait <= 0 {
+		wait = defaultRateLimitWait
+	}
+	if wait > maxWait {
+		wait = maxWait
+	}
+	return wait
+}
+
+// RateLimiter limits the requests to netcup. Wait blocks until a request may be sent or the context is done.
+// *rate.Limiter of golang.org/x/time/rate implements it.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// tokenBucket is the default RateLimiter: it allows bursts of up to burst requests and refills at rate requests per second.
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (bucket *tokenBucket) Wait(ctx context.Context) error {
+	bucket.mutex.Lock()
+	now := time.Now()
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+	bucket.last = now
+	// the token is taken right away, so concurrent requests queue up behind each other
+	bucket.tokens--
+	wait := time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+	bucket.mutex.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// the token is given back
+		bucket.mutex.Lock()
+		bucket.tokens++
+		bucket.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Returns the RateLimiter of the provider, the default token bucket if it is not set, or nil if the rate is not limited.
+func (p *Provider) rateLimiter() RateLimiter {
+	if p.RateLimiter != nil {
+		return p.RateLimiter
+	}
+	if p.RequestsPerSecond < 0 {
+		return nil
+	}
+
+	p.defaultLimiterOnce.Do(func() {
+		rate := p.RequestsPerSecond
+		if rate == 0 {
+			rate = defaultRequestsPerSecond
+		}
+		burst := p.RequestBurst
+		if burst == 0 {
+			burst = int(rate * 2)
+		}
+		p.defaultLimiter = newTokenBucket(rate, burst)
+	})
+	return p.defaultLimiter
+}
+
+// Returns the token bucket for MaxRequestsPerMinute, or nil if it is not set. Its burst and rate are chosen, so that no
+// minute has more than MaxRequestsPerMinute requests, even if the burst is used up at its beginning.
+func (p *Provider) minuteLimiter() RateLimiter {
+	if p.MaxRequestsPerMinute <= 0 {
+		return nil
+	}
+
+	p.defaultMinuteLimiterOnce.Do(func() {
+		burst := p.MaxRequestsPerMinute / 10
+		if burst < 1 {
+			burst = 1
+		}
+		rate := float64(p.MaxRequestsPerMinute-burst) / 60
+		if rate <= 0 {
+			// one request per minute
+			burst, rate = 1, 1.0/60
+		}
+		p.defaultMinuteLimiter = newTokenBucket(rate, burst)
+	})
+	return p.defaultMinuteLimiter
+}
+
+// Waits until the request may be sent according to the rate limits of the provider.
+func (p *Provider) waitForRateLimit(ctx context.Context) error {
+	if limiter := p.minuteLimiter(); limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	limiter := p.rateLimiter()
+	if limiter == nil {
+		return nil
+	}
+	return limiter.Wait(ctx)
+}
@@ -0,0 +1,240 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(100, 2)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := bucket.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the burst passes right away, the other two requests wait for 10ms each
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Fatalf("Expected the requests after the burst to wait, took %v", elapsed)
+	}
+}
+
+func TestTokenBucket_Canceled(t *testing.T) {
+	bucket := newTokenBucket(1, 1)
+	if err := bucket.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := bucket.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the wait to end with the context, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Expected the wait to end with the context, took %v", elapsed)
+	}
+}
+
+// countingLimiter counts the requests and rejects them after limit.
+type countingLimiter struct {
+	mutex sync.Mutex
+	count int
+	limit int
+}
+
+func (limiter *countingLimiter) Wait(ctx context.Context) error {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.count++
+	if limiter.count > limiter.limit {
+		return errors.New("quota exceeded")
+	}
+	return nil
+}
+
+func TestProvider_RateLimiter(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.RetryPolicy.MaxAttempts = 1
+	limiter := &countingLimiter{limit: 3}
+	p.RateLimiter = limiter
+	ctx := context.Background()
+
+	// login, infoDnsZone and infoDnsRecords
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if limiter.count != server.CallCount("login")+server.CallCount("infoDnsZone")+server.CallCount("infoDnsRecords") {
+		t.Fatalf("Expected the limiter to be waited on before every request, got %v waits for %v", limiter.count, server.Actions())
+	}
+
+	// the request isn't sent, if the limiter fails
+	server.ResetCalls()
+	if _, err := p.GetRecords(ctx, fakeZone); err == nil {
+		t.Fatal("Expected the error of the limiter")
+	}
+	if calls := server.Actions(); len(calls) != 0 {
+		t.Fatalf("Expected no requests, got %v", calls)
+	}
+}
+
+func TestProvider_RequestsPerSecond(t *testing.T) {
+	p, _ := newFakeProvider(t)
+	p.RequestsPerSecond = 20
+	p.RequestBurst = 1
+	ctx := context.Background()
+
+	start := time.Now()
+	// login, infoDnsZone and infoDnsRecords
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("Expected the requests to be limited to 20 per second, took %v", elapsed)
+	}
+}
+
+func TestProvider_MaxRequestsPerMinute(t *testing.T) {
+	for _, perMinute := range []int{1, 5, 180, 1000} {
+		p := &Provider{MaxRequestsPerMinute: perMinute}
+		bucket := p.minuteLimiter().(*tokenBucket)
+		if requests := bucket.burst + bucket.rate*60; requests > float64(perMinute)+1e-9 && perMinute > 1 {
+			t.Fatalf("Expected at most %v requests per minute, got a burst of %v and %v per minute", perMinute, bucket.burst, bucket.rate*60)
+		}
+	}
+
+	// the limit applies, even if RequestsPerSecond disables the other one, so only the login is sent right away
+	p, server := newFakeProvider(t)
+	p.MaxRequestsPerMinute = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetRecords(ctx, fakeZone); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the wait for the limit to end with the context, got %v", err)
+	}
+	if calls := server.Actions(); len(calls) != 1 {
+		t.Fatalf("Expected only the login to be sent, got %v", calls)
+	}
+}
+
+// rateLimitFailure is a rejection of netcup because of its limit of requests per minute
+var rateLimitFailure = netcuptest.Failure{StatusCode: 4013, ShortMessage: "Too many requests.", LongMessage: "The limit of 180 requests per minute is exceeded."}
+
+func TestProvider_RateLimitRejection(t *testing.T) {
+	failures := map[string]netcuptest.Failure{
+		"netcup":    rateLimitFailure,
+		"HTTP 429":  {HTTPStatusCode: 429, ShortMessage: "Too Many Requests", RetryAfter: "60"},
+		"HTTP date": {HTTPStatusCode: 429, ShortMessage: "Too Many Requests", RetryAfter: "Wed, 21 Oct 2015 07:28:00 GMT"},
+	}
+	for name, failure := range failures {
+		t.Run(name, func(t *testing.T) {
+			p, server := newFakeProvider(t)
+			p.MaxRateLimitWait = 10 * time.Millisecond
+			server.FailNext("updateDnsRecords", failure)
+
+			// the rejected update wasn't applied, so it is sent again after the wait
+			if _, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.1"}}); err != nil {
+				t.Fatal(err)
+			}
+			if count := server.CallCount("updateDnsRecords"); count != 2 {
+				t.Fatalf("Expected the rejected update to be sent again, got %v attempts", count)
+			}
+			if records := server.Records(fakeZone); len(records) != 1 {
+				t.Fatalf("Expected the record to be appended once, got %+v", records)
+			}
+		})
+	}
+}
+
+func TestProvider_RateLimitFailFast(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.MaxRateLimitWait = -1
+	server.FailNext("login", rateLimitFailure)
+
+	_, err := p.GetRecords(context.Background(), fakeZone)
+	var apiErr *APIError
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &apiErr) {
+		t.Fatalf("Expected a RateLimitError wrapping the APIError, got %v", err)
+	}
+	if errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("Expected the rejected login not to be an authentication failure, got %v", err)
+	}
+	if count := server.CallCount("login"); count != 1 {
+		t.Fatalf("Expected no retry, got %v attempts", count)
+	}
+}
+
+func TestProvider_RateLimitRetryAfter(t *testing.T) {
+	throttled := rateLimitFailure
+	throttled.LongMessage = "The limit of 180 requests per minute is exceeded. Please try again in 2 seconds."
+
+	// the wait requested in the message is returned with the rejection
+	p, server := newFakeProvider(t)
+	p.MaxRateLimitWait = -1
+	server.FailNext("login", throttled)
+	_, err := p.GetRecords(context.Background(), fakeZone)
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) || rateLimitErr.RetryAfter != 2*time.Second {
+		t.Fatalf("Expected a RateLimitError with the wait of 2s, got %v", err)
+	}
+
+	// the Retry-After header takes precedence
+	throttled.RetryAfter = "5"
+	server.FailNext("login", throttled)
+	_, err = p.GetRecords(context.Background(), fakeZone)
+	if !errors.As(err, &rateLimitErr) || rateLimitErr.RetryAfter != 5*time.Second {
+		t.Fatalf("Expected a RateLimitError with the wait of 5s, got %v", err)
+	}
+
+	// the retry waits as requested instead of the default minute
+	p, server = newFakeProvider(t)
+	throttled.RetryAfter = ""
+	throttled.LongMessage = "Please try again in 1 second."
+	server.FailNext("updateDnsRecords", throttled)
+	start := time.Now()
+	if _, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > defaultRateLimitWait/2 {
+		t.Fatalf("Expected the retry after the requested second, took %v", elapsed)
+	}
+	if count := server.CallCount("updateDnsRecords"); count != 2 {
+		t.Fatalf("Expected the rejected update to be sent again, got %v attempts", count)
+	}
+}
+
+func TestAPIError_RetryAfter(t *testing.T) {
+	waits := map[string]time.Duration{
+		"Please try again in 30 seconds.":                   30 * time.Second,
+		"Try again in 2 minutes":                            2 * time.Minute,
+		"The limit of 180 requests per minute is exceeded.": 0,
+		"": 0,
+	}
+	for message, wait := range waits {
+		if retryAfter := (&APIError{LongMessage: message}).retryAfter(); retryAfter != wait {
+			t.Fatalf("Expected %v for %q, got %v", wait, message, retryAfter)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if wait := parseRetryAfter("30"); wait != 30*time.Second {
+		t.Fatalf("Expected 30s, got %v", wait)
+	}
+	if wait := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); wait < 59*time.Minute || wait > time.Hour {
+		t.Fatalf("Expected about an hour, got %v", wait)
+	}
+	for _, value := range []string{"", "soon", "-5", "Wed, 21 Oct 2015 07:28:00 GMT"} {
+		if wait := parseRetryAfter(value); wait != 0 {
+			t.Fatalf("Expected no wait for %q, got %v", value, wait)
+		}
+	}
+}
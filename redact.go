@@ -0,0 +1,68 @@
+// Redaction of the credentials in the diagnostic output of a Provider
+
+package netcup
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+)
+
+// Redacted returns a copy of the configuration of the provider for diagnostics, with the API keys and passwords of the
+// provider and its Customers and the webhook secret replaced by "***" and the password of ProxyURL redacted. Empty secrets stay empty, so missing
+// ones can be told apart. Only the fields configurable with JSON are copied, the Logger, the hooks and the state of
+// the provider, like its session, are not.
+func (p *Provider) Redacted() *Provider {
+	redacted := &Provider{}
+	if data, err := json.Marshal(p); err == nil {
+		// the data was marshaled from a provider, so it can always be unmarshaled
+		_ = json.Unmarshal(data, redacted)
+	}
+	redacted.APIKey = redactSecret(redacted.APIKey)
+	redacted.APIPassword = redactSecret(redacted.APIPassword)
+	redacted.WebhookSecret = redactSecret(redacted.WebhookSecret)
+	for i := range redacted.Customers {
+		redacted.Customers[i].APIKey = redactSecret(redacted.Customers[i].APIKey)
+		redacted.Customers[i].APIPassword = redactSecret(redacted.Customers[i].APIPassword)
+	}
+	if redacted.ProxyURL != "" {
+		if proxyURL, err := url.Parse(redacted.ProxyURL); err == nil {
+			redacted.ProxyURL = proxyURL.Redacted()
+		} else {
+			redacted.ProxyURL = redactedValue
+		}
+	}
+	return redacted
+}
+
+// String returns the configuration of the provider as JSON with the secrets redacted like by Redacted, so formatting
+// a *Provider with %v or %+v never shows the credentials.
+func (p *Provider) String() string {
+	data, err := json.Marshal(p.Redacted())
+	if err != nil {
+		return "netcup.Provider{}"
+	}
+	return "netcup.Provider" + string(data)
+}
+
+// GoString returns the same as String, so formatting a *Provider with %#v never shows the credentials.
+func (p *Provider) GoString() string {
+	return p.String()
+}
+
+// Returns redactedValue for a secret, that is set.
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// secretPattern matches the values of the credentials and session IDs in JSON, which may be truncated
+var secretPattern = regexp.MustCompile(`(?i)("(?:apikey|apipassword|apisessionid|api_key|api_password)"\s*:\s*")[^"]*`)
+
+// Returns the text with the values of the credentials and session IDs in JSON replaced by redactedValue, for the bodies
+// in error messages. Unlike redactJSON it works on bodies, that are truncated or no valid JSON.
+func redactSecrets(text string) string {
+	return secretPattern.ReplaceAllString(text, "${1}"+redactedValue)
+}
@@ -0,0 +1,244 @@
+// Retries of requests, that failed temporarily
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Defaults of RetryPolicy
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseDelay   = 500 * time.Millisecond
+	defaultRetryMaxDelay    = 5 * time.Second
+)
+
+// RetryPolicy configures the retries of requests to netcup, that failed temporarily: because of a network error like
+// a dropped connection, an HTTP status 5xx or a temporary error reported by netcup. Other failures reported by netcup,
+// like invalid credentials or a validation error, are never retried. Updates are only retried, if they can't have been
+// applied, so they are never applied twice. The zero value uses the defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a request including the first one. Defaults to 3, 1 disables retries.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// BaseDelay is the delay before the first retry, it is doubled for every further retry. Defaults to 500 milliseconds.
+	// The actual delays are randomly shortened by up to half, so concurrent clients don't retry at the same time.
+	BaseDelay time.Duration `json:"base_delay,omitempty"`
+	// MaxDelay limits the delay between two attempts. Defaults to 5 seconds.
+	MaxDelay time.Duration `json:"max_delay,omitempty"`
+	// PerAttemptTimeout limits every attempt, so a hanging request is retried. An attempt, that timed out, counts as a
+	// network error. Defaults to no limit besides RequestTimeout and the context.
+	PerAttemptTimeout time.Duration `json:"per_attempt_timeout,omitempty"`
+	// IsRetryable classifies the failures of attempts, for example by the messages of an APIError, instead of the
+	// built-in classification. Updates are still only retried, if they can't have been applied. Attempts are never
+	// retried after the context is done.
+	IsRetryable func(err error) bool `json:"-"`
+}
+
+// transportError is an error sending a request or reading its response, like a dropped connection.
+type transportError struct {
+	err error
+}
+
+func (err *transportError) Error() string {
+	return err.err.Error()
+}
+
+func (err *transportError) Unwrap() error {
+	return err.err
+}
+
+// httpStatusError is returned, if netcup answers with an HTTP status other than 2xx, like a gateway timeout.
+// Only server errors (5xx) are retried.
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+	// Body is the beginning of the response body
+	Body string
+	// ClientRequestID is the ID sent with the request
+	ClientRequestID string
+}
+
+func (err *httpStatusError) Error() string {
+	if err.Body == "" {
+		return fmt.Sprintf("%v unexpected HTTP status %v to client request ID %v", loggingPrefixNetcup, err.Status, err.ClientRequestID)
+	}
+	return fmt.Sprintf("%v unexpected HTTP status %v to client request ID %v: %q", loggingPrefixNetcup, err.Status, err.ClientRequestID, err.Body)
+}
+
+// Is makes errors.Is(err, ErrMaintenance) true for the HTTP status 503.
+func (err *httpStatusError) Is(target error) bool {
+	return target == ErrMaintenance && err.StatusCode == http.StatusServiceUnavailable
+}
+
+// bodySnippetLength is the maximum length of a response body in error messages
+const bodySnippetLength = 200
+
+// Returns the beginning of a response body for an error message, with surrounding white space removed and the
+// credentials and session IDs redacted.
+func bodySnippet(body []byte) string {
+	snippet := strings.TrimSpace(string(body))
+	if len(snippet) > bodySnippetLength {
+		snippet = snippet[:bodySnippetLength] + "..."
+	}
+	return redactSecrets(snippet)
+}
+
+// Returns the delay before the retry after the given attempt, starting at 1.
+func (policy RetryPolicy) delay(attempt int) time.Duration {
+	delay := policy.BaseDelay
+	if delay <= 0 {
+		delay = defaultRetryBaseDelay
+	}
+	maxDelay := policy.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+func (policy RetryPolicy) maxAttempts() int {
+	if policy.MaxAttempts <= 0 {
+		return defaultRetryMaxAttempts
+	}
+	return policy.MaxAttempts
+}
+
+// Returns the delay shortened by a random amount of up to half of it.
+func jitter(delay time.Duration) time.Duration {
+	if delay <= 1 {
+		return delay
+	}
+	return delay - time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Sends the request and retries it according to the RetryPolicy of the provider, if it fails temporarily.
+// The waiting between the attempts ends early, if the context is done, and there is no retry, if the deadline of the
+// context would pass while waiting.
+func (p *Provider) sendRequest(ctx context.Context, req request) (*response, error) {
+	maxAttempts := p.RetryPolicy.maxAttempts()
+	for attempt := 1; ; attempt++ {
+		res, err := p.sendAttempt(ctx, req)
+		if err == nil || attempt >= maxAttempts {
+			return res, err
+		}
+
+		var delay time.Duration
+		var rateLimitErr *RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			// the rejected request wasn't applied, so even updates are sent again after the wait
+			if delay = p.rateLimitWait(rateLimitErr); delay < 0 || ctx.Err() != nil {
+				return res, err
+			}
+		} else {
+			if !p.RetryPolicy.isRetryable(ctx, err) {
+				return res, err
+			}
+			if !readOnlyActions[req.Action] && !isUndelivered(err) {
+				p.warnf("%v Request %v failed and may have been applied, not retrying: %v", loggingPrefixLibdnsNetcup, req.Action, err)
+				return res, err
+			}
+			delay = jitter(p.RetryPolicy.delay(attempt))
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, err
+		}
+		p.warnf("%v Request %v failed, retrying in %v: %v", loggingPrefixLibdnsNetcup, req.Action, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+		statsFromContext(ctx).retry()
+		if p.Metrics != nil {
+			p.Metrics.IncRetry(req.Action)
+		}
+	}
+}
+
+// Sends one attempt of the request, limited by PerAttemptTimeout of the RetryPolicy of the provider.
+func (p *Provider) sendAttempt(ctx context.Context, req request) (*response, error) {
+	if p.RetryPolicy.PerAttemptTimeout <= 0 {
+		return p.sendRequestOnce(ctx, req)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, p.RetryPolicy.PerAttemptTimeout)
+	defer cancel()
+	res, err := p.sendRequestOnce(attemptCtx, req)
+	if err != nil && attemptCtx.Err() != nil && ctx.Err() == nil {
+		// only the attempt timed out, not the call
+		return nil, &transportError{err: fmt.Errorf("attempt timed out after %v: %w", p.RetryPolicy.PerAttemptTimeout, err)}
+	}
+	return res, err
+}
+
+// Returns if the failed attempt can be retried according to IsRetryable or the built-in classification.
+func (policy RetryPolicy) isRetryable(ctx context.Context, err error) bool {
+	if policy.IsRetryable == nil {
+		return isTemporary(ctx, err)
+	}
+	return ctx.Err() == nil && policy.IsRetryable(err)
+}
+
+// readOnlyActions are the actions, that don't change anything at netcup and so can be retried after any temporary failure.
+// Other actions are only retried, if the failed attempt can't have been applied.
+var readOnlyActions = map[string]bool{
+	"login":          true,
+	"infoDnsZone":    true,
+	"infoDnsRecords": true,
+	"listallDomains": true,
+}
+
+// temporaryMessagePattern matches the messages of netcup for temporary errors, like an overloaded or maintained API.
+var temporaryMessagePattern = regexp.MustCompile(`(?i)temporar|try again later`)
+
+// Returns if the request failed temporarily and can be retried.
+func isTemporary(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var transportErr *transportError
+	var statusErr *httpStatusError
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &transportErr):
+		return true
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode >= 500
+	case errors.As(err, &apiErr):
+		return temporaryMessagePattern.MatchString(apiErr.ShortMessage) || temporaryMessagePattern.MatchString(apiErr.LongMessage)
+	}
+	return false
+}
+
+// Returns if the failed request didn't reach netcup or was rejected by it without processing: the connection couldn't be
+// established, the service was unavailable or netcup reported an error. Other failures, like a dropped connection or a
+// gateway timeout, are ambiguous, since netcup may have applied the request before.
+func isUndelivered(err error) bool {
+	var opErr *net.OpError
+	var statusErr *httpStatusError
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &opErr):
+		return opErr.Op == "dial"
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode == http.StatusServiceUnavailable
+	case errors.As(err, &apiErr):
+		return true
+	}
+	return false
+}
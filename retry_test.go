@@ -0,0 +1,253 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+func TestProvider_RetryTemporaryFailures(t *testing.T) {
+	failures := map[string]netcuptest.Failure{
+		"HTTP status": {HTTPStatusCode: 503, ShortMessage: "Service Unavailable"},
+		"dropped":     {CloseConnection: true},
+	}
+	for name, failure := range failures {
+		t.Run(name, func(t *testing.T) {
+			p, server := newFakeProvider(t, netcuptest.Record{HostName: "www", Type: "A", Destination: "192.0.2.1"})
+			p.RetryPolicy = RetryPolicy{BaseDelay: time.Millisecond}
+			server.FailNext("infoDnsRecords", failure, failure)
+
+			records, err := p.GetRecords(context.Background(), fakeZone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("Expected 1 record, got %+v", records)
+			}
+			if count := server.CallCount("infoDnsRecords"); count != 3 {
+				t.Fatalf("Expected 3 attempts, got %v", count)
+			}
+		})
+	}
+}
+
+func TestProvider_RetryGivesUp(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.RetryPolicy = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	failure := netcuptest.Failure{HTTPStatusCode: 502, ShortMessage: "Bad Gateway"}
+	server.FailNext("infoDnsRecords", failure, failure, failure)
+
+	var statusErr *httpStatusError
+	if _, err := p.GetRecords(context.Background(), fakeZone); !errors.As(err, &statusErr) || statusErr.StatusCode != 502 {
+		t.Fatalf("Expected the HTTP status error, got %v", err)
+	}
+	if count := server.CallCount("infoDnsRecords"); count != 2 {
+		t.Fatalf("Expected 2 attempts, got %v", count)
+	}
+}
+
+func TestProvider_NoRetryOfNetcupFailures(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.RetryPolicy = RetryPolicy{BaseDelay: time.Millisecond}
+	server.FailNext("login", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error."})
+
+	if _, err := p.GetRecords(context.Background(), fakeZone); err == nil {
+		t.Fatal("Expected the login to fail")
+	}
+	if count := server.CallCount("login"); count != 1 {
+		t.Fatalf("Expected no retry of a failure reported by netcup, got %v attempts", count)
+	}
+}
+
+func TestProvider_HTTPStatusError(t *testing.T) {
+	p, server := newFakeProvider(t)
+	server.FailNext("login", netcuptest.Failure{HTTPStatusCode: 404, ShortMessage: "<html><body>Not Found</body></html>"})
+
+	_, err := p.GetRecords(context.Background(), fakeZone)
+	if err == nil || !strings.Contains(err.Error(), "404 Not Found") || !strings.Contains(err.Error(), "<html><body>Not Found</body></html>") {
+		t.Fatalf("Expected the HTTP status and the body in the error, got %v", err)
+	}
+	if count := server.CallCount("login"); count != 1 {
+		t.Fatalf("Expected no retry of a client error, got %v attempts", count)
+	}
+}
+
+func TestBodySnippet(t *testing.T) {
+	if snippet := bodySnippet([]byte("  Bad Gateway\n")); snippet != "Bad Gateway" {
+		t.Fatalf("Expected the trimmed body, got %q", snippet)
+	}
+	long := strings.Repeat("x", bodySnippetLength+50)
+	if snippet := bodySnippet([]byte(long)); snippet != long[:bodySnippetLength]+"..." {
+		t.Fatalf("Expected the body to be truncated, got %q", snippet)
+	}
+}
+
+func TestProvider_RetryDelayEndsWithContext(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.RetryPolicy = RetryPolicy{BaseDelay: time.Hour}
+	server.FailNext("login", netcuptest.Failure{HTTPStatusCode: 503, ShortMessage: "Service Unavailable"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := p.GetRecords(ctx, fakeZone); err == nil {
+		t.Fatal("Expected the login to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("The delay before the retry didn't end with the context, took %v", elapsed)
+	}
+}
+
+func TestProvider_NoRetryAfterDeadline(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.RetryPolicy = RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Hour}
+	server.FailNext("login", netcuptest.Failure{HTTPStatusCode: 503, ShortMessage: "Service Unavailable"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var statusErr *httpStatusError
+	if _, err := p.GetRecords(ctx, fakeZone); !errors.As(err, &statusErr) {
+		t.Fatalf("Expected the HTTP status error right away, got %v", err)
+	}
+	if count := server.CallCount("login"); count != 1 {
+		t.Fatalf("Expected no retry after the deadline, got %v attempts", count)
+	}
+}
+
+func TestProvider_RetryTemporaryNetcupErrors(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.RetryPolicy = RetryPolicy{BaseDelay: time.Millisecond}
+	server.FailNext("infoDnsRecords", netcuptest.Failure{StatusCode: 4000, ShortMessage: "Temporary error.", LongMessage: "Please try again later."})
+
+	if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.CallCount("infoDnsRecords"); count != 2 {
+		t.Fatalf("Expected 2 attempts, got %v", count)
+	}
+}
+
+func TestProvider_RetryOfUpdates(t *testing.T) {
+	record := libdns.Record{Name: "www", Type: "A", Value: "192.0.2.1"}
+	tests := map[string]struct {
+		failure  netcuptest.Failure
+		attempts int
+	}{
+		"service unavailable": {failure: netcuptest.Failure{HTTPStatusCode: 503, ShortMessage: "Service Unavailable"}, attempts: 2},
+		"temporary error":     {failure: netcuptest.Failure{StatusCode: 4000, ShortMessage: "Temporary error."}, attempts: 2},
+		// the update may have been applied before the connection was dropped
+		"dropped":         {failure: netcuptest.Failure{CloseConnection: true}, attempts: 1},
+		"gateway timeout": {failure: netcuptest.Failure{HTTPStatusCode: 504, ShortMessage: "Gateway Timeout"}, attempts: 1},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, server := newFakeProvider(t)
+			p.RetryPolicy = RetryPolicy{BaseDelay: time.Millisecond}
+			server.FailNext("updateDnsRecords", test.failure)
+
+			_, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{record})
+			if count := server.CallCount("updateDnsRecords"); count != test.attempts {
+				t.Fatalf("Expected %v attempts, got %v", test.attempts, count)
+			}
+			if test.attempts > 1 && err != nil {
+				t.Fatal(err)
+			}
+			if test.attempts == 1 && err == nil {
+				t.Fatal("Expected the ambiguous failure")
+			}
+		})
+	}
+}
+
+func TestIsUndelivered(t *testing.T) {
+	tests := map[string]struct {
+		err         error
+		undelivered bool
+	}{
+		"dial":    {&transportError{err: &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}}, true},
+		"read":    {&transportError{err: &url.Error{Op: "Post", Err: &net.OpError{Op: "read", Err: errors.New("connection reset")}}}, false},
+		"EOF":     {&transportError{err: &url.Error{Op: "Post", Err: io.EOF}}, false},
+		"503":     {&httpStatusError{StatusCode: 503}, true},
+		"502":     {&httpStatusError{StatusCode: 502}, false},
+		"netcup":  {&APIError{ShortMessage: "Temporary error."}, true},
+		"unknown": {errors.New("unknown"), false},
+	}
+	for name, test := range tests {
+		if undelivered := isUndelivered(test.err); undelivered != test.undelivered {
+			t.Errorf("%v: expected %v, got %v", name, test.undelivered, undelivered)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if delay := jitter(time.Second); delay < 500*time.Millisecond || delay > time.Second {
+			t.Fatalf("Expected a delay between 500ms and 1s, got %v", delay)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if delay := policy.delay(attempt + 1); delay != expected {
+			t.Fatalf("Expected a delay of %v after attempt %v, got %v", expected, attempt+1, delay)
+		}
+	}
+}
+
+func TestProvider_PerAttemptTimeout(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.RetryPolicy = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, PerAttemptTimeout: 50 * time.Millisecond}
+	server.SetLatency("infoDnsRecords", 10*time.Second)
+
+	start := time.Now()
+	_, err := p.GetRecords(context.Background(), fakeZone)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the attempts to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the attempts to be limited, took %v", elapsed)
+	}
+	if count := server.CallCount("infoDnsRecords"); count != 2 {
+		t.Fatalf("Expected the timed out attempt to be retried, got %v attempts", count)
+	}
+}
+
+func TestProvider_IsRetryable(t *testing.T) {
+	p, server := newFakeProvider(t)
+	var mutex sync.Mutex
+	var classified []error
+	p.RetryPolicy = RetryPolicy{BaseDelay: time.Millisecond, IsRetryable: func(err error) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		classified = append(classified, err)
+		var apiErr *APIError
+		return errors.As(err, &apiErr) && apiErr.StatusCode == 4100
+	}}
+	// unlike the built-in classification, the classifier retries the netcup error, but not the HTTP status
+	server.FailNext("infoDnsRecords",
+		netcuptest.Failure{StatusCode: 4100, ShortMessage: "Busy."},
+		netcuptest.Failure{HTTPStatusCode: 503, ShortMessage: "Service Unavailable"})
+
+	var statusErr *httpStatusError
+	if _, err := p.GetRecords(context.Background(), fakeZone); !errors.As(err, &statusErr) {
+		t.Fatalf("Expected the HTTP status error, got %v", err)
+	}
+	if count := server.CallCount("infoDnsRecords"); count != 2 {
+		t.Fatalf("Expected the classified error to be retried once, got %v attempts", count)
+	}
+	if len(classified) != 2 {
+		t.Fatalf("Expected 2 classified errors, got %v", classified)
+	}
+}
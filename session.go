@@ -0,0 +1,397 @@
+// Reuse of the API session across method calls
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultSessionIdleTimeout is used, if Provider.SessionIdleTimeout is not set. netcup ends sessions after 15 minutes without requests.
+const defaultSessionIdleTimeout = 10 * time.Minute
+
+// logoutTimeout limits the logout at the end of a call, which doesn't use the context of the call
+const logoutTimeout = 10 * time.Second
+
+// detachedContext keeps the values of its parent, like the client request ID, but is never canceled with it
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// Ends the session with a context, that isn't canceled with the given one. Calls are often canceled, for example if
+// a DNS challenge times out, and the session would be left open on netcup until it expires otherwise.
+// A failed logout doesn't fail the call, but is logged, since open sessions can exhaust the sessions of the account.
+func (p *Provider) endSessionDetached(ctx context.Context, apiSessionID string) {
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, logoutTimeout)
+	defer cancel()
+	if err := p.endSession(ctx, apiSessionID); err != nil {
+		p.warnf("%v Warning: logout failed, the session stays open until it expires: %v", loggingPrefixLibdnsNetcup, err)
+	}
+}
+
+// cachedSession is the API session reused by the method calls
+type cachedSession struct {
+	id       string
+	lastUsed time.Time
+	// opened by BeginSession, so it is kept regardless of the idle timeout until EndSession
+	explicit bool
+}
+
+// sessionCache holds the session of a provider or, with Provider.ShareSessions, of all providers with the same credentials.
+// The mutex isn't held during logins and logouts, so calls don't wait for each other's requests beyond their contexts.
+type sessionCache struct {
+	mutex   sync.Mutex
+	session *cachedSession
+	// login in progress for the cached session, which concurrent calls wait for instead of logging in themselves
+	login *sessionLogin
+	// re-logins in progress per invalid session, which concurrent requests with that session wait for
+	renewals map[string]*sessionLogin
+	// sessions replaced by a re-login during a call, mapped to the replacing session until the logout of the call
+	replaced map[string]string
+}
+
+// sessionLogin is a login in progress, done is closed when it is finished
+type sessionLogin struct {
+	done chan struct{}
+}
+
+// sharedSessionKey identifies the netcup account of shared sessions
+type sharedSessionKey struct {
+	customerNumber string
+	apiKey         string
+}
+
+// session caches of the providers with ShareSessions set, per account
+var sharedSessions = struct {
+	mutex  sync.Mutex
+	caches map[sharedSessionKey]*sessionCache
+}{caches: make(map[sharedSessionKey]*sessionCache)}
+
+// Returns the session cache of the provider: its own one, the one of another customer of the call or, if ShareSessions
+// is set, the one shared by all providers with the same customer number and API key.
+func (p *Provider) sessions(ctx context.Context) *sessionCache {
+	if !p.ShareSessions {
+		if customerNumber := p.customerNumber(ctx); customerNumber != "" {
+			return p.customerSessionCache(customerNumber)
+		}
+		return &p.ownSessions
+	}
+	creds, err := p.credentials(ctx, false)
+	if err != nil {
+		// the login fails with the same error
+		return &p.ownSessions
+	}
+
+	key := sharedSessionKey{customerNumber: creds.CustomerNumber, apiKey: creds.APIKey}
+	sharedSessions.mutex.Lock()
+	defer sharedSessions.mutex.Unlock()
+	cache, found := sharedSessions.caches[key]
+	if !found {
+		cache = &sessionCache{}
+		sharedSessions.caches[key] = cache
+	}
+	return cache
+}
+
+// BeginSession opens a session, that is reused by all method calls until EndSession, even if SessionIdleTimeout is negative
+// or passes in between. An already cached session is kept open instead of starting a new one.
+func (p *Provider) BeginSession(ctx context.Context) error {
+	cache := p.sessions(ctx)
+	for {
+		cache.mutex.Lock()
+		if cache.session != nil && (cache.session.explicit || time.Since(cache.session.lastUsed) < p.sessionIdleTimeout()) {
+			cache.session.explicit = true
+			cache.mutex.Unlock()
+			return nil
+		}
+		if cache.session != nil {
+			expiredSessionID := cache.session.id
+			cache.session = nil
+			cache.mutex.Unlock()
+			p.endSessionDetached(ctx, expiredSessionID)
+			continue
+		}
+		if login := cache.login; login != nil {
+			cache.mutex.Unlock()
+			select {
+			case <-login.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+
+		login := &sessionLogin{done: make(chan struct{})}
+		cache.login = login
+		cache.mutex.Unlock()
+
+		apiSessionID, err := p.newSession(ctx)
+
+		cache.mutex.Lock()
+		cache.login = nil
+		// a session renewed meanwhile is kept open instead, like an already cached session
+		keptSession := err == nil && cache.session != nil
+		if keptSession {
+			cache.session.explicit = true
+		} else if err == nil {
+			cache.session = &cachedSession{id: apiSessionID, lastUsed: time.Now(), explicit: true}
+			p.storeSession(ctx, cache.session)
+		}
+		cache.mutex.Unlock()
+		close(login.done)
+		if keptSession {
+			p.endSessionDetached(ctx, apiSessionID)
+		}
+		return err
+	}
+}
+
+// EndSession logs out the session opened by BeginSession like Logout. Afterwards the method calls start their own sessions again.
+func (p *Provider) EndSession(ctx context.Context) error {
+	return p.Logout(ctx)
+}
+
+// Logout ends the cached session or the one opened by BeginSession, so the next method call logs in again.
+// With ShareSessions the session of all providers sharing it is ended, with a SessionStore the stored one.
+// It does nothing, if there is no session.
+func (p *Provider) Logout(ctx context.Context) error {
+	cache := p.sessions(ctx)
+	cache.mutex.Lock()
+	if cache.session == nil && p.sessionIdleTimeout() >= 0 {
+		cache.session = p.loadStoredSession(ctx, p.sessionIdleTimeout())
+	}
+	if cache.session == nil {
+		cache.mutex.Unlock()
+		return nil
+	}
+	apiSessionID := cache.session.id
+	cache.session = nil
+	p.storeSession(ctx, nil)
+	cache.mutex.Unlock()
+	return p.endSession(ctx, apiSessionID)
+}
+
+// Validate checks the credentials with a login and logout of a new session, without reading or changing records, so
+// misconfigured credentials are detected at startup rather than during the first operation. A rejected login is returned
+// as an error matching ErrAuthFailed, network errors and server errors of netcup are described as such.
+func (p *Provider) Validate(ctx context.Context) error {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+
+	apiSessionID, err := p.newSession(ctx)
+	if errors.Is(err, ErrAuthFailed) {
+		return fmt.Errorf("%v credentials rejected by netcup: %w", loggingPrefixLibdnsNetcup, err)
+	}
+	var transportErr *transportError
+	var statusErr *httpStatusError
+	if errors.As(err, &transportErr) || errors.As(err, &statusErr) {
+		return fmt.Errorf("%v failed to reach the netcup API: %w", loggingPrefixLibdnsNetcup, err)
+	}
+	if err != nil {
+		return err
+	}
+	p.endSessionDetached(ctx, apiSessionID)
+	return nil
+}
+
+// Returns the idle timeout of cached sessions, negative if sessions are not cached.
+func (p *Provider) sessionIdleTimeout() time.Duration {
+	if p.SessionIdleTimeout == 0 {
+		return defaultSessionIdleTimeout
+	}
+	return p.SessionIdleTimeout
+}
+
+// login returns the ID of the session opened by BeginSession or of the cached session, if there is one that was used within
+// the idle timeout. Without a cached session, the one in the SessionStore is used the same way. Otherwise a new session is
+// started, cached and stored. Concurrent calls wait for the login in progress and use its session.
+func (p *Provider) login(ctx context.Context) (string, error) {
+	idleTimeout := p.sessionIdleTimeout()
+
+	cache := p.sessions(ctx)
+	for {
+		cache.mutex.Lock()
+		if cache.session != nil && cache.session.explicit {
+			cache.mutex.Unlock()
+			return cache.session.id, nil
+		}
+		if idleTimeout < 0 {
+			cache.mutex.Unlock()
+			return p.newSession(ctx)
+		}
+		if cache.session == nil {
+			cache.session = p.loadStoredSession(ctx, idleTimeout)
+		}
+		if cache.session != nil {
+			if time.Since(cache.session.lastUsed) < idleTimeout {
+				apiSessionID := cache.session.id
+				cache.mutex.Unlock()
+				return apiSessionID, nil
+			}
+			expiredSessionID := cache.session.id
+			cache.session = nil
+			cache.mutex.Unlock()
+			p.endSessionDetached(ctx, expiredSessionID)
+			continue
+		}
+		if login := cache.login; login != nil {
+			cache.mutex.Unlock()
+			select {
+			case <-login.done:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			// the session of the login is cached now, or the login failed and this call tries it itself
+			continue
+		}
+
+		login := &sessionLogin{done: make(chan struct{})}
+		cache.login = login
+		cache.mutex.Unlock()
+
+		apiSessionID, err := p.newSession(ctx)
+
+		cache.mutex.Lock()
+		cache.login = nil
+		// BeginSession may have opened a session meanwhile, then the new one is ended by the logout of the call
+		if err == nil && cache.session == nil {
+			cache.session = &cachedSession{id: apiSessionID, lastUsed: time.Now()}
+			p.storeSession(ctx, cache.session)
+		}
+		cache.mutex.Unlock()
+		close(login.done)
+		return apiSessionID, err
+	}
+}
+
+// logout ends the session, if it is neither the cached session nor opened by BeginSession. Otherwise it is kept for the next call.
+// A session replaced by a re-login during the call is ended in its place. The session is ended even if the context is already canceled.
+func (p *Provider) logout(ctx context.Context, apiSessionID string) {
+	cache := p.sessions(ctx)
+	cache.mutex.Lock()
+	for {
+		replacingSessionID, found := cache.replaced[apiSessionID]
+		if !found {
+			break
+		}
+		delete(cache.replaced, apiSessionID)
+		apiSessionID = replacingSessionID
+	}
+
+	if cache.session != nil && cache.session.id == apiSessionID {
+		cache.session.lastUsed = time.Now()
+		p.storeSession(ctx, cache.session)
+		cache.mutex.Unlock()
+		return
+	}
+	cache.mutex.Unlock()
+	p.endSessionDetached(ctx, apiSessionID)
+}
+
+// Returns the ID of the session, that replaced the given one after a re-login, or the given one.
+func (p *Provider) currentSessionID(ctx context.Context, apiSessionID string) string {
+	cache := p.sessions(ctx)
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.resolve(apiSessionID)
+}
+
+func (cache *sessionCache) resolve(apiSessionID string) string {
+	for {
+		replacingSessionID, found := cache.replaced[apiSessionID]
+		if !found {
+			return apiSessionID
+		}
+		apiSessionID = replacingSessionID
+	}
+}
+
+// Replaces the session, which netcup reported as invalid, with a new one and returns its ID. The following requests of the
+// call with the invalid session and its logout use the new session, as well as the calls of all providers sharing it.
+// If the session was already replaced by a concurrent request, the ID of the replacing session is returned, and if it is
+// being replaced, the request waits for it.
+func (p *Provider) renewSession(ctx context.Context, invalidSessionID string) (string, error) {
+	cache := p.sessions(ctx)
+	for {
+		cache.mutex.Lock()
+		if apiSessionID := cache.resolve(invalidSessionID); apiSessionID != invalidSessionID {
+			cache.mutex.Unlock()
+			return apiSessionID, nil
+		}
+		if renewal := cache.renewals[invalidSessionID]; renewal != nil {
+			cache.mutex.Unlock()
+			select {
+			case <-renewal.done:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			// the session is replaced now, or the login failed and this request tries it itself
+			continue
+		}
+
+		renewal := &sessionLogin{done: make(chan struct{})}
+		if cache.renewals == nil {
+			cache.renewals = make(map[string]*sessionLogin)
+		}
+		cache.renewals[invalidSessionID] = renewal
+		cached := cache.session != nil && cache.session.id == invalidSessionID
+		if cached && !cache.session.explicit {
+			// the invalid session is evicted, even if the login fails, and new calls wait for the login
+			cache.session = nil
+			if cache.login == nil {
+				cache.login = renewal
+			}
+		}
+		cache.mutex.Unlock()
+
+		p.logf("%v Session is invalid, logging in again", loggingPrefixLibdnsNetcup)
+		apiSessionID, err := p.newSession(ctx)
+
+		cache.mutex.Lock()
+		delete(cache.renewals, invalidSessionID)
+		if cache.login == renewal {
+			cache.login = nil
+		}
+		if err == nil {
+			if cache.replaced == nil {
+				cache.replaced = make(map[string]string)
+			}
+			// netcup never issues the same ID twice, but a replacement by itself would never be resolved
+			if apiSessionID != invalidSessionID {
+				cache.replaced[invalidSessionID] = apiSessionID
+			}
+			// the session of a login meanwhile stays cached, the new one is ended by the logout of the call
+			if cached && cache.session == nil {
+				cache.session = &cachedSession{id: apiSessionID, lastUsed: time.Now()}
+				p.storeSession(ctx, cache.session)
+			} else if cached && cache.session.id == invalidSessionID {
+				cache.session.id, cache.session.lastUsed = apiSessionID, time.Now()
+				p.storeSession(ctx, cache.session)
+			}
+		}
+		cache.mutex.Unlock()
+		close(renewal.done)
+		return apiSessionID, err
+	}
+}
+
+// Returns if netcup rejected the request, because the session is invalid or expired.
+func isInvalidSession(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusInvalidSession
+}
@@ -0,0 +1,456 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+func TestProvider_SessionIsReused(t *testing.T) {
+	p, server := newFakeProvider(t, netcuptest.Record{HostName: "www", Type: "A", Destination: "192.0.2.1"})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := server.CallCount("login"); count != 1 {
+		t.Fatalf("Expected one login for all calls, got %v", count)
+	}
+	if count := server.CallCount("logout"); count != 0 {
+		t.Fatalf("Expected the session to be kept, got %v logouts", count)
+	}
+}
+
+func TestProvider_InvalidSessionIsRenewed(t *testing.T) {
+	p, server := newFakeProvider(t, netcuptest.Record{HostName: "www", Type: "A", Destination: "192.0.2.1"})
+	ctx := context.Background()
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	// both concurrent requests of the next call are rejected, but only one of them logs in again
+	server.ExpireSessions()
+	records, err := p.GetRecords(ctx, fakeZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %+v", records)
+	}
+	if count := server.CallCount("login"); count != 2 {
+		t.Fatalf("Expected one login again after the session expired, got %v logins", count)
+	}
+}
+
+func TestProvider_SessionIdleTimeout(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.SessionIdleTimeout = 10 * time.Millisecond
+	ctx := context.Background()
+
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := server.CallCount("login"); count != 2 {
+		t.Fatalf("Expected a new session after the idle timeout, got %v logins", count)
+	}
+	if count := server.SessionCount(); count != 1 {
+		t.Fatalf("Expected the idle session to be ended, got %v sessions", count)
+	}
+}
+
+func TestProvider_SessionCachingDisabled(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.SessionIdleTimeout = -1
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if logins, logouts := server.CallCount("login"), server.CallCount("logout"); logins != 2 || logouts != 2 {
+		t.Fatalf("Expected a session for every call, got %v logins and %v logouts", logins, logouts)
+	}
+}
+
+// Reads the given zones concurrently and returns the time it took.
+func getZonesConcurrently(t *testing.T, p *Provider, zones []string) time.Duration {
+	start := time.Now()
+	var group sync.WaitGroup
+	for _, zone := range zones {
+		group.Add(1)
+		go func(zone string) {
+			defer group.Done()
+			if _, err := p.GetRecords(context.Background(), zone); err != nil {
+				t.Error(err)
+			}
+		}(zone)
+	}
+	group.Wait()
+	return time.Since(start)
+}
+
+func TestProvider_ConcurrentLoginsWithoutCaching(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.SessionIdleTimeout = -1
+	zones := []string{"a.example", "b.example", "c.example", "d.example"}
+	for _, zone := range zones {
+		server.AddZone(zone, 86400)
+	}
+	server.SetLatency("login", 100*time.Millisecond)
+	server.SetLatency("logout", 100*time.Millisecond)
+
+	// the logins and logouts of the calls don't wait for each other
+	if elapsed := getZonesConcurrently(t, p, zones); elapsed > 350*time.Millisecond {
+		t.Fatalf("Expected the logins and logouts to run concurrently, took %v", elapsed)
+	}
+	if logins := server.CallCount("login"); logins != len(zones) {
+		t.Fatalf("Expected a login per call, got %v", logins)
+	}
+}
+
+func TestProvider_ConcurrentCallsShareLogin(t *testing.T) {
+	p, server := newFakeProvider(t)
+	zones := []string{"a.example", "b.example", "c.example", "d.example"}
+	for _, zone := range zones {
+		server.AddZone(zone, 86400)
+	}
+	server.SetLatency("login", 50*time.Millisecond)
+
+	// the calls wait for the login in progress instead of logging in themselves
+	getZonesConcurrently(t, p, zones)
+	if logins := server.CallCount("login"); logins != 1 {
+		t.Fatalf("Expected one login for the concurrent calls, got %v", logins)
+	}
+}
+
+// Waits until the server received the given number of logins and checks, that a call waiting for the login in progress
+// returns with its context.
+func assertCallNotBlockedByLogin(t *testing.T, p *Provider, server *netcuptest.Server, logins int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); server.CallCount("login") < logins; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a login in progress")
+		}
+	}
+
+	// another zone, so the call doesn't wait for the lock of the zone
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.GetRecords(ctx, "other.example"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the call to end with its context, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("Expected the call not to wait for the login beyond its context, took %v", elapsed)
+	}
+}
+
+func TestProvider_BeginSessionDoesNotBlockCalls(t *testing.T) {
+	p, server := newFakeProvider(t)
+	server.SetLatency("login", 300*time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() { done <- p.BeginSession(context.Background()) }()
+	assertCallNotBlockedByLogin(t, p, server, 1)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if logins := server.CallCount("login"); logins != 1 {
+		t.Fatalf("Expected one login, got %v", logins)
+	}
+}
+
+func TestProvider_SessionRenewalDoesNotBlockCalls(t *testing.T) {
+	p, server := newFakeProvider(t)
+	if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	server.ExpireSessions()
+	server.SetLatency("login", 300*time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.GetRecords(context.Background(), fakeZone)
+		done <- err
+	}()
+	assertCallNotBlockedByLogin(t, p, server, 2)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if logins := server.CallCount("login"); logins != 2 {
+		t.Fatalf("Expected one login again after the session expired, got %v logins", logins)
+	}
+}
+
+func TestProvider_LogoutFailureIsLogged(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.SessionIdleTimeout = -1
+	p.RetryPolicy.MaxAttempts = 1
+	logger := &recordingLogger{}
+	p.Logger = logger
+	server.FailNext("logout", netcuptest.Failure{HTTPStatusCode: 502, ShortMessage: "Bad Gateway"})
+
+	// the failed logout doesn't fail the call
+	if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.CallCount("logout"); count != 1 {
+		t.Fatalf("Expected a logout, got %v", count)
+	}
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	for _, message := range logger.messages {
+		if strings.HasPrefix(message, "[libdns_netcup] Warning: logout failed") && strings.Contains(message, "502 Bad Gateway") {
+			return
+		}
+	}
+	t.Fatalf("Expected the failed logout to be logged, got %q", logger.messages)
+}
+
+func TestProvider_BeginAndEndSession(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.SessionIdleTimeout = -1
+	ctx := context.Background()
+
+	if err := p.BeginSession(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+	// a failed call doesn't end the session
+	server.FailNext("updateDnsRecords", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Validation Error."})
+	if _, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "other"}}); err == nil {
+		t.Fatal("Expected the update to fail")
+	}
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if logins, logouts := server.CallCount("login"), server.CallCount("logout"); logins != 1 || logouts != 0 {
+		t.Fatalf("Expected one session for all calls, got %v logins and %v logouts", logins, logouts)
+	}
+
+	if err := p.EndSession(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.SessionCount(); count != 0 {
+		t.Fatalf("Expected the session to be ended, got %v sessions", count)
+	}
+
+	// without the session every call has its own one again
+	server.ResetCalls()
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if logins, logouts := server.CallCount("login"), server.CallCount("logout"); logins != 1 || logouts != 1 {
+		t.Fatalf("Expected a session for the call, got %v logins and %v logouts", logins, logouts)
+	}
+}
+
+func TestProvider_LogoutAfterCancellation(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.SessionIdleTimeout = -1
+	ctx, cancel := context.WithCancel(context.Background())
+
+	apiSessionID, err := p.login(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the call was canceled, for example because the DNS challenge timed out
+	cancel()
+	p.logout(ctx, apiSessionID)
+
+	if count := server.SessionCount(); count != 0 {
+		t.Fatalf("Expected the session to be ended despite the canceled context, got %v sessions", count)
+	}
+}
+
+// invalidSession is the failure of netcup for an expired session.
+var invalidSession = netcuptest.Failure{StatusCode: netcuptest.StatusInvalidSession, ShortMessage: "The session id is not in a valid format."}
+
+func TestProvider_SessionExpiresDuringCall(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.SessionIdleTimeout = -1
+	server.FailNext("updateDnsRecords", invalidSession)
+
+	records, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID == "" {
+		t.Fatalf("Expected the appended record, got %+v", records)
+	}
+	if logins := server.CallCount("login"); logins != 2 {
+		t.Fatalf("Expected a login again after the invalid session, got %v logins", logins)
+	}
+	// the call ends the new session
+	calls := server.Calls()
+	if last := calls[len(calls)-1]; last.Action != "logout" || !strings.Contains(string(last.Param), "session2") {
+		t.Fatalf("Expected the logout of the new session, got %v %s", last.Action, last.Param)
+	}
+}
+
+func TestProvider_SessionRenewedOnlyOnce(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.SessionIdleTimeout = -1
+	server.FailNext("updateDnsRecords", invalidSession, invalidSession)
+
+	_, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}})
+	if !isInvalidSession(err) {
+		t.Fatalf("Expected the invalid session error, got %v", err)
+	}
+	if count := server.CallCount("updateDnsRecords"); count != 2 {
+		t.Fatalf("Expected the update to be sent again once, got %v updates", count)
+	}
+}
+
+func TestProvider_SessionRenewalFails(t *testing.T) {
+	p, server := newFakeProvider(t)
+	ctx := context.Background()
+	if err := p.BeginSession(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer p.EndSession(ctx)
+	server.FailNext("updateDnsRecords", invalidSession)
+	server.FailNext("login", netcuptest.Failure{StatusCode: netcuptest.StatusValidationError, ShortMessage: "Login failed."})
+
+	var apiErr *APIError
+	_, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}})
+	if !errors.As(err, &apiErr) || apiErr.Action != "updateDnsRecords" || apiErr.StatusCode != statusInvalidSession {
+		t.Fatalf("Expected the original error of the update, got %v", err)
+	}
+}
+
+func TestProvider_Logout(t *testing.T) {
+	p, server := newFakeProvider(t)
+	ctx := context.Background()
+
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.SessionCount(); count != 0 {
+		t.Fatalf("Expected the cached session to be ended, got %v sessions", count)
+	}
+	// without a session there is nothing to do
+	if err := p.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if logins, logouts := server.CallCount("login"), server.CallCount("logout"); logins != 2 || logouts != 1 {
+		t.Fatalf("Expected a new session after the logout, got %v logins and %v logouts", logins, logouts)
+	}
+}
+
+// sharingProvidersCount makes the customer numbers of newSharingProviders unique, even if a test is run multiple times.
+var sharingProvidersCount int32
+
+// newSharingProviders returns two providers sharing their sessions. The customer number is unique for the test,
+// so the shared sessions of other tests are not used.
+func newSharingProviders(t *testing.T) (*Provider, *Provider, *netcuptest.Server) {
+	first, server := newFakeProvider(t)
+	first.CustomerNumber = fmt.Sprintf("%v-%v", t.Name(), atomic.AddInt32(&sharingProvidersCount, 1))
+	first.ShareSessions = true
+	second := &Provider{CustomerNumber: first.CustomerNumber, APIKey: first.APIKey, APIPassword: first.APIPassword, Endpoint: first.Endpoint, AllowInsecureEndpoint: true, ShareSessions: true}
+	return first, second, server
+}
+
+func TestProvider_ShareSessions(t *testing.T) {
+	first, second, server := newSharingProviders(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for _, p := range []*Provider{first, second, first, second} {
+		p := p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if count := server.CallCount("login"); count != 1 {
+		t.Fatalf("Expected one login for both providers, got %v", count)
+	}
+
+	// the invalid session is replaced for both providers
+	server.ExpireSessions()
+	if _, err := first.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.CallCount("login"); count != 2 {
+		t.Fatalf("Expected one login again for both providers after the session expired, got %v logins", count)
+	}
+}
+
+func TestProvider_ShareSessionsDisabled(t *testing.T) {
+	first, second, server := newSharingProviders(t)
+	second.ShareSessions = false
+
+	for _, p := range []*Provider{first, second} {
+		if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count := server.CallCount("login"); count != 2 {
+		t.Fatalf("Expected a login for every provider, got %v", count)
+	}
+}
+
+func TestProvider_Validate(t *testing.T) {
+	p, server := newFakeProvider(t)
+	ctx := context.Background()
+
+	if err := p.Validate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if logins, logouts := server.CallCount("login"), server.CallCount("logout"); logins != 1 || logouts != 1 {
+		t.Fatalf("Expected a login and a logout, got %v logins and %v logouts", logins, logouts)
+	}
+	if actions := server.Actions(); len(actions) != 2 {
+		t.Fatalf("Expected no other requests, got %v", actions)
+	}
+
+	server.SetCredentials("12345", "key", "other")
+	if err := p.Validate(ctx); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("Expected ErrAuthFailed, got %v", err)
+	}
+
+	server.SetCredentials("12345", "key", "password")
+	p.RetryPolicy.MaxAttempts = 1
+	server.FailNext("login", netcuptest.Failure{CloseConnection: true})
+	if err := p.Validate(ctx); err == nil || errors.Is(err, ErrAuthFailed) || !strings.Contains(err.Error(), "failed to reach") {
+		t.Fatalf("Expected a network error, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+// Persistence of the cached session across processes
+
+package netcup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StoredSession is a session kept in a SessionStore.
+type StoredSession struct {
+	ID       string    `json:"id"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// SessionStore keeps the cached session of a provider, so short-lived processes like a cron job reuse the session of
+// the previous run instead of logging in every time. The provider loads the session before it logs in and saves it
+// after every login and call. Sessions are stored per customer number.
+type SessionStore interface {
+	// LoadSession returns the stored session of the customer, or nil if there is none.
+	LoadSession(ctx context.Context, customerNumber string) (*StoredSession, error)
+	// SaveSession replaces the stored session of the customer. nil deletes it.
+	SaveSession(ctx context.Context, customerNumber string, session *StoredSession) error
+}
+
+const (
+	// interval, in which a locked session file is checked again
+	fileLockRetryInterval = 10 * time.Millisecond
+	// age, after which a lock file is assumed to be left over from a crashed process
+	fileLockStaleAge = 10 * time.Second
+	// sessionStoreTimeout limits saving the session, which doesn't use the context of the call, like the logout
+	sessionStoreTimeout = 10 * time.Second
+)
+
+// FileSessionStore is a SessionStore keeping the sessions in a JSON file. Concurrent processes are serialized
+// with a lock file next to it, named like the file with ".lock" appended. The file contains the session ID,
+// so it should only be readable by its owner, which it is, if it is created by the store.
+type FileSessionStore struct {
+	Path string
+}
+
+func (store *FileSessionStore) LoadSession(ctx context.Context, customerNumber string) (*StoredSession, error) {
+	unlock, err := store.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	sessions, err := store.read()
+	if err != nil {
+		return nil, err
+	}
+	session, found := sessions[customerNumber]
+	if !found {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (store *FileSessionStore) SaveSession(ctx context.Context, customerNumber string, session *StoredSession) error {
+	unlock, err := store.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// a corrupted file is replaced
+	sessions, err := store.read()
+	if err != nil {
+		sessions = make(map[string]StoredSession)
+	}
+	if session == nil {
+		delete(sessions, customerNumber)
+	} else {
+		sessions[customerNumber] = *session
+	}
+	return store.write(sessions)
+}
+
+// Reads the sessions per customer number, which are empty, if the file doesn't exist.
+func (store *FileSessionStore) read() (map[string]StoredSession, error) {
+	sessions := make(map[string]StoredSession)
+	data, err := ioutil.ReadFile(store.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sessions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &sessions); err != nil {
+		return nil, fmt.Errorf("corrupted session file %v: %w", store.Path, err)
+	}
+	return sessions, nil
+}
+
+// Writes the sessions to a temporary file, which replaces the file, so readers never see a partially written file.
+func (store *FileSessionStore) write(sessions map[string]StoredSession) error {
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(store.Path), filepath.Base(store.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), store.Path)
+}
+
+// Creates the lock file exclusively, waiting until the file of another process is removed or the context is done.
+// A lock file older than fileLockStaleAge is removed, since its process has crashed.
+func (store *FileSessionStore) lock(ctx context.Context) (unlock func(), err error) {
+	lockPath := store.Path + ".lock"
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > fileLockStaleAge {
+			os.Remove(lockPath)
+			continue
+		}
+
+		timer := time.NewTimer(fileLockRetryInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("locking session file %v: %w", store.Path, ctx.Err())
+		}
+	}
+}
+
+// Returns the stored session, if there is one that was used within the idle timeout. A session, that can't be loaded,
+// is ignored, so the provider logs in normally.
+func (p *Provider) loadStoredSession(ctx context.Context, idleTimeout time.Duration) *cachedSession {
+	if p.SessionStore == nil {
+		return nil
+	}
+	creds, err := p.credentials(ctx, false)
+	if err != nil {
+		return nil
+	}
+	stored, err := p.SessionStore.LoadSession(ctx, creds.CustomerNumber)
+	if err != nil {
+		p.warnf("%v Failed to load the stored session: %v", loggingPrefixLibdnsNetcup, err)
+		return nil
+	}
+	if stored == nil || stored.ID == "" || time.Since(stored.LastUsed) >= idleTimeout {
+		return nil
+	}
+	return &cachedSession{id: stored.ID, lastUsed: stored.LastUsed}
+}
+
+// Saves the session in the SessionStore, if it is set, or deletes the stored session, if session is nil.
+// Failures are only logged, since the session itself is valid. The session is saved, even if the call was canceled.
+func (p *Provider) storeSession(ctx context.Context, session *cachedSession) {
+	if p.SessionStore == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, sessionStoreTimeout)
+	defer cancel()
+	creds, err := p.credentials(ctx, false)
+	if err != nil {
+		return
+	}
+	var stored *StoredSession
+	if session != nil {
+		stored = &StoredSession{ID: session.id, LastUsed: session.lastUsed}
+	}
+	if err = p.SessionStore.SaveSession(ctx, creds.CustomerNumber, stored); err != nil {
+		p.warnf("%v Failed to store the session: %v", loggingPrefixLibdnsNetcup, err)
+	}
+}
@@ -0,0 +1,149 @@
+package netcup
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newStoringProvider returns a provider like a new process would create it, with the session file in dir.
+func newStoringProvider(p *Provider, dir string) *Provider {
+	return &Provider{
+		CustomerNumber:        p.CustomerNumber,
+		APIKey:                p.APIKey,
+		APIPassword:           p.APIPassword,
+		Endpoint:              p.Endpoint,
+		AllowInsecureEndpoint: true,
+		SessionStore:          &FileSessionStore{Path: filepath.Join(dir, "session.json")},
+	}
+}
+
+func TestProvider_SessionStore(t *testing.T) {
+	template, server := newFakeProvider(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := newStoringProvider(template, dir).GetRecords(ctx, fakeZone); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if logins, logouts := server.CallCount("login"), server.CallCount("logout"); logins != 1 || logouts != 0 {
+		t.Fatalf("Expected the stored session to be reused by every process, got %v logins and %v logouts", logins, logouts)
+	}
+
+	// the session ended by Logout isn't reused
+	if err := newStoringProvider(template, dir).Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newStoringProvider(template, dir).GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if logins := server.CallCount("login"); logins != 2 {
+		t.Fatalf("Expected a login after the logout, got %v logins", logins)
+	}
+}
+
+func TestProvider_SessionStoreExpiredSession(t *testing.T) {
+	template, server := newFakeProvider(t)
+	dir := t.TempDir()
+	ctx := context.Background()
+	if _, err := newStoringProvider(template, dir).GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	// the session expired on netcup, while the process wasn't running
+	server.ExpireSessions()
+	if _, err := newStoringProvider(template, dir).GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	// the new session is stored
+	if _, err := newStoringProvider(template, dir).GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if logins := server.CallCount("login"); logins != 2 {
+		t.Fatalf("Expected one login again after the stored session expired, got %v logins", logins)
+	}
+
+	// a session unused for longer than the idle timeout isn't loaded
+	p := newStoringProvider(template, dir)
+	p.SessionIdleTimeout = time.Nanosecond
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if logins := server.CallCount("login"); logins != 3 {
+		t.Fatalf("Expected a login for the idle stored session, got %v logins", logins)
+	}
+}
+
+func TestProvider_SessionStoreCorrupted(t *testing.T) {
+	template, server := newFakeProvider(t)
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "session.json"), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := newStoringProvider(template, dir).GetRecords(context.Background(), fakeZone); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the corrupted file is replaced after the first login
+	if logins := server.CallCount("login"); logins != 1 {
+		t.Fatalf("Expected one login, got %v", logins)
+	}
+}
+
+func TestFileSessionStore_ConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		customerNumber := string(rune('a' + i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every goroutine uses its own store like a separate process
+			store := &FileSessionStore{Path: filepath.Join(dir, "session.json")}
+			if err := store.SaveSession(ctx, customerNumber, &StoredSession{ID: "session-" + customerNumber, LastUsed: time.Now()}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	store := &FileSessionStore{Path: filepath.Join(dir, "session.json")}
+	for i := 0; i < 10; i++ {
+		customerNumber := string(rune('a' + i))
+		session, err := store.LoadSession(ctx, customerNumber)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session == nil || session.ID != "session-"+customerNumber {
+			t.Fatalf("Expected the session of customer %v to be kept, got %+v", customerNumber, session)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "session.json.lock")); !os.IsNotExist(err) {
+		t.Fatalf("Expected the lock file to be removed, got %v", err)
+	}
+}
+
+func TestFileSessionStore_LockWaitsForContext(t *testing.T) {
+	dir := t.TempDir()
+	store := &FileSessionStore{Path: filepath.Join(dir, "session.json")}
+	// another process holds the lock
+	if err := ioutil.WriteFile(store.Path+".lock", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := store.LoadSession(ctx, "12345"); err == nil {
+		t.Fatal("Expected loading to fail while the file is locked")
+	}
+}
@@ -0,0 +1,49 @@
+//go:build go1.21
+
+// Structured logging with log/slog
+
+package netcup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// NewSlogLogger returns a Logger, which writes structured entries to the given *slog.Logger, for example as Provider.Logger.
+// Every request is logged at debug level with the attributes action, zone, duration, statuscode and clientrequestid,
+// failed attempts at warn level and failed requests at error level. Credentials and session IDs are never logged.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+// slogLogger adapts a *slog.Logger to Logger.
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (logger *slogLogger) Printf(format string, v ...interface{}) {
+	logger.logger.Info(fmt.Sprintf(format, v...))
+}
+
+func (logger *slogLogger) logEntry(ctx context.Context, level logLevel, msg string, attrs []logAttr) {
+	slogAttrs := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		slogAttrs[i] = slog.Any(attr.key, attr.value)
+	}
+	logger.logger.LogAttrs(ctx, slogLevel(level), msg, slogAttrs...)
+}
+
+// Returns the slog level of the level.
+func slogLevel(level logLevel) slog.Level {
+	switch level {
+	case levelDebug:
+		return slog.LevelDebug
+	case levelWarn:
+		return slog.LevelWarn
+	case levelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
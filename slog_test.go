@@ -0,0 +1,73 @@
+//go:build go1.21
+
+package netcup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// lockedBuffer is a bytes.Buffer safe for the concurrent requests.
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buffer *lockedBuffer) Write(data []byte) (int, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.buffer.Write(data)
+}
+
+func (buffer *lockedBuffer) String() string {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.buffer.String()
+}
+
+func TestProvider_SlogLogger(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.APIKey = "secret-api-key"
+	p.APIPassword = "secret-api-password"
+	var output lockedBuffer
+	p.Logger = NewSlogLogger(slog.New(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	server.FailNext("infoDnsRecords", netcuptest.Failure{StatusCode: 4013, ShortMessage: "Validation Error.", LongMessage: "Invalid zone."})
+
+	if _, err := p.GetRecords(context.Background(), fakeZone); err == nil {
+		t.Fatal("Expected the failure of the request")
+	}
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	var login, failedAttempt, failure bool
+	for _, entry := range entries {
+		switch {
+		case entry["msg"] == "netcup request" && entry["action"] == "login":
+			login = entry["level"] == "DEBUG" && entry["statuscode"] == float64(2000) && entry["clientrequestid"] != "" && entry["duration"] != nil
+		case entry["msg"] == "netcup request failed" && entry["action"] == "infoDnsRecords":
+			failedAttempt = entry["level"] == "WARN" && entry["zone"] == fakeZone && entry["statuscode"] == float64(4013)
+		case strings.Contains(entry["msg"].(string), "Request infoDnsRecords failed"):
+			failure = entry["level"] == "ERROR"
+		}
+	}
+	if !login || !failedAttempt || !failure {
+		t.Fatalf("Expected entries for the login, the failed attempt and the failure, got %v", output.String())
+	}
+	if strings.Contains(output.String(), p.APIPassword) || strings.Contains(output.String(), p.APIKey) || strings.Contains(output.String(), "session1") {
+		t.Fatalf("Expected no credentials or session IDs, got %v", output.String())
+	}
+}
@@ -0,0 +1,150 @@
+// Statistics of the requests to netcup per operation
+
+package netcup
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// OperationStats are the statistics of the requests to netcup made by one operation, passed to Provider.OnStats.
+type OperationStats struct {
+	// Operation is the name of the operation like "get", "append", "set", "delete" or "sync", as sent with the webhook
+	Operation string
+	Zone      string
+	// Duration is the run time of the operation, including the waits for locks, rate limits and retries
+	Duration time.Duration
+	// Requests is the number of requests sent to netcup, including the retries
+	Requests int
+	// Retries is the number of requests sent again after a failure
+	Retries int
+	// BytesSent and BytesReceived are the sizes of the request and response bodies on the wire, after compression
+	BytesSent     int64
+	BytesReceived int64
+	// Actions contains the statistics per API action like "login", "infoDnsRecords" or "updateDnsRecords"
+	Actions map[string]ActionStats
+}
+
+// ActionStats are the statistics of the requests of one API action within an operation.
+type ActionStats struct {
+	Requests int
+	// Failures is the number of requests, that failed, including the ones that were retried successfully
+	Failures int
+	// Duration is the total time from sending the requests to reading their responses
+	Duration time.Duration
+}
+
+// statsKey is the context key for the statsCollector of an operation
+type statsKey struct{}
+
+// statsCollector collects the statistics of one operation for OnStats, reports the operation to Metrics and ends its
+// span. A nil collector collects nothing.
+type statsCollector struct {
+	hook    func(OperationStats)
+	metrics Metrics
+	span    Span
+	start   time.Time
+
+	mutex sync.Mutex
+	stats OperationStats
+}
+
+// Returns a context, whose requests are counted for the operation and traced as children of its span, and the
+// collector, nil if neither OnStats, Metrics nor Tracer is set. finish must be called with the error of the operation,
+// when it is finished.
+func (p *Provider) startStats(ctx context.Context, operation string, zone string) (context.Context, *statsCollector) {
+	if p.OnStats == nil && p.Metrics == nil && p.Tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := p.startOperationSpan(ctx, operation, zone)
+	collector := &statsCollector{
+		hook:    p.OnStats,
+		metrics: p.Metrics,
+		span:    span,
+		start:   time.Now(),
+		stats:   OperationStats{Operation: operation, Zone: unFQDN(zone), Actions: make(map[string]ActionStats)},
+	}
+	return context.WithValue(ctx, statsKey{}, collector), collector
+}
+
+// Returns the collector of the operation of the context, nil if there is none.
+func statsFromContext(ctx context.Context) *statsCollector {
+	collector, _ := ctx.Value(statsKey{}).(*statsCollector)
+	return collector
+}
+
+// Counts a request sent to netcup.
+func (collector *statsCollector) request(action string, duration time.Duration, sent int64, received int64, err error) {
+	if collector == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.stats.Requests++
+	collector.stats.BytesSent += sent
+	collector.stats.BytesReceived += received
+	actionStats := collector.stats.Actions[action]
+	actionStats.Requests++
+	actionStats.Duration += duration
+	if err != nil {
+		actionStats.Failures++
+	}
+	collector.stats.Actions[action] = actionStats
+}
+
+// Counts a retry of a failed request.
+func (collector *statsCollector) retry() {
+	if collector == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.stats.Retries++
+}
+
+// Sets the number of records passed to the operation or returned by it as attribute of its span.
+func (collector *statsCollector) records(count int) {
+	if collector == nil || collector.span == nil {
+		return
+	}
+	collector.span.SetAttribute(AttributeRecords, count)
+}
+
+// Passes the statistics of the finished operation to the hook and its duration and error to Metrics, and ends its span.
+func (collector *statsCollector) finish(err error) {
+	if collector == nil {
+		return
+	}
+	if collector.span != nil {
+		collector.span.End(err)
+	}
+	if collector.metrics != nil {
+		collector.metrics.ObserveOperation(collector.stats.Operation, time.Since(collector.start), err)
+	}
+	if collector.hook == nil {
+		return
+	}
+	collector.mutex.Lock()
+	stats := collector.stats
+	stats.Duration = time.Since(collector.start)
+	stats.Actions = make(map[string]ActionStats, len(collector.stats.Actions))
+	for action, actionStats := range collector.stats.Actions {
+		stats.Actions[action] = actionStats
+	}
+	collector.mutex.Unlock()
+	collector.hook(stats)
+}
+
+// countingReadCloser counts the bytes read from a response body.
+type countingReadCloser struct {
+	io.ReadCloser
+	count int64
+}
+
+func (body *countingReadCloser) Read(data []byte) (int, error) {
+	n, err := body.ReadCloser.Read(data)
+	body.count += int64(n)
+	return n, err
+}
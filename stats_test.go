@@ -0,0 +1,105 @@
+package netcup
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// Returns a hook collecting the statistics and a function returning them.
+func collectStats() (func(OperationStats), func() []OperationStats) {
+	var mutex sync.Mutex
+	var collected []OperationStats
+	hook := func(stats OperationStats) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		collected = append(collected, stats)
+	}
+	return hook, func() []OperationStats {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]OperationStats(nil), collected...)
+	}
+}
+
+func TestProvider_OnStats(t *testing.T) {
+	p, server := newFakeProvider(t)
+	hook, collected := collectStats()
+	p.OnStats = hook
+	server.SetLatency("updateDnsRecords", 50*time.Millisecond)
+
+	if _, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+	all := collected()
+	if len(all) != 1 {
+		t.Fatalf("Expected the statistics of one operation, got %+v", all)
+	}
+	stats := all[0]
+	if stats.Operation != "append" || stats.Zone != fakeZone {
+		t.Fatalf("Unexpected operation %+v", stats)
+	}
+	if stats.Requests != len(server.Calls()) || stats.Retries != 0 {
+		t.Fatalf("Expected %v requests without retries, got %+v", len(server.Calls()), stats)
+	}
+	if stats.BytesSent == 0 || stats.BytesReceived == 0 {
+		t.Fatalf("Expected the bytes transferred, got %+v", stats)
+	}
+
+	var requests int
+	for _, action := range server.Actions() {
+		if stats.Actions[action].Requests == 0 {
+			t.Fatalf("Expected the statistics of %v, got %+v", action, stats.Actions)
+		}
+	}
+	for _, actionStats := range stats.Actions {
+		requests += actionStats.Requests
+	}
+	if requests != stats.Requests {
+		t.Fatalf("Expected the actions to add up to the operation, got %+v", stats)
+	}
+	// the delay of the fake endpoint is attributed to the update
+	if update := stats.Actions["updateDnsRecords"]; update.Requests != 1 || update.Duration < 50*time.Millisecond || update.Duration > stats.Duration {
+		t.Fatalf("Expected the update to take at least 50ms, got %+v", update)
+	}
+	if login := stats.Actions["login"]; login.Duration >= 50*time.Millisecond {
+		t.Fatalf("Expected the login to be fast, got %+v", login)
+	}
+}
+
+func TestProvider_OnStatsRetries(t *testing.T) {
+	p, server := newFakeProvider(t)
+	hook, collected := collectStats()
+	p.OnStats = hook
+	p.RetryPolicy = RetryPolicy{BaseDelay: time.Millisecond}
+	server.FailNext("infoDnsRecords", netcuptest.Failure{HTTPStatusCode: 503, ShortMessage: "Service Unavailable"})
+
+	if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	all := collected()
+	if len(all) != 1 || all[0].Operation != "get" {
+		t.Fatalf("Expected the statistics of the read, got %+v", all)
+	}
+	if stats := all[0]; stats.Retries != 1 || stats.Actions["infoDnsRecords"].Requests != 2 || stats.Actions["infoDnsRecords"].Failures != 1 {
+		t.Fatalf("Expected the failed request and its retry, got %+v", stats)
+	}
+}
+
+func TestProvider_OnStatsDisabled(t *testing.T) {
+	p, _ := newFakeProvider(t)
+	ctx := context.Background()
+
+	// without hook nothing is collected
+	statsCtx, stats := p.startStats(ctx, "get", fakeZone)
+	if stats != nil || statsCtx != ctx {
+		t.Fatalf("Expected no collector without OnStats, got %+v", stats)
+	}
+	if _, err := p.GetRecords(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+}
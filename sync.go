@@ -0,0 +1,169 @@
+// Synchronization of a zone with a desired set of records
+
+package netcup
+
+import (
+	"context"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// defaultChunkSize is the number of records sent with one update, if SyncOptions.ChunkSize is not set
+const defaultChunkSize = 50
+
+// SyncOptions configure SyncRecords and StartSync.
+type SyncOptions struct {
+	// ChunkSize is the maximum number of records sent to netcup with one update. Defaults to 50.
+	ChunkSize int
+}
+
+// ChangeResult contains the records changed by an operation with their IDs and values after the change,
+// except for the deleted records, which have their values before the change.
+type ChangeResult struct {
+	Appended []libdns.Record
+	Updated  []libdns.Record
+	Deleted  []libdns.Record
+	// Previous contains the values of the updated records before the change, in the order of Updated
+	Previous []libdns.Record
+}
+
+// SyncRecords changes the zone, so that it contains exactly the desired records: existing records equal to a desired record
+// are kept, other existing records with the host name and type of a desired record are updated with the remaining values,
+// missing records are appended and all other records are deleted. The IDs of the desired records are ignored.
+//
+// The changes are sent to netcup in chunks of SyncOptions.ChunkSize records, so a large zone doesn't exceed the limits of a
+// single request. If the context is done between two chunks, the changes so far are returned with the error of the context.
+func (p *Provider) SyncRecords(ctx context.Context, zone string, desired []libdns.Record, options SyncOptions) (*ChangeResult, error) {
+	return p.syncRecords(ctx, zone, desired, options, nil)
+}
+
+// Implements SyncRecords. progress is called after each chunk with the number of records sent so far and in total, if it is set.
+func (p *Provider) syncRecords(ctx context.Context, zone string, desired []libdns.Record, options SyncOptions, progress func(done, total int)) (_ *ChangeResult, err error) {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+
+	if err := p.checkZoneAllowed(zone, false); err != nil {
+		return nil, err
+	}
+	if err := checkRecordTypes(desired); err != nil {
+		return nil, err
+	}
+
+	reporter := p.startProgress(ctx, "sync", zone)
+	defer reporter.finish()
+	ctx, stats := p.startStats(ctx, "sync", zone)
+	defer func() { stats.finish(err) }()
+	stats.records(len(desired))
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	p.logf("%v Syncing %v records to zone %v", loggingPrefixLibdnsNetcup, len(desired), zone)
+
+	ctx, _ = p.withClientRequestID(ctx)
+
+	ctx = p.withCustomer(ctx, zone)
+	apiSessionID, err := p.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer p.logout(ctx, apiSessionID)
+
+	shortZone := unFQDN(zone)
+	reporter.phase(PhaseReading)
+	dnsZone, existingRecordSet, err := p.getZoneAndRecords(ctx, shortZone, apiSessionID, true, false)
+	if err != nil {
+		return nil, err
+	}
+	ttl := p.zoneTTL(dnsZone)
+
+	updates := getRecordsToSync(toNetcupRecords(zone, desired), existingRecordSet.DnsRecords)
+	if err = p.checkDeleteThreshold(ctx, shortZone, updates, len(existingRecordSet.DnsRecords), ttl); err != nil {
+		return nil, err
+	}
+	if p.dryRun(ctx) {
+		return p.planChanges(shortZone, "sync", existingRecordSet.DnsRecords, updates, ttl), nil
+	}
+
+	chunkSize := options.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	if progress != nil {
+		progress(0, len(updates))
+	}
+	reporter.updating((len(updates)+chunkSize-1)/chunkSize, len(updates))
+
+	updatedRecords := existingRecordSet.DnsRecords
+	for start := 0; start < len(updates); start += chunkSize {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		end := start + chunkSize
+		if end > len(updates) {
+			end = len(updates)
+		}
+
+		var updatedRecordSet *dnsRecordSet
+		updatedRecordSet, err = p.updateDNSRecords(ctx, shortZone, dnsRecordSet{DnsRecords: updates[start:end]}, apiSessionID)
+		if err != nil {
+			break
+		}
+		updatedRecords = updatedRecordSet.DnsRecords
+		reporter.chunkDone(end - start)
+		if progress != nil {
+			progress(end, len(updates))
+		}
+	}
+
+	p.notifyWebhook(ctx, shortZone, "sync", existingRecordSet.DnsRecords, updatedRecords, ttl)
+	p.recordChange(ctx, shortZone, "sync", existingRecordSet.DnsRecords, updatedRecords, ttl)
+	p.notifyChange(ctx, shortZone, "sync", existingRecordSet.DnsRecords, updatedRecords, ttl)
+
+	return changeResult(existingRecordSet.DnsRecords, updatedRecords, ttl), err
+}
+
+// Returns the updates needed, so that existingRecords equal the desired records. The IDs of the desired records are ignored.
+// Names and types are compared like in getRecordsToSet, case-insensitively.
+func getRecordsToSync(desired []dnsRecord, existingRecords []dnsRecord) []dnsRecord {
+	groups := make(map[recordGroup]bool)
+	for i := range desired {
+		desired[i].ID = ""
+		groups[recordGroup{hostName: canonicalName(desired[i].HostName), recType: canonicalType(desired[i].RecType)}] = true
+	}
+
+	updates := getRecordsToSet(desired, existingRecords, MatchByNameType)
+	for _, record := range existingRecords {
+		if !groups[recordGroup{hostName: canonicalName(record.HostName), recType: canonicalType(record.RecType)}] {
+			record.DeleteRecord = true
+			updates = append(updates, record)
+		}
+	}
+
+	return updates
+}
+
+// Returns the changes between the records before and after an update, matched by ID.
+func changeResult(before []dnsRecord, after []dnsRecord, ttl time.Duration) *ChangeResult {
+	result := &ChangeResult{}
+	for _, record := range before {
+		afterRecord := findRecordByID(record.ID, after)
+		if afterRecord == nil {
+			result.Deleted = append(result.Deleted, toLibdnsRecords([]dnsRecord{record}, ttl)...)
+		} else if !afterRecord.equals(record) {
+			result.Updated = append(result.Updated, toLibdnsRecords([]dnsRecord{*afterRecord}, ttl)...)
+			result.Previous = append(result.Previous, toLibdnsRecords([]dnsRecord{record}, ttl)...)
+		}
+	}
+	for _, record := range after {
+		if findRecordByID(record.ID, before) == nil {
+			result.Appended = append(result.Appended, toLibdnsRecords([]dnsRecord{record}, ttl)...)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,108 @@
+package netcup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+func TestProvider_SyncRecords(t *testing.T) {
+	p, server := newFakeProvider(t,
+		netcuptest.Record{ID: "1", HostName: "www", Type: "A", Destination: "192.0.2.1"},
+		netcuptest.Record{ID: "2", HostName: "www", Type: "A", Destination: "192.0.2.2"},
+		netcuptest.Record{ID: "3", HostName: "mail", Type: "A", Destination: "192.0.2.3"},
+		netcuptest.Record{ID: "4", HostName: "@", Type: "TXT", Destination: "old"},
+	)
+
+	result, err := p.SyncRecords(context.Background(), fakeZone, []libdns.Record{
+		{Type: "A", Name: "www", Value: "192.0.2.1"},
+		{Type: "A", Name: "www", Value: "192.0.2.5"},
+		{Type: "AAAA", Name: "www", Value: "2001:db8::1"},
+		// IDs of the desired records are ignored
+		{ID: "3", Type: "TXT", Name: "@", Value: "new"},
+	}, SyncOptions{ChunkSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values []string
+	for _, record := range server.Records(fakeZone) {
+		values = append(values, record.HostName+" "+record.Type+" "+record.Destination)
+	}
+	sort.Strings(values)
+	expected := []string{"@ TXT new", "www A 192.0.2.1", "www A 192.0.2.5", "www AAAA 2001:db8::1"}
+	if fmt.Sprint(values) != fmt.Sprint(expected) {
+		t.Fatalf("Expected the zone to contain %v, got %v", expected, values)
+	}
+
+	if len(result.Appended) != 1 || result.Appended[0].Type != "AAAA" || result.Appended[0].ID == "" {
+		t.Fatalf("Expected the AAAA record with its ID as appended, got %+v", result.Appended)
+	}
+	if len(result.Updated) != 2 {
+		t.Fatalf("Expected the second www A record and the TXT record as updated, got %+v", result.Updated)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0].ID != "3" || result.Deleted[0].Value != "192.0.2.3" {
+		t.Fatalf("Expected the mail record as deleted, got %+v", result.Deleted)
+	}
+	// 4 updates in chunks of 2
+	if count := server.CallCount("updateDnsRecords"); count != 2 {
+		t.Fatalf("Expected 2 updates, got %v", count)
+	}
+}
+
+func TestProvider_SyncRecordsWithoutChanges(t *testing.T) {
+	p, server := newFakeProvider(t, netcuptest.Record{ID: "1", HostName: "www", Type: "A", Destination: "192.0.2.1"})
+
+	result, err := p.SyncRecords(context.Background(), fakeZone, []libdns.Record{{Type: "A", Name: "www", Value: "192.0.2.1"}}, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Appended)+len(result.Updated)+len(result.Deleted) != 0 {
+		t.Fatalf("Expected no changes, got %+v", result)
+	}
+	if count := server.CallCount("updateDnsRecords"); count != 0 {
+		t.Fatalf("Expected no update, got %v", count)
+	}
+}
+
+func TestProvider_SyncRecordsMixedCase(t *testing.T) {
+	p, server := newFakeProvider(t, netcuptest.Record{ID: "1", HostName: "www", Type: "A", Destination: "192.0.2.1"})
+
+	// names and types are compared case-insensitively, so the record is updated and not deleted as well
+	result, err := p.SyncRecords(context.Background(), fakeZone, []libdns.Record{{Type: "a", Name: "WWW", Value: "192.0.2.5"}}, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Updated) != 1 || result.Updated[0].ID != "1" || len(result.Deleted) != 0 || len(result.Appended) != 0 {
+		t.Fatalf("Expected the record to be updated, got %+v", result)
+	}
+	for _, call := range server.Calls() {
+		if call.Action == "updateDnsRecords" && strings.Contains(string(call.Param), `"deleterecord":true`) {
+			t.Fatalf("Expected no deletion in the update, got %s", call.Param)
+		}
+	}
+	if records := server.Records(fakeZone); len(records) != 1 || records[0].Destination != "192.0.2.5" {
+		t.Fatalf("Expected the updated record, got %+v", records)
+	}
+}
+
+func TestProvider_SyncRecordsDeleteThreshold(t *testing.T) {
+	p, server := newFakeProvider(t,
+		netcuptest.Record{ID: "1", HostName: "www", Type: "A", Destination: "192.0.2.1"},
+		netcuptest.Record{ID: "2", HostName: "mail", Type: "A", Destination: "192.0.2.2"},
+	)
+	p.MaxDeleteCount = 1
+
+	_, err := p.SyncRecords(context.Background(), fakeZone, nil, SyncOptions{})
+	if err == nil {
+		t.Fatal("Expected the sync to fail with the delete threshold")
+	}
+	if count := server.CallCount("updateDnsRecords"); count != 0 {
+		t.Fatalf("Expected no update, got %v", count)
+	}
+}
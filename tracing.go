@@ -0,0 +1,86 @@
+// Tracing of the operations and their requests to netcup, for example with OpenTelemetry
+
+package netcup
+
+import (
+	"context"
+	"errors"
+)
+
+// Tracer starts the spans of the operations of the provider and their requests to netcup, for example to trace them
+// with OpenTelemetry without a dependency of the provider on it. The package otel of this module is an adapter.
+// The spans are children of the span of the context, so the ones of the requests are children of their operation.
+type Tracer interface {
+	// StartOperation starts the span of an operation, like the libdns methods, with its name like "get", "append",
+	// "set", "delete" or "sync", and returns a context with the span.
+	StartOperation(ctx context.Context, operation string) (context.Context, Span)
+	// StartRequest starts the span of a request to netcup with its action, like "login" or "updateDnsRecords", and
+	// returns a context with the span. Retries are requests of their own.
+	StartRequest(ctx context.Context, action string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute sets an attribute of the span. The value is a string or an int.
+	SetAttribute(key string, value interface{})
+	// End ends the span with the error of the operation or request, nil if it succeeded.
+	End(err error)
+}
+
+// The attributes of the spans
+const (
+	// AttributeZone is the zone of an operation, without the trailing dot
+	AttributeZone = "netcup.zone"
+	// AttributeRecords is the number of records passed to an operation, like the desired records of SyncRecords, or
+	// returned by GetRecords, and the number of records sent with updateDnsRecords
+	AttributeRecords = "netcup.records"
+	// AttributeAction is the API action of a request
+	AttributeAction = "netcup.action"
+	// AttributeClientRequestID is the client request ID of a request
+	AttributeClientRequestID = "netcup.client_request_id"
+	// AttributeStatusCode is the status code of netcup in the response to a request, like 2000 or 4013
+	AttributeStatusCode = "netcup.status_code"
+)
+
+// Returns a context with the span of the operation and the span, nil if no Tracer is set.
+func (p *Provider) startOperationSpan(ctx context.Context, operation string, zone string) (context.Context, Span) {
+	if p.Tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := p.Tracer.StartOperation(ctx, operation)
+	if zone != "" {
+		span.SetAttribute(AttributeZone, unFQDN(zone))
+	}
+	return ctx, span
+}
+
+// Returns a context with the span of a request to netcup and the span, nil if no Tracer is set.
+func (p *Provider) startRequestSpan(ctx context.Context, req request) (context.Context, Span) {
+	if p.Tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := p.Tracer.StartRequest(ctx, req.Action)
+	span.SetAttribute(AttributeAction, req.Action)
+	span.SetAttribute(AttributeClientRequestID, req.Param.ClientRequestID)
+	if req.Param.DomainName != "" {
+		span.SetAttribute(AttributeZone, req.Param.DomainName)
+	}
+	if req.Action == "updateDnsRecords" {
+		span.SetAttribute(AttributeRecords, len(req.Param.DNSRecordSet.DnsRecords))
+	}
+	return ctx, span
+}
+
+// Ends the span of a request with the status code of netcup, if there is a response, and the error of the request.
+func endRequestSpan(span Span, res *response, err error) {
+	if span == nil {
+		return
+	}
+	var apiErr *APIError
+	if res != nil {
+		span.SetAttribute(AttributeStatusCode, res.StatusCode)
+	} else if errors.As(err, &apiErr) {
+		span.SetAttribute(AttributeStatusCode, apiErr.StatusCode)
+	}
+	span.End(err)
+}
@@ -0,0 +1,135 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+// parentKey is the context key for the span started by the recordingTracer
+type parentKey struct{}
+
+// recordingTracer records the spans in the order they were ended.
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	tracer     *recordingTracer
+	name       string
+	parent     *recordingSpan
+	attributes map[string]interface{}
+	err        error
+}
+
+func (tracer *recordingTracer) StartOperation(ctx context.Context, operation string) (context.Context, Span) {
+	return tracer.start(ctx, "operation "+operation)
+}
+
+func (tracer *recordingTracer) StartRequest(ctx context.Context, action string) (context.Context, Span) {
+	return tracer.start(ctx, "request "+action)
+}
+
+func (tracer *recordingTracer) start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(parentKey{}).(*recordingSpan)
+	span := &recordingSpan{tracer: tracer, name: name, parent: parent, attributes: make(map[string]interface{})}
+	return context.WithValue(ctx, parentKey{}, span), span
+}
+
+func (span *recordingSpan) SetAttribute(key string, value interface{}) {
+	span.tracer.mutex.Lock()
+	defer span.tracer.mutex.Unlock()
+	span.attributes[key] = value
+}
+
+func (span *recordingSpan) End(err error) {
+	span.tracer.mutex.Lock()
+	defer span.tracer.mutex.Unlock()
+	span.err = err
+	span.tracer.spans = append(span.tracer.spans, span)
+}
+
+// Returns the ended spans with the name.
+func (tracer *recordingTracer) find(name string) []*recordingSpan {
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	var spans []*recordingSpan
+	for _, span := range tracer.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestProvider_Tracer(t *testing.T) {
+	p, _ := newFakeProvider(t)
+	tracer := &recordingTracer{}
+	p.Tracer = tracer
+	root := &recordingSpan{tracer: tracer, name: "caller"}
+	ctx := context.WithValue(context.Background(), parentKey{}, root)
+	records := []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}, {Type: "A", Name: "www", Value: "192.0.2.1"}}
+
+	if _, err := p.AppendRecords(ctx, fakeZone, records); err != nil {
+		t.Fatal(err)
+	}
+
+	// the span of the operation is a child of the span of the context
+	operations := tracer.find("operation append")
+	if len(operations) != 1 {
+		t.Fatalf("Expected one span of the operation, got %v", len(operations))
+	}
+	operation := operations[0]
+	if operation.parent != root || operation.err != nil {
+		t.Fatalf("Expected a successful span with the span of the context as parent, got %+v", operation)
+	}
+	if operation.attributes[AttributeZone] != fakeZone || operation.attributes[AttributeRecords] != 2 {
+		t.Fatalf("Expected the zone and the number of records as attributes, got %v", operation.attributes)
+	}
+
+	// every request has a span as child of the operation, the session is kept for the next operation
+	for _, action := range []string{"login", "infoDnsRecords", "updateDnsRecords"} {
+		spans := tracer.find("request " + action)
+		if len(spans) == 0 {
+			t.Fatalf("Expected a span of %v", action)
+		}
+		for _, span := range spans {
+			if span.parent != operation {
+				t.Fatalf("Expected the span of %v to be a child of the operation", action)
+			}
+			if span.attributes[AttributeAction] != action || span.attributes[AttributeStatusCode] != 2000 || span.attributes[AttributeClientRequestID] == "" {
+				t.Fatalf("Expected the action, status code and client request ID as attributes of %v, got %v", action, span.attributes)
+			}
+		}
+	}
+	update := tracer.find("request updateDnsRecords")[0]
+	if update.attributes[AttributeZone] != fakeZone || update.attributes[AttributeRecords] != 2 {
+		t.Fatalf("Expected the zone and the number of records sent as attributes of the update, got %v", update.attributes)
+	}
+}
+
+func TestProvider_TracerFailure(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.RetryPolicy.MaxAttempts = 1
+	tracer := &recordingTracer{}
+	p.Tracer = tracer
+	server.FailNext("infoDnsRecords", netcuptest.Failure{StatusCode: 5029, ShortMessage: "Can not get DNS records for zone."})
+
+	_, err := p.GetRecords(context.Background(), fakeZone)
+	if err == nil {
+		t.Fatal("Expected the failure of infoDnsRecords")
+	}
+	request := tracer.find("request infoDnsRecords")[0]
+	var apiErr *APIError
+	if !errors.As(request.err, &apiErr) || request.attributes[AttributeStatusCode] != 5029 {
+		t.Fatalf("Expected the span of the request to end with the APIError and its status code, got %v and %v", request.err, request.attributes)
+	}
+	if operation := tracer.find("operation get")[0]; operation.err == nil {
+		t.Fatal("Expected the span of the operation to end with the error")
+	}
+}
@@ -0,0 +1,292 @@
+// Temporary lowering of the zone TTL, for example around ACME DNS challenges
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ttlMarkerHostName is the host name of the TXT record, that stores the original zone TTL while it is lowered.
+// It makes sure the original TTL can be restored, even if the process crashed before RestoreTTL was called.
+const ttlMarkerHostName = "_libdns_netcup_ttl"
+
+// Range of the zone TTL accepted by netcup, in seconds
+const (
+	minZoneTTL = 300
+	maxZoneTTL = 2147483647
+)
+
+// ErrInvalidTTL is returned by SetZoneTTL and LowerTTL, if the TTL is outside of the range accepted by netcup.
+var ErrInvalidTTL = errors.New("invalid TTL")
+
+// LowerTTL lowers the TTL of the zone to the given value, if the current TTL is higher.
+// netcup has only one TTL for the whole zone, so with a high TTL (netcup's default is one day) new or
+// deleted records, like DNS challenges, take a long time to propagate.
+//
+// Before the TTL is changed, the original TTL is stored in a TXT record with the host name "_libdns_netcup_ttl".
+// RestoreTTL has to be called afterwards to restore the original TTL and delete the TXT record. If the process
+// crashes in between, calling RestoreTTL on startup restores the TTL from the TXT record.
+//
+// Calls for the same zone are counted: only the first call lowers the TTL and only the matching last call of
+// RestoreTTL restores it, so concurrent challenges in the same zone don't restore the TTL too early.
+//
+// The TTL is rounded to whole seconds like by SetZoneTTL, and TTLs netcup doesn't accept fail with ErrInvalidTTL before
+// anything is changed.
+func (p *Provider) LowerTTL(ctx context.Context, zone string, ttl time.Duration) (err error) {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+	ctx, stats := p.startStats(ctx, "lower_ttl", zone)
+	defer func() { stats.finish(err) }()
+
+	if err := p.checkZoneAllowed(zone, false); err != nil {
+		return err
+	}
+	ttlSeconds, err := zoneTTLSeconds(ttl)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	shortZone := unFQDN(zone)
+	danceKey := normalizeZone(zone)
+	p.ttlDancesMutex.Lock()
+	lowered := p.ttlDances[danceKey] > 0
+	if lowered {
+		p.ttlDances[danceKey]++
+	}
+	p.ttlDancesMutex.Unlock()
+	if lowered {
+		return nil
+	}
+
+	p.logf("%v Lowering TTL of zone %v to %v", loggingPrefixLibdnsNetcup, zone, ttl)
+
+	ctx = p.withCustomer(ctx, zone)
+	apiSessionID, err := p.login(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.logout(ctx, apiSessionID)
+
+	dnsZone, recordSet, err := p.getZoneAndRecords(ctx, shortZone, apiSessionID, true, true)
+	if err != nil {
+		return err
+	}
+
+	// a zone without TTL is treated as having the default TTL, which is kept in the marker and restored later
+	dnsZone.TTL = int64(p.zoneTTL(dnsZone) / time.Second)
+	// a marker left over from a crash already contains the original TTL, which must not be overwritten with the lowered one
+	marker := findRecordByNameAndType(ttlMarkerHostName, "TXT", recordSet.DnsRecords)
+	if marker == nil && dnsZone.TTL > ttlSeconds {
+		markerRecordSet := dnsRecordSet{
+			DnsRecords: []dnsRecord{{
+				HostName:    ttlMarkerHostName,
+				RecType:     "TXT",
+				Destination: strconv.FormatInt(dnsZone.TTL, 10),
+			}},
+		}
+		if _, err = p.updateDNSRecords(ctx, shortZone, markerRecordSet, apiSessionID); err != nil {
+			return err
+		}
+	}
+
+	if dnsZone.TTL > ttlSeconds {
+		dnsZone.TTL = ttlSeconds
+		if _, err = p.updateDNSZone(ctx, shortZone, *dnsZone, apiSessionID); err != nil {
+			return err
+		}
+	}
+
+	p.ttlDancesMutex.Lock()
+	if p.ttlDances == nil {
+		p.ttlDances = make(map[string]int)
+	}
+	p.ttlDances[danceKey] = 1
+	p.ttlDancesMutex.Unlock()
+
+	return nil
+}
+
+// RestoreTTL restores the TTL of the zone, that was lowered by LowerTTL, and deletes the TXT record containing the original TTL.
+// If LowerTTL was called multiple times for the zone, only the last matching call restores the TTL.
+// Without a preceding call of LowerTTL in this process, the TTL is restored from the TXT record, if it exists.
+func (p *Provider) RestoreTTL(ctx context.Context, zone string) (err error) {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+	ctx, stats := p.startStats(ctx, "restore_ttl", zone)
+	defer func() { stats.finish(err) }()
+
+	if err := p.checkZoneAllowed(zone, false); err != nil {
+		return err
+	}
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	shortZone := unFQDN(zone)
+	danceKey := normalizeZone(zone)
+	p.ttlDancesMutex.Lock()
+	pending := p.ttlDances[danceKey] > 1
+	if pending {
+		p.ttlDances[danceKey]--
+	} else {
+		delete(p.ttlDances, danceKey)
+	}
+	p.ttlDancesMutex.Unlock()
+	if pending {
+		return nil
+	}
+
+	p.logf("%v Restoring TTL of zone %v", loggingPrefixLibdnsNetcup, zone)
+
+	ctx = p.withCustomer(ctx, zone)
+	apiSessionID, err := p.login(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.logout(ctx, apiSessionID)
+
+	dnsZone, recordSet, err := p.getZoneAndRecords(ctx, shortZone, apiSessionID, true, true)
+	if err != nil {
+		return err
+	}
+
+	marker := findRecordByNameAndType(ttlMarkerHostName, "TXT", recordSet.DnsRecords)
+	if marker == nil {
+		return nil
+	}
+
+	originalTTL, err := strconv.ParseInt(marker.Destination, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%v invalid original TTL %q in record %v: %v", loggingPrefixLibdnsNetcup, marker.Destination, ttlMarkerHostName, err)
+	}
+
+	// the TTL is restored before the marker is deleted, so a crash in between doesn't lose the original TTL
+	if dnsZone.TTL != originalTTL {
+		dnsZone.TTL = originalTTL
+		if _, err = p.updateDNSZone(ctx, shortZone, *dnsZone, apiSessionID); err != nil {
+			return err
+		}
+	}
+
+	// the marker points into the records read, which are left unchanged
+	markerRecord := *marker
+	markerRecord.DeleteRecord = true
+	markerRecordSet := dnsRecordSet{
+		DnsRecords: []dnsRecord{markerRecord},
+	}
+	if _, err = p.updateDNSRecords(ctx, shortZone, markerRecordSet, apiSessionID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetZoneTTL returns the TTL of the zone, which netcup uses for all of its records, without reading the records.
+// If netcup reports no TTL, DefaultTTL is returned like for the records. If the zone doesn't exist, the error matches
+// ErrZoneNotFound.
+func (p *Provider) GetZoneTTL(ctx context.Context, zone string) (_ time.Duration, err error) {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+	ctx, stats := p.startStats(ctx, "get_zone_ttl", zone)
+	defer func() { stats.finish(err) }()
+
+	if err := p.checkZoneAllowed(zone, true); err != nil {
+		return 0, err
+	}
+
+	unlock, err := p.lockZoneInProcess(ctx, zone)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	p.logf("%v Getting TTL of zone %v", loggingPrefixLibdnsNetcup, zone)
+
+	ctx = p.withCustomer(ctx, zone)
+	apiSessionID, err := p.login(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer p.logout(ctx, apiSessionID)
+
+	dnsZone, err := p.infoDNSZone(ctx, unFQDN(zone), apiSessionID)
+	if err != nil {
+		return 0, err
+	}
+	p.cacheZoneTTL(dnsZone)
+
+	return p.zoneTTL(dnsZone), nil
+}
+
+// SetZoneTTL sets the TTL of the zone, which netcup uses for all of its records, to the given value rounded to whole seconds.
+// netcup accepts TTLs from 5 minutes up to 2^31-1 seconds, other values fail with ErrInvalidTTL.
+//
+// While the TTL is lowered by LowerTTL, RestoreTTL still restores the original TTL afterwards.
+func (p *Provider) SetZoneTTL(ctx context.Context, zone string, ttl time.Duration) (err error) {
+	ctx, cancel := p.withOperationTimeout(ctx)
+	defer cancel()
+	ctx, stats := p.startStats(ctx, "set_zone_ttl", zone)
+	defer func() { stats.finish(err) }()
+
+	ttlSeconds, err := zoneTTLSeconds(ttl)
+	if err != nil {
+		return err
+	}
+	if err := p.checkZoneAllowed(zone, false); err != nil {
+		return err
+	}
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	shortZone := unFQDN(zone)
+	p.logf("%v Setting TTL of zone %v to %v", loggingPrefixLibdnsNetcup, zone, time.Duration(ttlSeconds)*time.Second)
+
+	ctx = p.withCustomer(ctx, zone)
+	apiSessionID, err := p.login(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.logout(ctx, apiSessionID)
+
+	dnsZone, _, err := p.getZoneAndRecords(ctx, shortZone, apiSessionID, false, true)
+	if err != nil {
+		return err
+	}
+	if dnsZone.TTL == ttlSeconds {
+		return nil
+	}
+
+	dnsZone.TTL = ttlSeconds
+	if _, err = p.updateDNSZone(ctx, shortZone, *dnsZone, apiSessionID); err != nil {
+		return err
+	}
+	p.cacheZoneTTL(dnsZone)
+
+	return nil
+}
+
+// Returns the zone TTL rounded to whole seconds or, if netcup doesn't accept it, an error matching ErrInvalidTTL.
+func zoneTTLSeconds(ttl time.Duration) (int64, error) {
+	ttlSeconds := int64(ttl.Round(time.Second) / time.Second)
+	if ttlSeconds < minZoneTTL || ttlSeconds > maxZoneTTL {
+		return 0, fmt.Errorf("%v %w %v: must be between %v and %v seconds", loggingPrefixLibdnsNetcup, ErrInvalidTTL, ttl, minZoneTTL, maxZoneTTL)
+	}
+	return ttlSeconds, nil
+}
@@ -0,0 +1,202 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+func TestProvider_LowerAndRestoreTTL(t *testing.T) {
+	p, server := newFakeProvider(t, netcuptest.Record{HostName: "www", Type: "A", Destination: "192.0.2.1"})
+	ctx := context.Background()
+
+	if err := p.LowerTTL(ctx, fakeZone+".", 5*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	zone, _ := server.Zone(fakeZone)
+	if zone.TTL != 300 {
+		t.Fatalf("TTL should have been lowered to 300, but is %v", zone.TTL)
+	}
+	marker := findFakeRecord(zone.Records, ttlMarkerHostName)
+	if marker == nil || marker.Destination != "86400" {
+		t.Fatalf("Marker record with the original TTL expected, got %+v", marker)
+	}
+
+	if err := p.RestoreTTL(ctx, fakeZone+"."); err != nil {
+		t.Fatal(err)
+	}
+
+	zone, _ = server.Zone(fakeZone)
+	if zone.TTL != 86400 {
+		t.Fatalf("TTL should have been restored to 86400, but is %v", zone.TTL)
+	}
+	if marker := findFakeRecord(zone.Records, ttlMarkerHostName); marker != nil {
+		t.Fatalf("Marker record should have been deleted, got %+v", marker)
+	}
+
+	// the marker has to be written before the TTL is lowered and deleted after the TTL is restored
+	expectedWrites := []string{"updateDnsRecords", "updateDnsZone", "updateDnsZone", "updateDnsRecords"}
+	if writes := writeActions(server.Actions()); !reflect.DeepEqual(writes, expectedWrites) {
+		t.Fatalf("Expected writes %v, got %v", expectedWrites, writes)
+	}
+}
+
+func TestProvider_LowerTTLConcurrentDances(t *testing.T) {
+	p, server := newFakeProvider(t)
+	ctx := context.Background()
+
+	// the calls are counted per zone, regardless of the spelling of its name
+	for _, zone := range []string{fakeZone, "Example.COM."} {
+		if err := p.LowerTTL(ctx, zone, 5*time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.RestoreTTL(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	if zone, _ := server.Zone(fakeZone); zone.TTL != 300 {
+		t.Fatalf("TTL should still be lowered while a dance is in progress, but is %v", zone.TTL)
+	}
+
+	if err := p.RestoreTTL(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	if zone, _ := server.Zone(fakeZone); zone.TTL != 86400 {
+		t.Fatalf("TTL should have been restored after the last dance, but is %v", zone.TTL)
+	}
+	if count := server.CallCount("updateDnsZone"); count != 2 {
+		t.Fatalf("Expected 2 zone updates, got %v", count)
+	}
+}
+
+func TestProvider_RestoreTTLAfterCrash(t *testing.T) {
+	// a previous process lowered the TTL and crashed before restoring it
+	p, server := newFakeProvider(t, netcuptest.Record{HostName: ttlMarkerHostName, Type: "TXT", Destination: "3600"})
+	server.AddZone(fakeZone, 300, server.Records(fakeZone)...)
+	ctx := context.Background()
+
+	// lowering again must not overwrite the original TTL in the marker
+	if err := p.LowerTTL(ctx, fakeZone, 5*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.CallCount("updateDnsRecords"); count != 0 {
+		t.Fatalf("Existing marker should have been kept, but records were updated %v times", count)
+	}
+
+	// a new process restores the TTL from the marker
+	restarted := &Provider{CustomerNumber: p.CustomerNumber, APIKey: p.APIKey, APIPassword: p.APIPassword, Endpoint: p.Endpoint, AllowInsecureEndpoint: true}
+	if err := restarted.RestoreTTL(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	zone, _ := server.Zone(fakeZone)
+	if zone.TTL != 3600 {
+		t.Fatalf("TTL should have been restored to 3600 from the marker, but is %v", zone.TTL)
+	}
+	if marker := findFakeRecord(zone.Records, ttlMarkerHostName); marker != nil {
+		t.Fatalf("Marker record should have been deleted, got %+v", marker)
+	}
+}
+
+func TestProvider_SetZoneTTL(t *testing.T) {
+	p, server := newFakeProvider(t, netcuptest.Record{HostName: "www", Type: "A", Destination: "192.0.2.1"})
+	ctx := context.Background()
+
+	if err := p.SetZoneTTL(ctx, fakeZone+".", 3599600*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	zone, _ := server.Zone(fakeZone)
+	if zone.TTL != 3600 {
+		t.Fatalf("TTL should have been set to 3600, but is %v", zone.TTL)
+	}
+	if len(zone.Records) != 1 {
+		t.Fatalf("Records should have been kept, got %+v", zone.Records)
+	}
+
+	// the same TTL isn't written again
+	if err := p.SetZoneTTL(ctx, fakeZone, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if count := server.CallCount("updateDnsZone"); count != 1 {
+		t.Fatalf("Expected 1 zone update, got %v", count)
+	}
+}
+
+func TestProvider_SetZoneTTLOutOfRange(t *testing.T) {
+	p, server := newFakeProvider(t)
+
+	for _, ttl := range []time.Duration{0, time.Minute, (maxZoneTTL + 1) * time.Second} {
+		if err := p.SetZoneTTL(context.Background(), fakeZone, ttl); !errors.Is(err, ErrInvalidTTL) {
+			t.Fatalf("Expected ErrInvalidTTL for %v, got %v", ttl, err)
+		}
+	}
+	if count := len(server.Actions()); count != 0 {
+		t.Fatalf("Expected no requests, got %v", server.Actions())
+	}
+}
+
+func TestProvider_LowerTTLOutOfRange(t *testing.T) {
+	p, server := newFakeProvider(t)
+
+	for _, ttl := range []time.Duration{0, time.Minute, (maxZoneTTL + 1) * time.Second} {
+		if err := p.LowerTTL(context.Background(), fakeZone, ttl); !errors.Is(err, ErrInvalidTTL) {
+			t.Fatalf("Expected ErrInvalidTTL for %v, got %v", ttl, err)
+		}
+	}
+	if count := len(server.Actions()); count != 0 {
+		t.Fatalf("Expected no requests, got %v", server.Actions())
+	}
+	// a rejected call isn't counted, so the next call lowers the TTL
+	if err := p.LowerTTL(context.Background(), fakeZone, 299600*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if zone, _ := server.Zone(fakeZone); zone.TTL != 300 {
+		t.Fatalf("TTL should have been lowered to 300, but is %v", zone.TTL)
+	}
+}
+
+func TestProvider_GetZoneTTL(t *testing.T) {
+	p, server := newFakeProvider(t)
+	ctx := context.Background()
+
+	ttl, err := p.GetZoneTTL(ctx, fakeZone+".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl != 86400*time.Second {
+		t.Fatalf("Expected the TTL of the zone, got %v", ttl)
+	}
+	if count := server.CallCount("infoDnsRecords"); count != 0 {
+		t.Fatalf("Expected the records not to be read, got %v requests", count)
+	}
+
+	if _, err = p.GetZoneTTL(ctx, "unknown.example"); !errors.Is(err, ErrZoneNotFound) {
+		t.Fatalf("Expected the zone not to be found, got %v", err)
+	}
+}
+
+func findFakeRecord(records []netcuptest.Record, hostName string) *netcuptest.Record {
+	for i := range records {
+		if records[i].HostName == hostName {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+func writeActions(actions []string) []string {
+	var writes []string
+	for _, action := range actions {
+		if action == "updateDnsRecords" || action == "updateDnsZone" {
+			writes = append(writes, action)
+		}
+	}
+	return writes
+}
@@ -4,10 +4,13 @@ package netcup
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
 )
 
 // dnsRecord is the netcup DNS record structure.
-// DeleteRecord determines, whether the record should be deleted on an update
+// DeleteRecord determines, whether the record should be deleted on an update.
+// State is the state of the record on the nameservers, like "yes", read only and ignored by netcup in requests.
 type dnsRecord struct {
 	ID           string `json:"id"`
 	HostName     string `json:"hostname"`
@@ -15,12 +18,19 @@ type dnsRecord struct {
 	Priority     int    `json:"priority,string"`
 	Destination  string `json:"destination"`
 	DeleteRecord bool   `json:"deleterecord"`
+	State        string `json:"state,omitempty"`
 }
 
-// Checks, if all the values of two records are the same, disregarding the ID. Needed to determine,
-// which records need to be appended or updated.
+// Checks, if all the values of two records are the same, disregarding the ID: the host name and type as compared by
+// sameNameAndType, the destination and the priority. Needed to determine, which records need to be appended or updated.
 func (rec *dnsRecord) equals(otherRec dnsRecord) bool {
-	return rec.HostName == otherRec.HostName && rec.RecType == otherRec.RecType && rec.Destination == otherRec.Destination && rec.Priority == otherRec.Priority
+	return rec.sameNameAndType(otherRec) && rec.Destination == otherRec.Destination && rec.Priority == otherRec.Priority
+}
+
+// Checks, if two records have the same host name and type, disregarding the case and a trailing dot like DNS, since
+// netcup may return them in another form than they were sent.
+func (rec *dnsRecord) sameNameAndType(otherRec dnsRecord) bool {
+	return canonicalName(rec.HostName) == canonicalName(otherRec.HostName) && canonicalType(rec.RecType) == canonicalType(otherRec.RecType)
 }
 
 // dnsRecordSet is used by the netcup API to wrap DnsRecords
@@ -34,21 +44,52 @@ type apiSessionData struct {
 	APISessionId string `json:"apisessionid"`
 }
 
-// dnsZone contains information about the zone. Name: the zone name, TTL: time to live in seconds
+// dnsZone contains information about the zone. Name: the zone name, TTL: time to live in seconds, 0 if unknown.
+// The other values are only needed to send the complete zone back to netcup on an update.
 type dnsZone struct {
-	Name string `json:"name"`
-	TTL  int64  `json:"ttl,string"`
+	Name         string `json:"name"`
+	TTL          int64  `json:"ttl,string"`
+	Serial       string `json:"serial"`
+	Refresh      string `json:"refresh"`
+	Retry        string `json:"retry"`
+	Expire       string `json:"expire"`
+	DNSSECStatus bool   `json:"dnssecstatus"`
+}
+
+// UnmarshalJSON decodes the zone like the default decoding, but a missing, empty or invalid TTL leaves the TTL at 0
+// instead of failing, since netcup sends zones without a TTL, for example right after they were created.
+func (zone *dnsZone) UnmarshalJSON(data []byte) error {
+	type plainZone dnsZone
+	aux := struct {
+		TTL json.RawMessage `json:"ttl"`
+		*plainZone
+	}{
+		plainZone: (*plainZone)(zone),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	zone.TTL, _ = strconv.ParseInt(strings.Trim(string(aux.TTL), `"`), 10, 64)
+	return nil
+}
+
+// domain is an entry of the list of domains of the customer returned by listallDomains
+type domain struct {
+	DomainName string `json:"domainname"`
 }
 
 // requestParam contains request parameters for all requests used in this libdns implementation.
 // Not all of them are used in every request.
 type requestParam struct {
-	DomainName     string       `json:"domainname,omitempty"`
-	CustomerNumber string       `json:"customernumber"`
-	APIKey         string       `json:"apikey"`
-	APIPassword    string       `json:"apipassword,omitempty"`
-	APISessionID   string       `json:"apisessionid,omitempty"`
-	DNSRecordSet   dnsRecordSet `json:"dnsrecordset,omitempty"`
+	DomainName      string       `json:"domainname,omitempty"`
+	CustomerNumber  string       `json:"customernumber"`
+	APIKey          string       `json:"apikey"`
+	APIPassword     string       `json:"apipassword,omitempty"`
+	APISessionID    string       `json:"apisessionid,omitempty"`
+	DNSRecordSet    dnsRecordSet `json:"dnsrecordset,omitempty"`
+	DNSZone         *dnsZone     `json:"dnszone,omitempty"`
+	ClientRequestID string       `json:"clientrequestid,omitempty"`
 }
 
 // request maps the structure of the JSON body of every request to the netcup DNS API (there are only POST requests)
@@ -59,9 +100,11 @@ type request struct {
 
 // request maps the structure of the JSON body of every netcup DNS API response
 type response struct {
-	Action       string          `json:"action"`
-	Status       string          `json:"status"`
-	ShortMessage string          `json:"shortmessage"`
-	LongMessage  string          `json:"longmessage"`
-	ResponseData json.RawMessage `json:"responsedata"`
+	ClientRequestID string          `json:"clientrequestid"`
+	Action          string          `json:"action"`
+	Status          string          `json:"status"`
+	StatusCode      int             `json:"statuscode"`
+	ShortMessage    string          `json:"shortmessage"`
+	LongMessage     string          `json:"longmessage"`
+	ResponseData    json.RawMessage `json:"responsedata"`
 }
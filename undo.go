@@ -0,0 +1,130 @@
+// Undo of the last change of a zone
+
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// ErrNoChangeToUndo is returned by UndoLastChange, if no change of the zone is recorded.
+var ErrNoChangeToUndo = errors.New("no change to undo")
+
+// ErrZoneChangedSince is returned (wrapped) by UndoLastChange, if the records of the zone are not the same anymore
+// as right after the recorded change.
+var ErrZoneChangedSince = errors.New("zone changed since the last recorded change")
+
+// RecordedChange is the last change of a zone, as it is kept for UndoLastChange.
+type RecordedChange struct {
+	Zone string
+	// Operation is the operation, that made the change, like in WebhookPayload
+	Operation string
+	Change    ChangeResult
+	// Records contains all records of the zone after the change, to detect later changes
+	Records []libdns.Record
+	Time    time.Time
+}
+
+// ChangeStore keeps the last change of every zone for UndoLastChange. Without Provider.ChangeStore the changes are kept in memory.
+// A ChangeStore can persist them, so a change can be undone by another process or after a restart.
+type ChangeStore interface {
+	// SaveChange replaces the last change of the zone.
+	SaveChange(ctx context.Context, zone string, change *RecordedChange) error
+	// LoadChange returns the last change of the zone, or nil if there is none.
+	LoadChange(ctx context.Context, zone string) (*RecordedChange, error)
+}
+
+// memoryChangeStore is the default ChangeStore
+type memoryChangeStore struct {
+	mutex   sync.Mutex
+	changes map[string]*RecordedChange
+}
+
+func (store *memoryChangeStore) SaveChange(ctx context.Context, zone string, change *RecordedChange) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.changes == nil {
+		store.changes = make(map[string]*RecordedChange)
+	}
+	store.changes[zone] = change
+	return nil
+}
+
+func (store *memoryChangeStore) LoadChange(ctx context.Context, zone string) (*RecordedChange, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.changes[zone], nil
+}
+
+func (p *Provider) changeStore() ChangeStore {
+	if p.ChangeStore != nil {
+		return p.ChangeStore
+	}
+	return &p.memoryChanges
+}
+
+// Records the change between the records before and after an operation as last change of the zone, if records were changed.
+// Failures are only logged, since the operation itself was successful.
+func (p *Provider) recordChange(ctx context.Context, zone string, operation string, before []dnsRecord, after []dnsRecord, ttl time.Duration) {
+	change := changeResult(before, after, ttl)
+	if len(change.Appended)+len(change.Updated)+len(change.Deleted) == 0 {
+		return
+	}
+
+	recordedChange := &RecordedChange{
+		Zone:      zone,
+		Operation: operation,
+		Change:    *change,
+		Records:   toLibdnsRecords(after, ttl),
+		Time:      time.Now().UTC(),
+	}
+	if err := p.changeStore().SaveChange(ctx, normalizeZone(zone), recordedChange); err != nil {
+		p.warnf("%v Failed to record the change of zone %v: %v", loggingPrefixLibdnsNetcup, zone, err)
+	}
+}
+
+// UndoLastChange reverts the last recorded change of the zone: deleted records are appended again (with new IDs), updated
+// records get their previous values and appended records are deleted. It returns the changes made by the undo, which is
+// recorded as last change itself, so a second call redoes the change.
+//
+// All changes made by the provider are recorded, except for SetRecords and DeleteRecords writing records with IDs directly.
+// The undo fails with ErrZoneChangedSince, if the records of the zone are not the same as right after the recorded change.
+func (p *Provider) UndoLastChange(ctx context.Context, zone string) (*ChangeResult, error) {
+	recordedChange, err := p.changeStore().LoadChange(ctx, normalizeZone(zone))
+	if err != nil {
+		return nil, err
+	}
+	if recordedChange == nil {
+		return nil, fmt.Errorf("%v zone %v: %w", loggingPrefixLibdnsNetcup, zone, ErrNoChangeToUndo)
+	}
+
+	p.logf("%v Undoing the last change (%v at %v) of zone %v", loggingPrefixLibdnsNetcup, recordedChange.Operation, recordedChange.Time, zone)
+
+	return p.changeZone(ctx, zone, "undo", func(existingRecords []dnsRecord) ([]dnsRecord, error) {
+		recordedRecords := toNetcupRecords(zone, recordedChange.Records)
+		if len(recordedRecords) != len(existingRecords) {
+			return nil, fmt.Errorf("%v zone %v has %v records instead of %v: %w", loggingPrefixLibdnsNetcup, zone, len(existingRecords), len(recordedRecords), ErrZoneChangedSince)
+		}
+		for _, record := range recordedRecords {
+			if existingRecord := findRecordByID(record.ID, existingRecords); existingRecord == nil || !existingRecord.equals(record) {
+				return nil, fmt.Errorf("%v record %v of type %v with ID %v changed: %w", loggingPrefixLibdnsNetcup, record.HostName, record.RecType, record.ID, ErrZoneChangedSince)
+			}
+		}
+
+		updates := toNetcupRecords(zone, recordedChange.Change.Previous)
+		for _, record := range toNetcupRecords(zone, recordedChange.Change.Deleted) {
+			record.ID = ""
+			updates = append(updates, record)
+		}
+		for _, record := range toNetcupRecords(zone, recordedChange.Change.Appended) {
+			record.DeleteRecord = true
+			updates = append(updates, record)
+		}
+		return updates, nil
+	})
+}
@@ -0,0 +1,131 @@
+package netcup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+func undoTestRecords() []netcuptest.Record {
+	return []netcuptest.Record{
+		{ID: "1", HostName: "@", Type: "A", Destination: "192.0.2.1"},
+		{ID: "2", HostName: "@", Type: "MX", Destination: "mail." + fakeZone + ".", Priority: 10},
+		{ID: "3", HostName: "@", Type: "TXT", Destination: "one"},
+		{ID: "4", HostName: "@", Type: "TXT", Destination: "two"},
+		{ID: "5", HostName: "www", Type: "CNAME", Destination: fakeZone + "."},
+	}
+}
+
+// fullZoneContents returns all values of the records in the fake zone including IDs and priorities.
+func fullZoneContents(server *netcuptest.Server) string {
+	return fmt.Sprintf("%+v", server.Records(fakeZone))
+}
+
+func TestProvider_UndoLastChange(t *testing.T) {
+	p, server := newFakeProvider(t, undoTestRecords()...)
+	ctx := context.Background()
+	before := zoneContents(server)
+
+	// updates the A record and one TXT value, deletes the MX and the other TXT value and appends an AAAA record
+	_, err := p.SyncRecords(ctx, fakeZone, []libdns.Record{
+		{Type: "A", Name: "@", Value: "192.0.2.2"},
+		{Type: "TXT", Name: "@", Value: "one"},
+		{Type: "TXT", Name: "@", Value: "three"},
+		{Type: "AAAA", Name: "@", Value: "2001:db8::1"},
+		{Type: "CNAME", Name: "www", Value: fakeZone + "."},
+	}, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := zoneContents(server)
+
+	result, err := p.UndoLastChange(ctx, fakeZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertZoneContents(t, server, before...)
+	if len(result.Appended) != 1 || len(result.Updated) != 2 || len(result.Deleted) != 1 {
+		t.Fatalf("Expected the MX record to be appended, the A and TXT record to be updated and the AAAA record to be deleted, got %+v", result)
+	}
+	// the records, that still existed, keep their IDs
+	for _, record := range server.Records(fakeZone) {
+		if record.Type == "A" && record.ID != "1" || record.Type == "CNAME" && record.ID != "5" {
+			t.Fatalf("Expected the existing records to keep their IDs, got %+v", server.Records(fakeZone))
+		}
+	}
+
+	// the undo is the last change now, so undoing it again redoes the sync
+	if _, err := p.UndoLastChange(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	assertZoneContents(t, server, changed...)
+}
+
+func TestProvider_UndoLastChangeRestoresExactly(t *testing.T) {
+	p, server := newFakeProvider(t, undoTestRecords()...)
+	ctx := context.Background()
+	before := fullZoneContents(server)
+
+	// only updates and appends, so the IDs of all records are restored too
+	if _, err := p.SetRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "one"}, {Type: "TXT", Name: "@", Value: "2"}, {Type: "TXT", Name: "@", Value: "3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.UndoLastChange(ctx, fakeZone); err != nil {
+		t.Fatal(err)
+	}
+	if after := fullZoneContents(server); after != before {
+		t.Fatalf("Expected the zone to be restored to\n%v\ngot\n%v", before, after)
+	}
+}
+
+func TestProvider_UndoLastChangeRefusesChangedZone(t *testing.T) {
+	p, server := newFakeProvider(t, undoTestRecords()...)
+	ctx := context.Background()
+
+	if _, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: "_acme-challenge", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+	// another provider changes the zone
+	other := &Provider{CustomerNumber: p.CustomerNumber, APIKey: p.APIKey, APIPassword: p.APIPassword, Endpoint: p.Endpoint, AllowInsecureEndpoint: true}
+	if _, err := other.SetRecords(ctx, fakeZone, []libdns.Record{{ID: "1", Type: "A", Name: "@", Value: "192.0.2.9"}}); err != nil {
+		t.Fatal(err)
+	}
+	changed := zoneContents(server)
+
+	_, err := p.UndoLastChange(ctx, fakeZone)
+	if !errors.Is(err, ErrZoneChangedSince) {
+		t.Fatalf("Expected ErrZoneChangedSince, got %v", err)
+	}
+	assertZoneContents(t, server, changed...)
+}
+
+func TestProvider_UndoWithoutChange(t *testing.T) {
+	p, _ := newFakeProvider(t, undoTestRecords()...)
+
+	if _, err := p.UndoLastChange(context.Background(), fakeZone); !errors.Is(err, ErrNoChangeToUndo) {
+		t.Fatalf("Expected ErrNoChangeToUndo, got %v", err)
+	}
+}
+
+func TestProvider_UndoWithSharedChangeStore(t *testing.T) {
+	p, server := newFakeProvider(t, undoTestRecords()...)
+	store := &memoryChangeStore{}
+	p.ChangeStore = store
+	ctx := context.Background()
+	before := zoneContents(server)
+
+	if _, err := p.DeleteRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "one"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new provider with the same store, like after a restart
+	restarted := &Provider{CustomerNumber: p.CustomerNumber, APIKey: p.APIKey, APIPassword: p.APIPassword, Endpoint: p.Endpoint, AllowInsecureEndpoint: true, ChangeStore: store}
+	if _, err := restarted.UndoLastChange(ctx, fakeZone+"."); err != nil {
+		t.Fatal(err)
+	}
+	assertZoneContents(t, server, before...)
+}
@@ -0,0 +1,64 @@
+// The User-Agent header of the requests to netcup
+
+package netcup
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+)
+
+// Version is the version of the library, bumped with every release. The User-Agent header uses the version from the
+// build info instead, if it is known.
+const Version = "v0.2.0"
+
+// modulePath identifies the library in the build info and the User-Agent header
+const modulePath = "github.com/wizardrix/libdns_netcup"
+
+var (
+	userAgentOnce sync.Once
+	userAgent     string
+)
+
+// Returns the version of the library from the build info, Version if it isn't known, for example in tests.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return Version
+	}
+	var version string
+	if info.Main.Path == modulePath {
+		version = info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			version = dep.Version
+			if dep.Replace != nil {
+				version = dep.Replace.Version
+			}
+		}
+	}
+	if version == "" || version == "(devel)" {
+		return Version
+	}
+	return version
+}
+
+// Returns the User-Agent header of the requests of a call: UserAgent, if it is set, or the library and its version,
+// followed by the UserAgentSuffix of the CallOptions or the provider, if one is set.
+func (p *Provider) userAgent(ctx context.Context) string {
+	if p.UserAgent != "" {
+		return p.UserAgent
+	}
+	userAgentOnce.Do(func() {
+		userAgent = "libdns-netcup/" + moduleVersion() + " (+https://" + modulePath + ")"
+	})
+	suffix := p.UserAgentSuffix
+	if callSuffix := callOptions(ctx).UserAgentSuffix; callSuffix != "" {
+		suffix = callSuffix
+	}
+	if suffix == "" {
+		return userAgent
+	}
+	return userAgent + " " + suffix
+}
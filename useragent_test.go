@@ -0,0 +1,64 @@
+package netcup
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// userAgentTransport records the User-Agent headers of the requests.
+type userAgentTransport struct {
+	mutex      sync.Mutex
+	userAgents []string
+}
+
+func (transport *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.mutex.Lock()
+	transport.userAgents = append(transport.userAgents, req.Header.Get("User-Agent"))
+	transport.mutex.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestProvider_UserAgent(t *testing.T) {
+	p, _ := newFakeProvider(t)
+	transport := &userAgentTransport{}
+	p.HTTPClient = &http.Client{Transport: transport}
+	p.UserAgentSuffix = "caddy/2.8"
+
+	if _, err := p.GetRecords(context.Background(), fakeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	if len(transport.userAgents) == 0 {
+		t.Fatal("Expected requests")
+	}
+	for _, userAgent := range transport.userAgents {
+		if !strings.HasPrefix(userAgent, "libdns-netcup/") || !strings.Contains(userAgent, "(+https://github.com/wizardrix/libdns_netcup)") || !strings.HasSuffix(userAgent, " caddy/2.8") {
+			t.Fatalf("Expected the User-Agent of the library with the suffix, got %q", userAgent)
+		}
+	}
+}
+
+func TestProvider_UserAgentOverrides(t *testing.T) {
+	p := &Provider{UserAgentSuffix: "caddy/2.8"}
+	ctx := WithCallOptions(context.Background(), CallOptions{UserAgentSuffix: "renewal-job"})
+	if userAgent := p.userAgent(ctx); !strings.HasPrefix(userAgent, "libdns-netcup/") || !strings.HasSuffix(userAgent, " renewal-job") {
+		t.Fatalf("Expected the suffix of the call options, got %q", userAgent)
+	}
+
+	p.UserAgent = "my-automation/1.0"
+	if userAgent := p.userAgent(ctx); userAgent != "my-automation/1.0" {
+		t.Fatalf("Expected UserAgent to replace the header, got %q", userAgent)
+	}
+}
+
+func TestModuleVersion(t *testing.T) {
+	// tests have no version of the library in the build info
+	if version := moduleVersion(); version != Version {
+		t.Fatalf("Expected %v, got %v", Version, version)
+	}
+}
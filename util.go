@@ -3,8 +3,13 @@
 package netcup
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/libdns/libdns"
 )
@@ -14,8 +19,28 @@ func unFQDN(fqdn string) string {
 	return strings.TrimSuffix(fqdn, ".")
 }
 
+// RelativeName returns the name relative to the zone, like netcup stores host names: "@" for the apex, which is also ""
+// or the zone itself, and the part before the zone for names in the zone, with or without trailing dot. Other names are
+// relative already and only lose a trailing dot. The zone is compared case-insensitively.
+func RelativeName(name string, zone string) string {
+	name = unFQDN(name)
+	zone = unFQDN(zone)
+	if name == "" || name == "@" || strings.EqualFold(name, zone) {
+		return "@"
+	}
+	suffix := "." + zone
+	if zone != "" && len(name) > len(suffix) && strings.EqualFold(name[len(name)-len(suffix):], suffix) {
+		return name[:len(name)-len(suffix)]
+	}
+	return name
+}
+
 // Converts netcup records to libdns records. Since the netcup records don't have individual TTLs, the given TTL is used for all libdns records.
-func toLibdnsRecords(netcupRecords []dnsRecord, ttl int64) []libdns.Record {
+// Names are kept relative to the zone, as netcup stores them, with "@" for the apex.
+// The destination "weight port target" of SRV records is split into the weight and the value "port target" like in libdns.
+// The value of CAA records is quoted, if netcup returns it without quotes, and DS records get the form of formatDS.
+// Long TXT values split into multiple strings are joined again, see joinTXT.
+func toLibdnsRecords(netcupRecords []dnsRecord, ttl time.Duration) []libdns.Record {
 	var libdnsRecords []libdns.Record
 	for _, record := range netcupRecords {
 		libdnsRecord := libdns.Record{
@@ -23,40 +48,304 @@ func toLibdnsRecords(netcupRecords []dnsRecord, ttl int64) []libdns.Record {
 			Type:     record.RecType,
 			Name:     record.HostName,
 			Value:    record.Destination,
-			TTL:      time.Duration(ttl * int64(time.Second)),
-			Priority: record.Priority,
+			TTL:      ttl,
+			Priority: uint(record.Priority),
+		}
+		switch canonicalType(record.RecType) {
+		case "SRV":
+			if weight, value, ok := splitSRVDestination(record.Destination); ok {
+				libdnsRecord.Weight = weight
+				libdnsRecord.Value = value
+			}
+		case "CAA":
+			libdnsRecord.Value = formatCAA(record.Destination)
+		case "DS":
+			libdnsRecord.Value = formatDS(record.Destination)
+		case "TXT":
+			libdnsRecord.Value = joinTXT(record.Destination)
 		}
 		libdnsRecords = append(libdnsRecords, libdnsRecord)
 	}
 	return libdnsRecords
 }
 
-// Converts libdns records to netcup records.
-func toNetcupRecords(libnsRecords []libdns.Record) []dnsRecord {
+// ErrUnsupportedRecordType is wrapped by the error returned, if a record to write has a type netcup doesn't support.
+var ErrUnsupportedRecordType = errors.New("unsupported record type")
+
+// supportedRecordTypes are the record types supported by the netcup DNS API
+var supportedRecordTypes = []string{"A", "AAAA", "CAA", "CNAME", "DS", "MX", "NS", "OPENPGPKEY", "SMIMEA", "SRV", "SSHFP", "TLSA", "TXT"}
+
+// Returns an error wrapping ErrUnsupportedRecordType naming the first record, whose type netcup doesn't support.
+// Types are compared case-insensitively like in netcup.
+func checkRecordTypes(records []libdns.Record) error {
+	for _, record := range records {
+		if !IsSupportedRecordType(record.Type) {
+			return fmt.Errorf("%v %w %q of record %q with value %q, netcup supports %v", loggingPrefixLibdnsNetcup, ErrUnsupportedRecordType, record.Type, record.Name, record.Value, strings.Join(supportedRecordTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// SupportedRecordTypes returns the record types supported by the netcup DNS API.
+func SupportedRecordTypes() []string {
+	return append([]string(nil), supportedRecordTypes...)
+}
+
+// IsSupportedRecordType returns if the netcup DNS API supports the record type, compared case-insensitively.
+func IsSupportedRecordType(recType string) bool {
+	for _, supportedType := range supportedRecordTypes {
+		if canonicalType(recType) == supportedType {
+			return true
+		}
+	}
+	return false
+}
+
+// Converts libdns records of the given zone to netcup records. Names are made relative to the zone with "@" for the apex,
+// so FQDNs like "www.example.com." and the zone itself can be used as names.
+// The weight and the value "port target" of SRV records are joined to the destination "weight port target" of netcup.
+// CAA records are written as "flags tag "value"" with the value quoted, DS records in the form of formatDS.
+// TXT values longer than 255 bytes are split into multiple strings, see splitTXT.
+func toNetcupRecords(zone string, libnsRecords []libdns.Record) []dnsRecord {
 	var netcupRecords []dnsRecord
 	for _, record := range libnsRecords {
 		netcupRecord := dnsRecord{
 			ID:          record.ID,
-			HostName:    record.Name,
+			HostName:    RelativeName(record.Name, zone),
 			RecType:     record.Type,
 			Destination: record.Value,
-			Priority:    record.Priority,
+			Priority:    int(record.Priority),
+		}
+		switch canonicalType(record.Type) {
+		case "SRV":
+			netcupRecord.Destination = srvDestination(record)
+		case "CAA":
+			netcupRecord.Destination = formatCAA(record.Value)
+		case "DS":
+			netcupRecord.Destination = formatDS(record.Value)
+		case "TXT":
+			netcupRecord.Destination = splitTXT(joinTXT(record.Value))
 		}
 		netcupRecords = append(netcupRecords, netcupRecord)
 	}
 	return netcupRecords
 }
 
-// difference returns the records that are in a but not in b
+// Changes the destinations of records read from netcup to the form written by toNetcupRecords, so they can be compared
+// with the records to write. CAA records written in the CCP or by other tools may have values without quotes, and the
+// digests of DS records may be in lower case, and long TXT values may be split differently or not at all.
+func canonicalizeDestinations(records []dnsRecord) {
+	for i := range records {
+		switch canonicalType(records[i].RecType) {
+		case "CAA":
+			records[i].Destination = formatCAA(records[i].Destination)
+		case "DS":
+			records[i].Destination = formatDS(records[i].Destination)
+		case "TXT":
+			records[i].Destination = splitTXT(joinTXT(records[i].Destination))
+		}
+	}
+}
+
+// quotedStringEscaper escapes a string for quoting, like the value of a CAA record or the segments of a TXT record
+var quotedStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Returns the CAA record data "flags tag value" in presentation format, with single spaces and the value in quotes like
+// `0 issue "letsencrypt.org"`. A value, that is already quoted, is kept as it is, including its escapes.
+// Data, that isn't "flags tag value", is returned as it is for netcup to reject it.
+func formatCAA(data string) string {
+	data = strings.TrimSpace(data)
+	fields := strings.Fields(data)
+	if len(fields) < 3 {
+		return data
+	}
+	flags, tag := fields[0], fields[1]
+	if _, err := strconv.ParseUint(flags, 10, 8); err != nil {
+		return data
+	}
+	// the value may contain spaces
+	value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(data, flags)), tag))
+	if len(value) < 2 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		value = `"` + quotedStringEscaper.Replace(value) + `"`
+	}
+	return fmt.Sprintf("%v %v %v", flags, tag, value)
+}
+
+// Returns the DS record data "key-tag algorithm digest-type digest" in presentation format, with single spaces and
+// the digest in upper case hex as one field, like "12345 13 2 49FD46E6...". Zone files often split the digest into
+// multiple fields. Data, that isn't in this format, is returned as it is for netcup to reject it.
+func formatDS(data string) string {
+	data = strings.TrimSpace(data)
+	fields := strings.Fields(data)
+	if len(fields) < 4 {
+		return data
+	}
+	keyTag, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return data
+	}
+	algorithm, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil {
+		return data
+	}
+	digestType, err := strconv.ParseUint(fields[2], 10, 8)
+	if err != nil {
+		return data
+	}
+	digest := strings.Join(fields[3:], "")
+	if _, err := hex.DecodeString(digest); err != nil {
+		return data
+	}
+	return fmt.Sprintf("%v %v %v %v", keyTag, algorithm, digestType, strings.ToUpper(digest))
+}
+
+// Splits the destination "weight port target" of a netcup SRV record into the weight and "port target".
+// ok is false, if the destination doesn't have this format.
+func splitSRVDestination(destination string) (weight uint, value string, ok bool) {
+	fields := strings.Fields(destination)
+	if len(fields) != 3 {
+		return 0, "", false
+	}
+	parsedWeight, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return 0, "", false
+	}
+	return uint(parsedWeight), fields[1] + " " + fields[2], true
+}
+
+// Returns the netcup destination "weight port target" of a libdns SRV record with the value "port target".
+// A value, that already contains the weight, is used as it is, like any other value netcup has to validate.
+func srvDestination(record libdns.Record) string {
+	fields := strings.Fields(record.Value)
+	if len(fields) != 2 {
+		return record.Value
+	}
+	return fmt.Sprintf("%d %v %v", record.Weight, fields[0], fields[1])
+}
+
+// maxTXTSegmentLength is the maximum length of a character string in a TXT record
+const maxTXTSegmentLength = 255
+
+// Returns the destination of a TXT record with the value: values of up to 255 bytes as they are, longer values split
+// into quoted segments of at most 255 bytes like `"v=DKIM1; k=rsa; p=MIIB..." "...IDAQAB"`, see SplitTXT.
+func splitTXT(value string) string {
+	if len(value) <= maxTXTSegmentLength {
+		return value
+	}
+	var quoted []string
+	for _, segment := range SplitTXT(value) {
+		quoted = append(quoted, `"`+quotedStringEscaper.Replace(segment)+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// SplitTXT splits the value of a TXT record into the character strings of the record, of at most 255 bytes each.
+// The value is split at UTF-8 character boundaries, so each of them stays valid UTF-8.
+func SplitTXT(value string) []string {
+	segments := []string{}
+	for len(value) > maxTXTSegmentLength {
+		end := maxTXTSegmentLength
+		for end > 0 && !utf8.RuneStart(value[end]) {
+			end--
+		}
+		if end == 0 {
+			// invalid UTF-8 is split anywhere
+			end = maxTXTSegmentLength
+		}
+		segments = append(segments, value[:end])
+		value = value[end:]
+	}
+	return append(segments, value)
+}
+
+// Returns the value of a TXT record with the destination: the joined segments, if the destination consists of two or
+// more quoted segments, like the ones written by splitTXT, and the destination as it is otherwise.
+func joinTXT(destination string) string {
+	strs, ok := parseQuotedStrings(destination)
+	if !ok || len(strs) < 2 {
+		return destination
+	}
+	return strings.Join(strs, "")
+}
+
+// Parses the data of a TXT record as quoted strings separated by white space, with the escapes \X and \DDD of zone files.
+// ok is false, if the data contains anything else.
+func parseQuotedStrings(data string) (strs []string, ok bool) {
+	data = strings.TrimSpace(data)
+	for data != "" {
+		if data[0] != '"' {
+			return nil, false
+		}
+		var str strings.Builder
+		i := 1
+		for ; i < len(data) && data[i] != '"'; i++ {
+			if data[i] != '\\' {
+				str.WriteByte(data[i])
+				continue
+			}
+			if i+3 < len(data) && isDigits(data[i+1:i+4]) {
+				code, err := strconv.ParseUint(data[i+1:i+4], 10, 8)
+				if err != nil {
+					return nil, false
+				}
+				str.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+			if i+1 >= len(data) {
+				return nil, false
+			}
+			i++
+			str.WriteByte(data[i])
+		}
+		if i >= len(data) {
+			return nil, false
+		}
+		strs = append(strs, str.String())
+		data = strings.TrimLeft(data[i+1:], " \t")
+	}
+	return strs, true
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// recordIdentity identifies a record for difference. Flags of the update like DeleteRecord are not part of it,
+// so a record marked for deletion is the same as the record without the mark.
+type recordIdentity struct {
+	id          string
+	hostName    string
+	recType     string
+	destination string
+	priority    int
+}
+
+func identityOf(record dnsRecord) recordIdentity {
+	return recordIdentity{
+		id:          record.ID,
+		hostName:    record.HostName,
+		recType:     record.RecType,
+		destination: record.Destination,
+		priority:    record.Priority,
+	}
+}
+
+// difference returns the records that are in a but not in b, compared by ID, host name, type, destination and priority
 func difference(a, b []dnsRecord) []dnsRecord {
-	bIDmap := make(map[dnsRecord]struct{}, len(b))
+	bIdentities := make(map[recordIdentity]struct{}, len(b))
 	for _, elm := range b {
-		bIDmap[elm] = struct{}{}
+		bIdentities[identityOf(elm)] = struct{}{}
 	}
 
 	var diff []dnsRecord
 	for _, elm := range a {
-		if _, found := bIDmap[elm]; !found {
+		if _, found := bIdentities[identityOf(elm)]; !found {
 			diff = append(diff, elm)
 		}
 	}
@@ -65,95 +354,314 @@ func difference(a, b []dnsRecord) []dnsRecord {
 }
 
 // Searches for a record with the given ID in the given records.
+// The result points into the given records, so changing it changes the record in the slice.
 func findRecordByID(id string, records []dnsRecord) *dnsRecord {
-	for _, record := range records {
-		if record.ID == id {
-			return &record
+	for i := range records {
+		if records[i].ID == id {
+			return &records[i]
 		}
 	}
 
 	return nil
 }
 
-// Searches for a record with the given host name and record type in the given records.
-// Only the first one found is returned.
+// Searches for a record with the given host name and record type in the given records, compared case-insensitively.
+// Only the first one found is returned, as pointer into the given records.
 func findRecordByNameAndType(hostName string, recType string, records []dnsRecord) *dnsRecord {
-	for _, record := range records {
-		if record.HostName == hostName && record.RecType == recType {
-			return &record
+	for i := range records {
+		if canonicalName(records[i].HostName) == canonicalName(hostName) && canonicalType(records[i].RecType) == canonicalType(recType) {
+			return &records[i]
 		}
 	}
 
 	return nil
 }
 
-// Searches for a record with the given host name, record type and priority in the given records.
-// Only the first one found is returned.
-func findRecordByNameAndTypeAndPriority(hostName string, recType string, priority int, records []dnsRecord) *dnsRecord {
-	for _, record := range records {
-		if record.HostName == hostName && record.RecType == recType && record.Priority == priority {
-			return &record
+// Searches for a record in the given records.
+// The first criterion is the ID. If that's not set, then the name and type (and optionally the priority, if it's an MX record) are used.
+// If a destination is given, only records with that destination are considered.
+// Only the first one found is returned, as pointer into the given records.
+func findRecord(record dnsRecord, records []dnsRecord) *dnsRecord {
+	if record.ID != "" {
+		return findRecordByID(record.ID, records)
+	}
+
+	for i := range records {
+		if record.Destination != "" && records[i].Destination != record.Destination {
+			continue
+		}
+		if !records[i].sameNameAndType(record) {
+			continue
 		}
+		if canonicalType(record.RecType) == "MX" && records[i].Priority != record.Priority {
+			continue
+		}
+		return &records[i]
 	}
 
 	return nil
 }
 
-// Searches for a record in the given records.
-// The first criterion is the ID. If that's not set, then the name and type (and optionally the priority, if it's an MX record) are used.
-// Only the first one found is returned.
-func findRecord(record dnsRecord, records []dnsRecord) *dnsRecord {
-	var foundRecord *dnsRecord
-	if record.ID != "" {
-		foundRecord = findRecordByID(record.ID, records)
-	} else if record.RecType != "MX" {
-		foundRecord = findRecordByNameAndType(record.HostName, record.RecType, records)
-	} else {
-		foundRecord = findRecordByNameAndTypeAndPriority(record.HostName, record.RecType, record.Priority, records)
+// Returns all records, that findRecord would find one after another.
+func findRecords(record dnsRecord, records []dnsRecord) []dnsRecord {
+	var foundRecords []dnsRecord
+	for foundRecord := findRecord(record, records); foundRecord != nil; foundRecord = findRecord(record, records) {
+		foundRecords = append(foundRecords, *foundRecord)
+		records = removeRecordByID(foundRecord.ID, records)
 	}
+	return foundRecords
+}
+
+// Searches for a record, that equals the given record (disregarding the ID). Only the first one found is returned, as
+// pointer into the given records.
+func findEqualRecord(record dnsRecord, records []dnsRecord) *dnsRecord {
+	for i := range records {
+		if records[i].equals(record) {
+			return &records[i]
+		}
+	}
+
+	return nil
+}
 
-	return foundRecord
+// Returns the given records without the record with the given ID.
+func removeRecordByID(id string, records []dnsRecord) []dnsRecord {
+	var remainingRecords []dnsRecord
+	for _, record := range records {
+		if record.ID != id {
+			remainingRecords = append(remainingRecords, record)
+		}
+	}
+	return remainingRecords
 }
 
-// Returns all records from appendRecords, that are not in existingRecords.
-func getRecordsToAppend(appendRecords []dnsRecord, existingRecords []dnsRecord) []dnsRecord {
+// Returns all records from appendRecords, for which no equal record is in existingRecords or earlier in appendRecords,
+// or with MatchByIDOnly, for which no record with the same ID is in existingRecords.
+// The IDs are removed, so appending never changes existing records.
+func getRecordsToAppend(appendRecords []dnsRecord, existingRecords []dnsRecord, policy MatchPolicy) []dnsRecord {
 	var recordsToAppend []dnsRecord
 	for _, record := range appendRecords {
-		foundRecord := findRecord(record, existingRecords)
-		if foundRecord == nil || !foundRecord.equals(record) {
+		var foundRecord *dnsRecord
+		if policy == MatchByIDOnly {
+			if record.ID != "" {
+				foundRecord = findRecordByID(record.ID, existingRecords)
+			}
+		} else {
+			foundRecord = findEqualRecord(record, existingRecords)
+			if foundRecord == nil {
+				// duplicates in the input are appended once
+				foundRecord = findEqualRecord(record, recordsToAppend)
+			}
+		}
+		if foundRecord == nil {
+			record.ID = ""
 			recordsToAppend = append(recordsToAppend, record)
 		}
 	}
 	return recordsToAppend
 }
 
-// Returns all records from setRecords, that either are not in existingRecords or have a differentValue there.
-func getRecordsToSet(setRecords []dnsRecord, existingRecords []dnsRecord) []dnsRecord {
+// recordGroup identifies all records with the same host name and type, like the values of a TXT record.
+type recordGroup struct {
+	hostName string
+	recType  string
+}
+
+// Returns the updates needed, so that existingRecords reflect setRecords.
+//
+// Records with an ID replace the existing record with that ID. All other records are grouped by host name and type,
+// and each group replaces all existing records with that host name and type: existing records that equal a record
+// of the group are kept, the remaining existing records are updated with the remaining records of the group,
+// surplus existing records are deleted and missing ones are appended.
+//
+// With MatchByIDOnly records without ID are always appended, with MatchByNameTypeValue they are appended, if there
+// is no equal record yet. Other existing records are not changed with these policies.
+func getRecordsToSet(setRecords []dnsRecord, existingRecords []dnsRecord, policy MatchPolicy) []dnsRecord {
 	var recordsToUpdate []dnsRecord
 	var recordsToAppend []dnsRecord
+	var recordsToDelete []dnsRecord
+
+	// records with IDs are handled first, so the records they replace are not part of any group
+	claimedIDs := make(map[string]bool)
+	var groups []recordGroup
+	groupRecords := make(map[recordGroup][]dnsRecord)
 	for _, record := range setRecords {
-		foundRecord := findRecord(record, existingRecords)
-		if foundRecord != nil && !foundRecord.equals(record) {
-			record.ID = foundRecord.ID
-			recordsToUpdate = append(recordsToUpdate, record)
-		} else if foundRecord == nil {
+		if record.ID == "" && policy == MatchByIDOnly {
 			recordsToAppend = append(recordsToAppend, record)
+			continue
+		}
+		if record.ID == "" && policy == MatchByNameTypeValue {
+			if findEqualRecord(record, existingRecords) == nil && findEqualRecord(record, recordsToAppend) == nil {
+				recordsToAppend = append(recordsToAppend, record)
+			}
+			continue
+		}
+		if record.ID == "" {
+			group := recordGroup{hostName: canonicalName(record.HostName), recType: canonicalType(record.RecType)}
+			if _, found := groupRecords[group]; !found {
+				groups = append(groups, group)
+			}
+			if findEqualRecord(record, groupRecords[group]) == nil {
+				groupRecords[group] = append(groupRecords[group], record)
+			}
+			continue
 		}
+
+		foundRecord := findRecordByID(record.ID, existingRecords)
+		if foundRecord == nil {
+			record.ID = ""
+			recordsToAppend = append(recordsToAppend, record)
+		} else if !foundRecord.equals(record) {
+			recordsToUpdate = append(recordsToUpdate, record)
+		}
+		claimedIDs[record.ID] = true
 	}
-	return append(recordsToUpdate, recordsToAppend...)
+
+	for _, group := range groups {
+		var groupExistingRecords []dnsRecord
+		for _, record := range existingRecords {
+			if canonicalName(record.HostName) == group.hostName && canonicalType(record.RecType) == group.recType && !claimedIDs[record.ID] {
+				groupExistingRecords = append(groupExistingRecords, record)
+			}
+		}
+
+		var changedRecords []dnsRecord
+		for _, record := range groupRecords[group] {
+			if foundRecord := findEqualRecord(record, groupExistingRecords); foundRecord != nil {
+				groupExistingRecords = removeRecordByID(foundRecord.ID, groupExistingRecords)
+			} else {
+				changedRecords = append(changedRecords, record)
+			}
+		}
+
+		for _, record := range changedRecords {
+			if len(groupExistingRecords) > 0 {
+				record.ID = groupExistingRecords[0].ID
+				groupExistingRecords = groupExistingRecords[1:]
+				recordsToUpdate = append(recordsToUpdate, record)
+			} else {
+				recordsToAppend = append(recordsToAppend, record)
+			}
+		}
+
+		for _, record := range groupExistingRecords {
+			record.DeleteRecord = true
+			recordsToDelete = append(recordsToDelete, record)
+		}
+	}
+
+	return append(append(recordsToUpdate, recordsToAppend...), recordsToDelete...)
 }
 
-// Returns all records from deleteRecords, that are in existingRecords.
-func getRecordsToDelete(deleteRecords []dnsRecord, existingRecords []dnsRecord) []dnsRecord {
+// Returns all records from existingRecords, that match a record in deleteRecords, marked for deletion.
+// If a record without ID has a destination, all matching records are deleted, since identical records can't be told apart.
+// Every existing record is only deleted once, even if it matches multiple records in deleteRecords.
+//
+// Records without ID fail with MatchByIDOnly and without destination with MatchByNameTypeValue. With MatchByNameType
+// a record without ID and destination fails with ErrAmbiguousMatch, if it matches multiple existing records.
+func getRecordsToDelete(deleteRecords []dnsRecord, existingRecords []dnsRecord, policy MatchPolicy) ([]dnsRecord, error) {
 	var recordsToDelete []dnsRecord
+	remainingRecords := existingRecords
 	for _, record := range deleteRecords {
-		foundRecord := findRecord(record, existingRecords)
-		if foundRecord != nil {
-			record.ID = foundRecord.ID
-			record.Destination = foundRecord.Destination
-			record.DeleteRecord = true
-			recordsToDelete = append(recordsToDelete, record)
+		if record.ID == "" {
+			switch {
+			case policy == MatchByIDOnly:
+				return nil, fmt.Errorf("%v record %v of type %v has no ID, which is needed with match policy %v", loggingPrefixLibdnsNetcup, record.HostName, record.RecType, policy)
+			case policy == MatchByNameTypeValue && record.Destination == "":
+				return nil, fmt.Errorf("%v record %v of type %v has no value, which is needed with match policy %v", loggingPrefixLibdnsNetcup, record.HostName, record.RecType, policy)
+			case record.Destination == "" && len(findRecords(record, remainingRecords)) > 1:
+				return nil, fmt.Errorf("%v record %v of type %v matches %v records, add the ID or value to delete one of them: %w",
+					loggingPrefixLibdnsNetcup, record.HostName, record.RecType, len(findRecords(record, remainingRecords)), ErrAmbiguousMatch)
+			}
+		}
+
+		for foundRecord := findRecord(record, remainingRecords); foundRecord != nil; foundRecord = findRecord(record, remainingRecords) {
+			remainingRecords = removeRecordByID(foundRecord.ID, remainingRecords)
+			recordToDelete := *foundRecord
+			recordToDelete.DeleteRecord = true
+			recordsToDelete = append(recordsToDelete, recordToDelete)
+
+			if record.ID != "" || record.Destination == "" {
+				break
+			}
+		}
+	}
+	return recordsToDelete, nil
+}
+
+// Checks if all records have an ID. For no records this is false, since there is nothing to write directly.
+func allRecordsHaveIDs(records []dnsRecord) bool {
+	if len(records) == 0 {
+		return false
+	}
+	for _, record := range records {
+		if record.ID == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks that every given record with an ID exists in the existing records.
+func verifyRecordIDs(records []dnsRecord, existingRecords []dnsRecord) error {
+	for _, record := range records {
+		if record.ID != "" && findRecordByID(record.ID, existingRecords) == nil {
+			return fmt.Errorf("%v record with ID %v not found in zone", loggingPrefixLibdnsNetcup, record.ID)
+		}
+	}
+	return nil
+}
+
+// Returns the written records (except deletions) as they are in currentRecords, which are read from netcup after the update,
+// so every returned record has the ID assigned by netcup. Updated records are found by their ID, appended records by their
+// values among the records, that were not in beforeRecords. If netcup normalized a value, the record is found by the value
+// compared case-insensitively and without trailing dot. Fails with ErrRecordIDUnresolved, if a record is not found.
+func resolveRecordIDs(writtenRecords []dnsRecord, beforeRecords []dnsRecord, currentRecords []dnsRecord) ([]dnsRecord, error) {
+	var newRecords []dnsRecord
+	for _, record := range currentRecords {
+		if findRecordByID(record.ID, beforeRecords) == nil {
+			newRecords = append(newRecords, record)
 		}
 	}
-	return recordsToDelete
+
+	var resolvedRecords []dnsRecord
+	for _, record := range writtenRecords {
+		if record.DeleteRecord {
+			continue
+		}
+
+		var foundRecord *dnsRecord
+		if record.ID != "" {
+			foundRecord = findRecordByID(record.ID, currentRecords)
+		} else {
+			foundRecord = findEqualRecord(record, newRecords)
+			if foundRecord == nil {
+				foundRecord = findNormalizedRecord(record, newRecords)
+			}
+			if foundRecord != nil {
+				newRecords = removeRecordByID(foundRecord.ID, newRecords)
+			}
+		}
+		if foundRecord == nil || foundRecord.ID == "" {
+			return nil, fmt.Errorf("%v record %v of type %v with value %v was written, but its ID could not be determined: %w",
+				loggingPrefixLibdnsNetcup, record.HostName, record.RecType, record.Destination, ErrRecordIDUnresolved)
+		}
+		resolvedRecords = append(resolvedRecords, *foundRecord)
+	}
+	return resolvedRecords, nil
+}
+
+// Searches for a record with the values of the given record, comparing them case-insensitively and without trailing dot.
+func findNormalizedRecord(record dnsRecord, records []dnsRecord) *dnsRecord {
+	normalize := func(value string) string {
+		return strings.ToLower(strings.TrimSuffix(value, "."))
+	}
+	for i := range records {
+		existingRecord := &records[i]
+		if normalize(existingRecord.HostName) == normalize(record.HostName) && canonicalType(existingRecord.RecType) == canonicalType(record.RecType) &&
+			normalize(existingRecord.Destination) == normalize(record.Destination) && existingRecord.Priority == record.Priority {
+			return existingRecord
+		}
+	}
+	return nil
 }
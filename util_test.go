@@ -0,0 +1,247 @@
+package netcup
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestDifference(t *testing.T) {
+	www := dnsRecord{ID: "1", HostName: "www", RecType: "A", Destination: "192.0.2.1"}
+	mail := dnsRecord{ID: "2", HostName: "@", RecType: "MX", Destination: "mail.example.com", Priority: 10}
+	deletedMail := mail
+	deletedMail.DeleteRecord = true
+
+	tests := []struct {
+		name     string
+		a, b     []dnsRecord
+		expected []dnsRecord
+	}{
+		{"record deleted", []dnsRecord{www, mail}, []dnsRecord{www}, []dnsRecord{mail}},
+		{"nothing deleted", []dnsRecord{www, mail}, []dnsRecord{www, mail}, nil},
+		// the records sent for deletion are marked, the ones read before are not
+		{"marked for deletion", []dnsRecord{www, mail}, []dnsRecord{deletedMail}, []dnsRecord{www}},
+		{"marked records left", []dnsRecord{www, deletedMail}, []dnsRecord{www, mail}, nil},
+		{"priority changed", []dnsRecord{mail}, []dnsRecord{{ID: "2", HostName: "@", RecType: "MX", Destination: "mail.example.com", Priority: 20}}, []dnsRecord{mail}},
+		{"new ID", []dnsRecord{www}, []dnsRecord{{ID: "3", HostName: "www", RecType: "A", Destination: "192.0.2.1"}}, []dnsRecord{www}},
+	}
+	for _, test := range tests {
+		if diff := difference(test.a, test.b); !reflect.DeepEqual(diff, test.expected) {
+			t.Errorf("%v: expected %+v, got %+v", test.name, test.expected, diff)
+		}
+	}
+}
+
+func TestSRVRecordConversion(t *testing.T) {
+	netcupRecord := dnsRecord{ID: "1", HostName: "_sip._tcp", RecType: "SRV", Destination: "5 5060 sip.example.com.", Priority: 10}
+	libdnsRecord := libdns.Record{ID: "1", Type: "SRV", Name: "_sip._tcp", Value: "5060 sip.example.com.", TTL: time.Hour, Priority: 10, Weight: 5}
+
+	if records := toLibdnsRecords([]dnsRecord{netcupRecord}, time.Hour); !reflect.DeepEqual(records, []libdns.Record{libdnsRecord}) {
+		t.Fatalf("Expected %+v, got %+v", libdnsRecord, records)
+	}
+	if records := toNetcupRecords(fakeZone, []libdns.Record{libdnsRecord}); !reflect.DeepEqual(records, []dnsRecord{netcupRecord}) {
+		t.Fatalf("Expected %+v, got %+v", netcupRecord, records)
+	}
+
+	// the weight may still be part of the value
+	legacy := libdns.Record{Type: "SRV", Name: "_sip._tcp", Value: "5 5060 sip.example.com.", Priority: 10}
+	if records := toNetcupRecords(fakeZone, []libdns.Record{legacy}); records[0].Destination != "5 5060 sip.example.com." {
+		t.Fatalf("Expected the value to be kept, got %+v", records)
+	}
+	// a destination, that isn't "weight port target", is kept
+	invalid := dnsRecord{HostName: "_sip._tcp", RecType: "SRV", Destination: "sip.example.com."}
+	if records := toLibdnsRecords([]dnsRecord{invalid}, time.Hour); records[0].Value != "sip.example.com." || records[0].Weight != 0 {
+		t.Fatalf("Expected the destination as value, got %+v", records)
+	}
+}
+
+func TestLowercaseTypeConversion(t *testing.T) {
+	srv := dnsRecord{HostName: "_sip._tcp", RecType: "srv", Destination: "5 5060 sip.example.com.", Priority: 10}
+	if records := toLibdnsRecords([]dnsRecord{srv}, time.Hour); records[0].Weight != 5 || records[0].Value != "5060 sip.example.com." {
+		t.Fatalf("Expected the weight to be split off, got %+v", records)
+	}
+	tests := []libdns.Record{
+		{Type: "srv", Name: "_sip._tcp", Value: "5060 sip.example.com.", Priority: 10, Weight: 5},
+		{Type: "caa", Name: "@", Value: "0 issue letsencrypt.org"},
+		{Type: "txt", Name: "@", Value: strings.Repeat("a", 300)},
+	}
+	expected := []string{"5 5060 sip.example.com.", `0 issue "letsencrypt.org"`, `"` + strings.Repeat("a", 255) + `" "` + strings.Repeat("a", 45) + `"`}
+	for i, record := range toNetcupRecords(fakeZone, tests) {
+		if record.Destination != expected[i] {
+			t.Errorf("%v: expected the destination %q, got %q", tests[i].Type, expected[i], record.Destination)
+		}
+	}
+}
+
+func TestFormatCAA(t *testing.T) {
+	tests := map[string]string{
+		`0 issue "letsencrypt.org"`:                `0 issue "letsencrypt.org"`,
+		`0 issue letsencrypt.org`:                  `0 issue "letsencrypt.org"`,
+		`  128   issuewild   ";"  `:                `128 issuewild ";"`,
+		`0 iodef "mailto:security@example.com"`:    `0 iodef "mailto:security@example.com"`,
+		`0 issue "ca.example.net; account=230123"`: `0 issue "ca.example.net; account=230123"`,
+		`0 issue ca.example.net; account=230123`:   `0 issue "ca.example.net; account=230123"`,
+		`0 tbs say "hi"`:                           `0 tbs "say \"hi\""`,
+		// not "flags tag value"
+		`issue letsencrypt.org`:     `issue letsencrypt.org`,
+		`300 issue letsencrypt.org`: `300 issue letsencrypt.org`,
+	}
+	for data, expected := range tests {
+		if formatted := formatCAA(data); formatted != expected {
+			t.Errorf("formatCAA(%q) = %q, expected %q", data, formatted, expected)
+		}
+	}
+}
+
+func TestFormatDS(t *testing.T) {
+	tests := map[string]string{
+		"2371 13 2 1F987CC6583E92DF0890718C42A1C5C4F8BD4E2F2D7D2A1E4E5E0E3C0E2C56F7":       "2371 13 2 1F987CC6583E92DF0890718C42A1C5C4F8BD4E2F2D7D2A1E4E5E0E3C0E2C56F7",
+		"2371 13 2 1f987cc6583e92df0890718c42a1c5c4f8bd4e2f2d7d2a1e4e5e0e3c0e2c56f7":       "2371 13 2 1F987CC6583E92DF0890718C42A1C5C4F8BD4E2F2D7D2A1E4E5E0E3C0E2C56F7",
+		"  2371  13 2 1F987CC6583E92DF0890718C42A1C5C4 F8BD4E2F2D7D2A1E4E5E0E3C0E2C56F7  ": "2371 13 2 1F987CC6583E92DF0890718C42A1C5C4F8BD4E2F2D7D2A1E4E5E0E3C0E2C56F7",
+		"60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118":                               "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+		// not "key-tag algorithm digest-type digest"
+		"2371 13 2":           "2371 13 2",
+		"70000 13 2 1F98":     "70000 13 2 1F98",
+		"2371 13 2 not-a-hex": "2371 13 2 not-a-hex",
+	}
+	for data, expected := range tests {
+		if formatted := formatDS(data); formatted != expected {
+			t.Errorf("formatDS(%q) = %q, expected %q", data, formatted, expected)
+		}
+	}
+}
+
+// dkimValue is a TXT value of 400 bytes, like the DKIM key of a 2048 bit RSA key
+var dkimValue = ("v=DKIM1; k=rsa; p=" + strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA", 10))[:394] + "IDAQAB"
+
+func TestSplitTXT(t *testing.T) {
+	if len(dkimValue) != 400 {
+		t.Fatalf("Expected a value of 400 bytes, got %v", len(dkimValue))
+	}
+	destination := splitTXT(dkimValue)
+	strs, ok := parseQuotedStrings(destination)
+	if !ok || len(strs) != 2 || len(strs[0]) != 255 || strs[0]+strs[1] != dkimValue {
+		t.Fatalf("Expected two strings of 255 and 145 bytes, got %q", destination)
+	}
+	if joined := joinTXT(destination); joined != dkimValue {
+		t.Fatalf("Expected the value to be joined again, got %q", joined)
+	}
+
+	// quotes and backslashes are escaped, and multi-byte characters are not split
+	value := strings.Repeat("ä", 200) + `say "hi" \o/`
+	strs, ok = parseQuotedStrings(splitTXT(value))
+	if !ok || len(strs) != 2 || len(strs[0]) != 254 || strs[0]+strs[1] != value {
+		t.Fatalf("Expected the value split at a character boundary, got %q", strs)
+	}
+
+	tests := map[string]string{
+		// short values are kept as they are
+		"v=spf1 -all":  "v=spf1 -all",
+		`"quoted"`:     `"quoted"`,
+		`"a" "b"`:      `"a" "b"`,
+		"":             "",
+		"not \"quoted": "not \"quoted",
+	}
+	for value, expected := range tests {
+		if destination := splitTXT(value); destination != expected {
+			t.Errorf("splitTXT(%q) = %q, expected %q", value, destination, expected)
+		}
+	}
+}
+
+func TestJoinTXT(t *testing.T) {
+	tests := map[string]string{
+		`"v=DKIM1; k=rsa; " "p=MIIB"`: "v=DKIM1; k=rsa; p=MIIB",
+		`"a"  "b"	"c"`:                "abc",
+		`"say \"hi\"" " \\o/"`:        `say "hi" \o/`,
+		`"\065" "\066"`:               "AB",
+		// a single string or anything else is kept as it is
+		`"quoted"`:      `"quoted"`,
+		"v=spf1 -all":   "v=spf1 -all",
+		`"a" b`:         `"a" b`,
+		`"unterminated`: `"unterminated`,
+		`"a" "b\`:       `"a" "b\`,
+	}
+	for destination, expected := range tests {
+		if value := joinTXT(destination); value != expected {
+			t.Errorf("joinTXT(%q) = %q, expected %q", destination, value, expected)
+		}
+	}
+}
+
+func TestRelativeName(t *testing.T) {
+	tests := []struct {
+		name, zone, expected string
+	}{
+		{"@", "example.com", "@"},
+		{"", "example.com", "@"},
+		{"example.com", "example.com", "@"},
+		{"example.com.", "example.com", "@"},
+		{"Example.COM.", "example.com.", "@"},
+		{"www", "example.com", "www"},
+		{"www.example.com", "example.com", "www"},
+		{"www.example.com.", "example.com", "www"},
+		{"WWW.Example.com.", "example.com", "WWW"},
+		{"_acme-challenge.www.example.com.", "example.com", "_acme-challenge.www"},
+		{"*", "example.com", "*"},
+		{"*.example.com.", "example.com", "*"},
+		{"*.dev.example.com", "example.com", "*.dev"},
+		// names, which only end like the zone, are relative already
+		{"notexample.com", "example.com", "notexample.com"},
+		{"www.example.org.", "example.com", "www.example.org"},
+	}
+	for _, tt := range tests {
+		if name := RelativeName(tt.name, tt.zone); name != tt.expected {
+			t.Errorf("RelativeName(%q, %q) = %q, expected %q", tt.name, tt.zone, name, tt.expected)
+		}
+	}
+}
+
+func TestCheckRecordTypes(t *testing.T) {
+	for _, recType := range []string{"A", "AAAA", "CAA", "CNAME", "DS", "MX", "NS", "OPENPGPKEY", "SMIMEA", "SRV", "SSHFP", "TLSA", "TXT", "txt", "Cname"} {
+		if err := checkRecordTypes([]libdns.Record{{Name: "www", Type: recType}}); err != nil {
+			t.Errorf("Expected type %v to be supported, got %v", recType, err)
+		}
+	}
+	for _, recType := range []string{"CNAMEE", "PTR", "SOA", ""} {
+		err := checkRecordTypes([]libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.1"}, {Name: "mail", Type: recType, Value: "value"}})
+		if !errors.Is(err, ErrUnsupportedRecordType) || !strings.Contains(err.Error(), `"mail"`) {
+			t.Errorf("Expected type %q to be unsupported with the name of the record, got %v", recType, err)
+		}
+	}
+}
+
+func TestFindRecordPointsIntoRecords(t *testing.T) {
+	records := []dnsRecord{
+		{ID: "1", HostName: "www", RecType: "A", Destination: "192.0.2.1"},
+		{ID: "2", HostName: "@", RecType: "MX", Destination: "mail.example.com", Priority: 10},
+	}
+
+	found := map[string]*dnsRecord{
+		"findRecordByID":              findRecordByID("2", records),
+		"findRecordByNameAndType":     findRecordByNameAndType("@", "MX", records),
+		"findRecord by name and type": findRecord(dnsRecord{HostName: "@", RecType: "MX", Priority: 10}, records),
+		"findRecord by destination":   findRecord(dnsRecord{HostName: "@", RecType: "MX", Destination: "mail.example.com", Priority: 10}, records),
+		"findEqualRecord":             findEqualRecord(dnsRecord{HostName: "@", RecType: "MX", Destination: "mail.example.com", Priority: 10}, records),
+		"findNormalizedRecord":        findNormalizedRecord(dnsRecord{HostName: "@", RecType: "mx", Destination: "MAIL.example.com.", Priority: 10}, records),
+	}
+	for name, record := range found {
+		// the found record is the one in the slice, not a copy of it
+		if record != &records[1] {
+			t.Fatalf("Expected %v to return a pointer to the second record, got %p instead of %p", name, record, &records[1])
+		}
+	}
+
+	// so changing it changes the record in the slice, and later searches find the change
+	findRecordByID("1", records).Destination = "192.0.2.2"
+	if records[0].Destination != "192.0.2.2" {
+		t.Fatalf("Expected the change of the found record in the slice, got %+v", records[0])
+	}
+	if record := findRecordByNameAndType("www", "A", records); record.Destination != "192.0.2.2" {
+		t.Fatalf("Expected the changed record to be found, got %+v", record)
+	}
+}
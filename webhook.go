@@ -0,0 +1,227 @@
+// Webhook notifications about record changes
+
+package netcup
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookPayloadVersion is the version of the schema of WebhookPayload. It is increased on incompatible changes.
+const WebhookPayloadVersion = 1
+
+// WebhookSignatureHeader is the HTTP header containing the signature of a webhook request:
+// "sha256=" followed by the hex encoded HMAC-SHA256 of the request body with Provider.WebhookSecret as key.
+const WebhookSignatureHeader = "X-Libdns-Netcup-Signature"
+
+const (
+	// number of attempts to deliver a webhook request
+	webhookAttempts = 3
+	// timeout of a single attempt
+	webhookTimeout = 10 * time.Second
+)
+
+// webhookClient sends the webhook requests. It is separate from the client for the netcup API, which has nothing in common with the webhook receiver.
+var webhookClient = &http.Client{}
+
+// delay before the first retry of a webhook request, doubled for every further retry
+var webhookRetryDelay = time.Second
+
+// WebhookPayload is the JSON body of the webhook requests, which are sent to Provider.WebhookURL after every
+// successful call, that changed records.
+type WebhookPayload struct {
+	// Version of the payload schema, see WebhookPayloadVersion
+	Version int `json:"version"`
+	// Zone is the name of the zone without trailing dot
+	Zone string `json:"zone"`
+	// Operation is "append", "set", "delete", "sync", "delegate", "remove_delegation" or "batch" for coalesced calls
+	Operation string `json:"operation"`
+	// Changes contains one entry per changed record
+	Changes []WebhookChange `json:"changes"`
+	// Timestamp is the time of the change
+	Timestamp time.Time `json:"timestamp"`
+	// ClientRequestID is the ID sent with the netcup API requests of the operation
+	ClientRequestID string `json:"client_request_id"`
+}
+
+// WebhookChange is the change of a single record. Before is missing for added records, After for deleted ones.
+type WebhookChange struct {
+	Before *WebhookRecord `json:"before,omitempty"`
+	After  *WebhookRecord `json:"after,omitempty"`
+}
+
+// WebhookRecord is a DNS record in the webhook payload. TTL is in seconds.
+type WebhookRecord struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Priority int    `json:"priority"`
+	TTL      int64  `json:"ttl"`
+}
+
+// Returns the changes between the records before and after an update, matched by ID.
+func recordChanges(before []dnsRecord, after []dnsRecord, ttl time.Duration) []WebhookChange {
+	var changes []WebhookChange
+	for _, record := range before {
+		afterRecord := findRecordByID(record.ID, after)
+		if afterRecord == nil {
+			changes = append(changes, WebhookChange{Before: toWebhookRecord(record, ttl)})
+		} else if !afterRecord.equals(record) {
+			changes = append(changes, WebhookChange{Before: toWebhookRecord(record, ttl), After: toWebhookRecord(*afterRecord, ttl)})
+		}
+	}
+	for _, record := range after {
+		if findRecordByID(record.ID, before) == nil {
+			changes = append(changes, WebhookChange{After: toWebhookRecord(record, ttl)})
+		}
+	}
+
+	return changes
+}
+
+func toWebhookRecord(record dnsRecord, ttl time.Duration) *WebhookRecord {
+	return &WebhookRecord{
+		ID:       record.ID,
+		Name:     record.HostName,
+		Type:     record.RecType,
+		Value:    record.Destination,
+		Priority: record.Priority,
+		TTL:      int64(ttl / time.Second),
+	}
+}
+
+// Sends the changes of an operation to the webhook URL, if it is configured and records were changed.
+// The request is sent in the background, so it never delays or fails the operation. Failures are only logged.
+// Close waits for the requests in the background.
+func (p *Provider) notifyWebhook(ctx context.Context, zone string, operation string, before []dnsRecord, after []dnsRecord, ttl time.Duration) {
+	if p.WebhookURL == "" {
+		return
+	}
+	changes := recordChanges(before, after, ttl)
+	if len(changes) == 0 {
+		return
+	}
+
+	clientRequestID, _ := ctx.Value(clientRequestIDKey{}).(string)
+	payload := WebhookPayload{
+		Version:         WebhookPayloadVersion,
+		Zone:            zone,
+		Operation:       operation,
+		Changes:         changes,
+		Timestamp:       time.Now().UTC(),
+		ClientRequestID: clientRequestID,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		p.warnf("%v Failed to encode webhook payload: %v", loggingPrefixLibdnsNetcup, err)
+		return
+	}
+
+	p.webhooksGroup.Add(1)
+	go func() {
+		defer p.webhooksGroup.Done()
+		p.sendWebhook(p.WebhookURL, p.WebhookSecret, body)
+	}()
+}
+
+// Returns the channel, that is closed, when Close stops the webhook requests in the background.
+func (p *Provider) webhooksStopped() chan struct{} {
+	p.webhooksInitOnce.Do(func() {
+		p.webhooksStop = make(chan struct{})
+	})
+	return p.webhooksStop
+}
+
+// Waits until the webhook requests in the background are sent or given up, at most until the context is done, and
+// stops the remaining ones then.
+func (p *Provider) waitForWebhooks(ctx context.Context) {
+	sent := make(chan struct{})
+	go func() {
+		p.webhooksGroup.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-ctx.Done():
+	}
+	stop := p.webhooksStopped()
+	p.webhooksStopOnce.Do(func() {
+		close(stop)
+	})
+}
+
+// Sends the webhook request, retrying it a few times with increasing delays on errors, until the provider is closed.
+func (p *Provider) sendWebhook(url string, secret string, body []byte) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := p.webhooksStopped()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := postWebhook(ctx, url, signature, body)
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			p.warnf("%v Stopped sending webhook request to %v, the provider is closed: %v", loggingPrefixLibdnsNetcup, url, err)
+			return
+		}
+		if attempt == webhookAttempts {
+			p.warnf("%v Failed to send webhook request to %v after %v attempts: %v", loggingPrefixLibdnsNetcup, url, attempt, err)
+			return
+		}
+		p.warnf("%v Failed to send webhook request to %v, retrying in %v: %v", loggingPrefixLibdnsNetcup, url, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			p.warnf("%v Stopped sending webhook request to %v, the provider is closed", loggingPrefixLibdnsNetcup, url)
+			return
+		}
+		delay *= 2
+	}
+}
+
+func postWebhook(ctx context.Context, url string, signature string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, signature)
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+
+	return nil
+}
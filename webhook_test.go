@@ -0,0 +1,196 @@
+package netcup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+const webhookSecret = "secret"
+
+// newWebhookReceiver starts a webhook receiver, that verifies the signature of every request and sends the payloads to the returned channel.
+// The first failures requests are answered with an error.
+func newWebhookReceiver(t *testing.T, failures int32) (*httptest.Server, <-chan WebhookPayload) {
+	payloads := make(chan WebhookPayload, 10)
+	var requests int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(webhookSecret))
+		mac.Write(body)
+		if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); r.Header.Get(WebhookSignatureHeader) != expected {
+			t.Errorf("Invalid signature %q, expected %q", r.Header.Get(WebhookSignatureHeader), expected)
+		}
+
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Invalid payload %s: %v", body, err)
+		}
+		payloads <- payload
+	}))
+	t.Cleanup(receiver.Close)
+
+	return receiver, payloads
+}
+
+func receivePayload(t *testing.T, payloads <-chan WebhookPayload) WebhookPayload {
+	select {
+	case payload := <-payloads:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatal("No webhook request received")
+		return WebhookPayload{}
+	}
+}
+
+func TestProvider_Webhook(t *testing.T) {
+	p, server := newFakeProvider(t,
+		netcuptest.Record{ID: "1", HostName: "www", Type: "A", Destination: "192.0.2.1"},
+		netcuptest.Record{ID: "2", HostName: "mail", Type: "A", Destination: "192.0.2.2"},
+	)
+	receiver, payloads := newWebhookReceiver(t, 0)
+	p.WebhookURL = receiver.URL
+	p.WebhookSecret = webhookSecret
+	ctx := context.Background()
+
+	if _, err := p.AppendRecords(ctx, fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+	payload := receivePayload(t, payloads)
+	if payload.Version != WebhookPayloadVersion || payload.Zone != fakeZone || payload.Operation != "append" || payload.Timestamp.IsZero() {
+		t.Fatalf("Unexpected payload %+v", payload)
+	}
+	if len(payload.Changes) != 1 || payload.Changes[0].Before != nil || payload.Changes[0].After.Value != "token" || payload.Changes[0].After.TTL != 86400 {
+		t.Fatalf("Expected the appended record as change, got %+v", payload.Changes)
+	}
+	// the client request ID of the operation starts the IDs of its requests to netcup
+	calls := server.Calls()
+	var param struct {
+		ClientRequestID string `json:"clientrequestid"`
+	}
+	json.Unmarshal(calls[len(calls)-2].Param, &param)
+	if payload.ClientRequestID == "" || !strings.HasPrefix(param.ClientRequestID, payload.ClientRequestID+"-") {
+		t.Fatalf("Expected the client request ID of the netcup request %q to start with %q", param.ClientRequestID, payload.ClientRequestID)
+	}
+
+	if _, err := p.SetRecords(ctx, fakeZone, []libdns.Record{{ID: "1", Type: "A", Name: "www", Value: "192.0.2.3"}}); err != nil {
+		t.Fatal(err)
+	}
+	payload = receivePayload(t, payloads)
+	if payload.Operation != "set" || len(payload.Changes) != 1 || payload.Changes[0].Before.Value != "192.0.2.1" || payload.Changes[0].After.Value != "192.0.2.3" {
+		t.Fatalf("Expected the updated record with its old and new value, got %+v", payload)
+	}
+
+	if _, err := p.DeleteRecords(ctx, fakeZone, []libdns.Record{{ID: "2", Type: "A", Name: "mail", Value: "192.0.2.2"}}); err != nil {
+		t.Fatal(err)
+	}
+	payload = receivePayload(t, payloads)
+	if payload.Operation != "delete" || len(payload.Changes) != 1 || payload.Changes[0].Before.ID != "2" || payload.Changes[0].After != nil {
+		t.Fatalf("Expected the deleted record as change, got %+v", payload)
+	}
+}
+
+func TestProvider_WebhookRetries(t *testing.T) {
+	retryDelay := webhookRetryDelay
+	webhookRetryDelay = 10 * time.Millisecond
+	t.Cleanup(func() { webhookRetryDelay = retryDelay })
+
+	p, _ := newFakeProvider(t)
+	receiver, payloads := newWebhookReceiver(t, webhookAttempts-1)
+	p.WebhookURL = receiver.URL
+	p.WebhookSecret = webhookSecret
+
+	if _, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+	if payload := receivePayload(t, payloads); payload.Operation != "append" {
+		t.Fatalf("Unexpected payload %+v", payload)
+	}
+}
+
+func TestProvider_WebhookFailureDoesNotFailOperation(t *testing.T) {
+	p, server := newFakeProvider(t)
+	p.WebhookURL = "http://127.0.0.1:1/unreachable"
+
+	if _, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+	if records := server.Records(fakeZone); len(records) != 1 {
+		t.Fatalf("Expected the record to be appended, got %+v", records)
+	}
+}
+
+func TestProvider_CloseWaitsForWebhooks(t *testing.T) {
+	retryDelay := webhookRetryDelay
+	webhookRetryDelay = 20 * time.Millisecond
+	t.Cleanup(func() { webhookRetryDelay = retryDelay })
+
+	p, _ := newFakeProvider(t)
+	receiver, payloads := newWebhookReceiver(t, webhookAttempts-1)
+	p.WebhookURL = receiver.URL
+	p.WebhookSecret = webhookSecret
+
+	if _, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the payload was delivered before Close returned
+	select {
+	case payload := <-payloads:
+		if payload.Operation != "append" {
+			t.Fatalf("Unexpected payload %+v", payload)
+		}
+	default:
+		t.Fatal("Expected Close to wait for the webhook request")
+	}
+}
+
+func TestProvider_CloseStopsWebhookRetries(t *testing.T) {
+	retryDelay := webhookRetryDelay
+	webhookRetryDelay = time.Hour
+	t.Cleanup(func() { webhookRetryDelay = retryDelay })
+
+	p, _ := newFakeProvider(t)
+	receiver, _ := newWebhookReceiver(t, webhookAttempts)
+	p.WebhookURL = receiver.URL
+
+	if _, err := p.AppendRecords(context.Background(), fakeZone, []libdns.Record{{Type: "TXT", Name: "@", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	p.Close(ctx)
+	// the wait for the retry is given up with the context of Close
+	done := make(chan struct{})
+	go func() {
+		p.webhooksGroup.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the webhook retries to stop")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected Close to return after its context, took %v", elapsed)
+	}
+}
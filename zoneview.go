@@ -0,0 +1,154 @@
+// Indexed, read-only view of the records of a zone
+
+package netcup
+
+import (
+	"context"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// ZoneView is an immutable view of the records of a zone with lookups by name and type.
+// Names are relative to the zone like in libdns records and compared case-insensitively, "" and "@" both are the apex.
+// Types are compared case-insensitively. A ZoneView is safe for concurrent use.
+type ZoneView struct {
+	records    []libdns.Record
+	byName     map[string][]libdns.Record
+	byNameType map[recordGroup][]libdns.Record
+}
+
+// NewZoneView returns a view of the given records. The records are copied, so later changes of the slice don't affect the view.
+func NewZoneView(records []libdns.Record) *ZoneView {
+	view := &ZoneView{
+		records:    append([]libdns.Record(nil), records...),
+		byName:     make(map[string][]libdns.Record),
+		byNameType: make(map[recordGroup][]libdns.Record),
+	}
+	for _, record := range view.records {
+		name := canonicalName(record.Name)
+		view.byName[name] = append(view.byName[name], record)
+		key := recordGroup{hostName: name, recType: canonicalType(record.Type)}
+		view.byNameType[key] = append(view.byNameType[key], record)
+	}
+	return view
+}
+
+// GetZoneView returns a view of all records in the zone.
+func (p *Provider) GetZoneView(ctx context.Context, zone string) (*ZoneView, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return NewZoneView(records), nil
+}
+
+// Records returns all records of the view.
+func (view *ZoneView) Records() []libdns.Record {
+	return append([]libdns.Record(nil), view.records...)
+}
+
+// ByName returns all records with the given name.
+func (view *ZoneView) ByName(name string) []libdns.Record {
+	return append([]libdns.Record(nil), view.byName[canonicalName(name)]...)
+}
+
+// ByNameType returns all records with the given name and type, for example all values of a TXT record.
+func (view *ZoneView) ByNameType(name string, recType string) []libdns.Record {
+	return append([]libdns.Record(nil), view.byNameType[recordGroup{hostName: canonicalName(name), recType: canonicalType(recType)}]...)
+}
+
+// Apex returns all records at the apex of the zone.
+func (view *ZoneView) Apex() []libdns.Record {
+	return view.ByName("@")
+}
+
+// Wildcards returns all records with a wildcard name like "*" or "*.dev".
+func (view *ZoneView) Wildcards() []libdns.Record {
+	var wildcards []libdns.Record
+	for _, record := range view.records {
+		if name := canonicalName(record.Name); name == "*" || strings.HasPrefix(name, "*.") {
+			wildcards = append(wildcards, record)
+		}
+	}
+	return wildcards
+}
+
+// Has checks, if the view contains a record with the name, type, value, priority and weight of the given record. ID and TTL are ignored.
+func (view *ZoneView) Has(record libdns.Record) bool {
+	return findEqualLibdnsRecord(record, view.ByNameType(record.Name, record.Type)) >= 0
+}
+
+// Diff returns the changes from this view to the other one. Records with the same ID in both views, but different values,
+// are updated to the values of the other view. Of the remaining records, those with equal values in both views are unchanged,
+// the others are appended, if they are only in the other view, and deleted, if they are only in this view.
+func (view *ZoneView) Diff(other *ZoneView) *ChangeResult {
+	result := &ChangeResult{}
+	remaining := other.Records()
+	var unmatched []libdns.Record
+	for _, record := range view.records {
+		i := -1
+		if record.ID != "" {
+			i = findLibdnsRecordByID(record.ID, remaining)
+		}
+		if i < 0 {
+			unmatched = append(unmatched, record)
+			continue
+		}
+		if !equalLibdnsRecords(record, remaining[i]) {
+			result.Updated = append(result.Updated, remaining[i])
+			result.Previous = append(result.Previous, record)
+		}
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+
+	for _, record := range unmatched {
+		if i := findEqualLibdnsRecord(record, remaining); i >= 0 {
+			remaining = append(remaining[:i], remaining[i+1:]...)
+		} else {
+			result.Deleted = append(result.Deleted, record)
+		}
+	}
+	result.Appended = remaining
+
+	return result
+}
+
+// Returns the name in the form used as key of the view: lower case without trailing dot, "@" for the apex.
+func canonicalName(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" {
+		return "@"
+	}
+	return name
+}
+
+func canonicalType(recType string) string {
+	return strings.ToUpper(recType)
+}
+
+// Checks, if the two records have the same name, type, value, priority and weight.
+func equalLibdnsRecords(a, b libdns.Record) bool {
+	return canonicalName(a.Name) == canonicalName(b.Name) && canonicalType(a.Type) == canonicalType(b.Type) &&
+		a.Value == b.Value && a.Priority == b.Priority && a.Weight == b.Weight
+}
+
+// Returns the index of the first record, that equals the given record (disregarding ID and TTL), or -1.
+func findEqualLibdnsRecord(record libdns.Record, records []libdns.Record) int {
+	for i, existingRecord := range records {
+		if equalLibdnsRecords(record, existingRecord) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the index of the record with the given ID, or -1.
+func findLibdnsRecordByID(id string, records []libdns.Record) int {
+	for i, record := range records {
+		if record.ID == id {
+			return i
+		}
+	}
+	return -1
+}
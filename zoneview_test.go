@@ -0,0 +1,167 @@
+package netcup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/wizardrix/libdns_netcup/netcuptest"
+)
+
+func seededZoneRecords() []libdns.Record {
+	return []libdns.Record{
+		{ID: "1", Type: "A", Name: "@", Value: "192.0.2.1"},
+		{ID: "2", Type: "MX", Name: "@", Value: "mail.example.com", Priority: 10},
+		{ID: "3", Type: "TXT", Name: "@", Value: "v=spf1 -all"},
+		{ID: "4", Type: "TXT", Name: "@", Value: "verification=abc"},
+		{ID: "5", Type: "A", Name: "*", Value: "192.0.2.2"},
+		{ID: "6", Type: "CNAME", Name: "*.dev", Value: "dev.example.com"},
+		{ID: "7", Type: "A", Name: "www", Value: "192.0.2.3"},
+		{ID: "8", Type: "AAAA", Name: "www", Value: "2001:db8::3"},
+		{ID: "9", Type: "A", Name: "mail", Value: "192.0.2.4"},
+	}
+}
+
+// recordIDs returns the sorted IDs of the records.
+func recordIDs(records []libdns.Record) []string {
+	ids := []string{}
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func assertRecordIDs(t *testing.T, what string, records []libdns.Record, expected ...string) {
+	t.Helper()
+	if ids := recordIDs(records); fmt.Sprint(ids) != fmt.Sprint(expected) {
+		t.Fatalf("Expected %v to be %v, got %v", what, expected, ids)
+	}
+}
+
+func TestZoneView_Lookups(t *testing.T) {
+	view := NewZoneView(seededZoneRecords())
+
+	assertRecordIDs(t, "all records", view.Records(), "1", "2", "3", "4", "5", "6", "7", "8", "9")
+	assertRecordIDs(t, "the apex", view.Apex(), "1", "2", "3", "4")
+	assertRecordIDs(t, "the apex by empty name", view.ByName(""), "1", "2", "3", "4")
+	assertRecordIDs(t, "the wildcards", view.Wildcards(), "5", "6")
+	assertRecordIDs(t, "www", view.ByName("WWW"), "7", "8")
+	assertRecordIDs(t, "www with trailing dot", view.ByName("www."), "7", "8")
+	assertRecordIDs(t, "the TXT values of the apex", view.ByNameType("@", "txt"), "3", "4")
+	assertRecordIDs(t, "the wildcard CNAME", view.ByNameType("*.dev", "CNAME"), "6")
+	assertRecordIDs(t, "a missing name", view.ByName("missing"))
+	assertRecordIDs(t, "a missing type", view.ByNameType("www", "MX"))
+
+	if !view.Has(libdns.Record{Type: "txt", Name: "", Value: "verification=abc"}) {
+		t.Fatal("Expected the second TXT value of the apex to be found")
+	}
+	if !view.Has(libdns.Record{Type: "MX", Name: "@", Value: "mail.example.com", Priority: 10}) {
+		t.Fatal("Expected the MX record to be found")
+	}
+	if view.Has(libdns.Record{Type: "MX", Name: "@", Value: "mail.example.com", Priority: 20}) {
+		t.Fatal("Expected no MX record with another priority")
+	}
+	if view.Has(libdns.Record{Type: "TXT", Name: "@", Value: "VERIFICATION=abc"}) {
+		t.Fatal("Expected values to be compared case-sensitively")
+	}
+}
+
+func TestZoneView_IsImmutable(t *testing.T) {
+	records := seededZoneRecords()
+	view := NewZoneView(records)
+
+	records[0].Value = "192.0.2.99"
+	view.Apex()[0].Value = "192.0.2.99"
+	view.Records()[0].Value = "192.0.2.99"
+
+	if apex := view.ByNameType("@", "A"); len(apex) != 1 || apex[0].Value != "192.0.2.1" {
+		t.Fatalf("Expected the view to be unchanged, got %+v", apex)
+	}
+}
+
+func TestZoneView_ConcurrentReads(t *testing.T) {
+	view := NewZoneView(seededZoneRecords())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			view.Apex()
+			view.Wildcards()
+			view.ByNameType("www", "A")
+			view.Has(libdns.Record{Type: "A", Name: "mail", Value: "192.0.2.4"})
+			view.Diff(view)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestZoneView_Diff(t *testing.T) {
+	before := NewZoneView(seededZoneRecords())
+
+	afterRecords := seededZoneRecords()
+	// update of www by ID
+	afterRecords[6].Value = "192.0.2.30"
+	// delete the second TXT value and the wildcard CNAME
+	afterRecords = append(afterRecords[:3], afterRecords[4:]...)
+	afterRecords = append(afterRecords[:4], afterRecords[5:]...)
+	// a new record and a record without ID equal to an existing one
+	afterRecords = append(afterRecords, libdns.Record{ID: "10", Type: "TXT", Name: "_acme-challenge", Value: "token"})
+	for i := range afterRecords {
+		if afterRecords[i].ID == "9" {
+			afterRecords[i].ID = ""
+		}
+	}
+	after := NewZoneView(afterRecords)
+
+	result := before.Diff(after)
+	assertRecordIDs(t, "the appended records", result.Appended, "10")
+	assertRecordIDs(t, "the updated records", result.Updated, "7")
+	assertRecordIDs(t, "the deleted records", result.Deleted, "4", "6")
+	if result.Updated[0].Value != "192.0.2.30" {
+		t.Fatalf("Expected the new value of the updated record, got %+v", result.Updated[0])
+	}
+
+	if result := before.Diff(before); len(result.Appended)+len(result.Updated)+len(result.Deleted) != 0 {
+		t.Fatalf("Expected no changes to the same view, got %+v", result)
+	}
+}
+
+func TestZoneView_DiffSRVWeight(t *testing.T) {
+	srv := libdns.Record{ID: "1", Type: "SRV", Name: "_sip._tcp", Value: "5060 sip.example.com.", Priority: 10, Weight: 5}
+	before := NewZoneView([]libdns.Record{srv})
+	srv.Weight = 20
+	after := NewZoneView([]libdns.Record{srv})
+
+	result := before.Diff(after)
+	assertRecordIDs(t, "the updated records", result.Updated, "1")
+	if result.Updated[0].Weight != 20 {
+		t.Fatalf("Expected the new weight of the updated record, got %+v", result.Updated[0])
+	}
+	if len(result.Appended)+len(result.Deleted) != 0 {
+		t.Fatalf("Expected only the update, got %+v", result)
+	}
+	if before.Has(srv) {
+		t.Fatal("Expected the SRV record with another weight not to be in the view")
+	}
+}
+
+func TestProvider_GetZoneView(t *testing.T) {
+	p, _ := newFakeProvider(t,
+		netcuptest.Record{ID: "1", HostName: "@", Type: "TXT", Destination: "one"},
+		netcuptest.Record{ID: "2", HostName: "@", Type: "TXT", Destination: "two"},
+		netcuptest.Record{ID: "3", HostName: "*", Type: "A", Destination: "192.0.2.1"},
+	)
+
+	view, err := p.GetZoneView(context.Background(), fakeZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRecordIDs(t, "the apex", view.Apex(), "1", "2")
+	assertRecordIDs(t, "the wildcards", view.Wildcards(), "3")
+}